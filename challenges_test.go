@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/0xhjohnson/clacksy/models"
+)
+
+func TestChallengeDataResult(t *testing.T) {
+	play := func(correct int) *models.SoundTestPlay {
+		p := &models.SoundTestPlay{Keyboard: "k", Keyswitch: "s", PlateMaterial: "p", KeycapMaterial: "c"}
+		right := []*string{&p.CorrectKeyboard, &p.CorrectKeyswitch, &p.CorrectPlateMaterial, &p.CorrectKeycapMaterial}
+		guesses := []string{p.Keyboard, p.Keyswitch, p.PlateMaterial, p.KeycapMaterial}
+		for i := range right {
+			*right[i] = "other"
+			if i < correct {
+				*right[i] = guesses[i]
+			}
+		}
+		return p
+	}
+	challenge := models.Challenge{CreatedBy: "alice", Opponent: "bob"}
+
+	tests := map[string]struct {
+		challenger *models.SoundTestPlay
+		opponent   *models.SoundTestPlay
+		want       string
+	}{
+		"challenger wins":   {challenger: play(3), opponent: play(1), want: "@alice wins 3 to 1"},
+		"opponent wins":     {challenger: play(0), opponent: play(4), want: "@bob wins 4 to 0"},
+		"tie":               {challenger: play(2), opponent: play(2), want: "A tie, 2 each"},
+		"waiting":           {challenger: play(2), want: ""},
+		"challenger hasn't": {opponent: play(2), want: ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := challengeData{Challenge: challenge, Challenger: tc.challenger, Opponent: tc.opponent}
+			if got := d.Result(); got != tc.want {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewChallengeRows(t *testing.T) {
+	challenger := &models.SoundTestPlay{
+		Keyboard: "Tofu65", CorrectKeyboard: "Tofu65",
+		Keyswitch: "Holy Panda", CorrectKeyswitch: "Gateron Ink",
+		PlateMaterial: "Brass", CorrectPlateMaterial: "POM",
+		KeycapMaterial: "PBT", CorrectKeycapMaterial: "PBT",
+	}
+	opponent := &models.SoundTestPlay{
+		Keyboard: "Zoom75", CorrectKeyboard: "Tofu65",
+		Keyswitch: "Gateron Ink", CorrectKeyswitch: "Gateron Ink",
+		PlateMaterial: "POM", CorrectPlateMaterial: "POM",
+		KeycapMaterial: "ABS", CorrectKeycapMaterial: "PBT",
+	}
+
+	tests := map[string]struct {
+		challenger *models.SoundTestPlay
+		opponent   *models.SoundTestPlay
+		want       []challengeRow
+	}{
+		"nobody answered": {},
+		"both answered": {
+			challenger: challenger,
+			opponent:   opponent,
+			want: []challengeRow{
+				{Part: "Keyboard", Answer: "Tofu65", ChallengerGuess: "Tofu65", OpponentGuess: "Zoom75"},
+				{Part: "Switches", Answer: "Gateron Ink", ChallengerGuess: "Holy Panda", OpponentGuess: "Gateron Ink"},
+				{Part: "Plate material", Answer: "POM", ChallengerGuess: "Brass", OpponentGuess: "POM"},
+				{Part: "Keycap material", Answer: "PBT", ChallengerGuess: "PBT", OpponentGuess: "ABS"},
+			},
+		},
+		"only the opponent answered": {
+			opponent: opponent,
+			want: []challengeRow{
+				{Part: "Keyboard", Answer: "Tofu65", OpponentGuess: "Zoom75"},
+				{Part: "Switches", Answer: "Gateron Ink", OpponentGuess: "Gateron Ink"},
+				{Part: "Plate material", Answer: "POM", OpponentGuess: "POM"},
+				{Part: "Keycap material", Answer: "PBT", OpponentGuess: "ABS"},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := newChallengeRows(tc.challenger, tc.opponent)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %+v, want: %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestChallengeHandlers(t *testing.T) {
+	app := newTestApplication(t, newTestDB(t))
+
+	challenger := testUser(t, app)
+	opponent := testUser(t, app)
+	latecomer := testUser(t, app)
+	uploader := testUser(t, app)
+
+	st := testSoundTest(t, app, uploader)
+	upcoming := testSoundTest(t, app, uploader)
+
+	_, err := app.soundtests.DB.Exec(context.Background(), "UPDATE sound_test SET daily_date = CURRENT_DATE + 36500 + (random() * 36500)::int WHERE sound_test_id = $1", upcoming.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts, err := app.parts.GetDaily(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wrongKeyboard string
+	for _, k := range parts.Keyboards {
+		if k.ID != st.KeyboardID {
+			wrongKeyboard = k.ID.String()
+		}
+	}
+	if wrongKeyboard == "" {
+		t.Skip("need more than one keyboard for a wrong answer")
+	}
+
+	newChallenge := func(st models.SoundTest) string {
+		id, err := app.challenges.Insert(st.ID.String(), challenger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id.String()
+	}
+
+	view := func(s *testSession, challengeID string) string {
+		res := s.do(withURLParam(app.getChallenge, "challengeID", challengeID), "/challenge/"+challengeID, nil)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("got status: %d, want: %d", res.StatusCode, http.StatusOK)
+		}
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	answer := func(s *testSession, challengeID string, guess url.Values) {
+		res := s.do(withURLParam(app.answerChallenge, "challengeID", challengeID), "/challenge/"+challengeID, guess)
+		assertRedirect(t, res, "/challenge/"+challengeID)
+	}
+
+	challengeID := newChallenge(st)
+
+	t.Run("resubmitted answer", func(t *testing.T) {
+		s := newTestSession(t, app, challenger)
+		answer(s, challengeID, practiceGuess(st))
+
+		wrong := practiceGuess(st)
+		wrong.Set("keyboard", wrongKeyboard)
+		answer(s, challengeID, wrong)
+
+		got, err := app.challenges.GetAnswer(st.ID.String(), challenger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Correct() != models.PartsPerPlay {
+			t.Errorf("want the first answer kept, got: %+v", got)
+		}
+	})
+
+	t.Run("practice play taken on open", func(t *testing.T) {
+		_, err := app.soundtests.AddPracticePlay(st.ID, opponent, wrongKeyboard, st.PlateMaterialID.String(), st.KeycapMaterialID.String(), st.KeyswitchID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := view(newTestSession(t, app, opponent), challengeID)
+
+		c, err := app.challenges.Get(challengeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.OpponentID == nil || c.OpponentID.String() != opponent {
+			t.Errorf("got opponent: %v, want: %s", c.OpponentID, opponent)
+		}
+		if !strings.Contains(body, "wins 4 to 3") {
+			t.Errorf("want the practice play as the answer, got: %s", body)
+		}
+	})
+
+	t.Run("taken", func(t *testing.T) {
+		s := newTestSession(t, app, latecomer)
+
+		if body := view(s, challengeID); !strings.Contains(body, "already took this challenge") {
+			t.Errorf("want taken, got: %s", body)
+		}
+
+		answer(s, challengeID, practiceGuess(st))
+		_, err := app.challenges.GetAnswer(st.ID.String(), latecomer)
+		if !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got: %v, want: %v", err, models.ErrNoRecord)
+		}
+	})
+
+	t.Run("upcoming daily", func(t *testing.T) {
+		upcomingID := newChallenge(upcoming)
+		s := newTestSession(t, app, opponent)
+
+		if body := view(s, upcomingID); !strings.Contains(body, "upcoming sound of the day") {
+			t.Errorf("want upcoming, got: %s", body)
+		}
+
+		answer(s, upcomingID, practiceGuess(upcoming))
+		_, err := app.challenges.GetAnswer(upcoming.ID.String(), opponent)
+		if !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got: %v, want: %v", err, models.ErrNoRecord)
+		}
+	})
+
+	t.Run("hints mode daily play", func(t *testing.T) {
+		wrong := practiceGuess(st)
+		_, finished, err := app.soundtests.AddAttempt(st.ID, latecomer, wrongKeyboard, wrong.Get("plate-material"), wrong.Get("keycap-material"), wrong.Get("keyswitch"), nil)
+		if err != nil || finished {
+			t.Fatalf("first attempt got finished: %v, err: %v", finished, err)
+		}
+		_, finished, err = app.soundtests.AddAttempt(st.ID, latecomer, st.KeyboardID.String(), st.PlateMaterialID.String(), st.KeycapMaterialID.String(), st.KeyswitchID.String(), nil)
+		if err != nil || !finished {
+			t.Fatalf("second attempt got finished: %v, err: %v", finished, err)
+		}
+
+		got, err := app.challenges.GetAnswer(st.ID.String(), latecomer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Correct() != models.PartsPerPlay-1 {
+			t.Errorf("want the first guess as the answer, got: %+v", got)
+		}
+
+		_, err = app.challenges.AddAnswer(st.ID, latecomer, st.KeyboardID.String(), st.PlateMaterialID.String(), st.KeycapMaterialID.String(), st.KeyswitchID.String())
+		if !errors.Is(err, models.ErrPlayOver) {
+			t.Errorf("answering after playing got: %v, want: %v", err, models.ErrPlayOver)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/gofrs/uuid"
+)
+
+// hintClipSeconds is how much of the day's sound hints mode plays until the
+// whole soundtest is unlocked as a hint.
+const hintClipSeconds = 10
+
+// clipCache keeps the opening of the day's sound cut for hints mode, so
+// players only get the rest of it once they've earned the hint. Only the
+// latest soundtest's clip is kept.
+type clipCache struct {
+	mu   sync.Mutex
+	id   uuid.UUID
+	clip []byte
+}
+
+// get returns the clip of soundtest id, cutting it with cut if it isn't the
+// one kept.
+func (c *clipCache) get(id uuid.UUID, cut func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.id == id && c.clip != nil {
+		return c.clip, nil
+	}
+
+	clip, err := cut()
+	if err != nil {
+		return nil, err
+	}
+	c.id, c.clip = id, clip
+
+	return clip, nil
+}
+
+// cutClip encodes the first hintClipSeconds of the audio at url as AAC.
+func cutClip(url string) ([]byte, error) {
+	args := []string{"-i", url, "-t", strconv.Itoa(hintClipSeconds), "-vn", "-f", "adts", "pipe:1"}
+	return exec.Command("ffmpeg", args...).Output()
+}
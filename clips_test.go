@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestClipCacheGet(t *testing.T) {
+	var c clipCache
+	today, tomorrow := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+
+	cuts := 0
+	cut := func(clip string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			cuts++
+			return []byte(clip), nil
+		}
+	}
+
+	if _, err := c.get(today, func() ([]byte, error) { return nil, errors.New("ffmpeg failed") }); err == nil {
+		t.Fatal("want error from failed cut")
+	}
+
+	for i := 0; i < 2; i++ {
+		clip, err := c.get(today, cut("today"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(clip) != "today" {
+			t.Errorf("got: %q, want: %q", clip, "today")
+		}
+	}
+	if cuts != 1 {
+		t.Errorf("want one cut for repeated gets, got: %d", cuts)
+	}
+
+	clip, err := c.get(tomorrow, cut("tomorrow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(clip) != "tomorrow" || cuts != 2 {
+		t.Errorf("want a new clip for the next soundtest, got: %q after %d cuts", clip, cuts)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/0xhjohnson/clacksy/models"
+	"github.com/gofrs/uuid"
+)
+
+// featureDaily picks the sound of the day for every date it is somewhere in
+// the world that doesn't have one yet. It's meant to be run on a schedule at
+// least daily, a new date starts at 10:00 UTC.
+func (app *application) featureDaily() error {
+	for _, date := range models.CurrentDates(time.Now()) {
+		err := app.featureDailyOn(date)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (app *application) featureDailyOn(date time.Time) error {
+	day := date.Format("2006-01-02")
+
+	soundtestID, err := app.soundtests.FeatureDaily(date)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.infoLog.Printf("No soundtest featured for %s, it's already picked or there are no candidates", day)
+			return nil
+		}
+		return err
+	}
+
+	app.infoLog.Printf("Featured soundtest %s for %s", soundtestID, day)
+
+	err = app.notifications.NotifyFeatured(soundtestID)
+	if err != nil {
+		return err
+	}
+
+	soundtest, err := app.soundtests.Get(soundtestID.String(), "")
+	if err != nil {
+		return err
+	}
+
+	app.emitWebhook(models.EventDailyRotated, fmt.Sprintf("A new sound of the day is ready, can you guess the build? %s/play", app.baseURL), map[string]any{
+		"date":     day,
+		"play_url": app.baseURL + "/play",
+	})
+
+	// The build stays out of the payload so announcing it doesn't spoil the
+	// daily.
+	app.emitWebhook(models.EventSoundTestFeatured, fmt.Sprintf("@%s's soundtest is the sound of the day for %s", soundtest.CreatedBy, date.Format("2 January")), map[string]any{
+		"soundtest_id": soundtest.ID,
+		"uploader":     soundtest.CreatedBy,
+		"url":          app.baseURL + "/soundtest/" + soundtest.ID.String(),
+		"featured_on":  soundtest.FeaturedOn,
+		"date":         day,
+	})
+
+	return nil
+}
+
+// deliverDueWebhooks sends any webhook deliveries that are due, for running
+// without the server's background worker.
+func (app *application) deliverDueWebhooks() error {
+	attempted, err := app.deliverWebhooks()
+	if err != nil {
+		return err
+	}
+
+	app.infoLog.Printf("Attempted %d webhook deliveries", attempted)
+	return nil
+}
+
+// reconcileTallies rebuilds every vote tally from the vote table, fixing any
+// drift from votes written outside of VoteModel.Upsert.
+func (app *application) reconcileTallies() error {
+	fixed, err := app.votes.ReconcileTallies()
+	if err != nil {
+		return err
+	}
+
+	app.infoLog.Printf("Reconciled vote tallies, %d corrected", fixed)
+	return nil
+}
+
+// rateComparisons refits the ratings behind the tier lists to every
+// comparison, meant to be run on a schedule like -feature-daily.
+func (app *application) rateComparisons() error {
+	rated, err := app.comparisons.Rate()
+	if err != nil {
+		return err
+	}
+
+	app.infoLog.Printf("Rated %d soundtests, switches and keyboards from comparisons", rated)
+	return nil
+}
+
+// setRole changes a user's role from the command line. It's how the first
+// admin is made, after that roles are assigned from /admin/roles.
+func (app *application) setRole(email, role string) error {
+	if !models.ValidRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	userID, err := app.users.GetIDByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return fmt.Errorf("no user with email %q", email)
+		}
+		return err
+	}
+
+	err = app.users.SetRole(userID.String(), role, "")
+	if err != nil {
+		return err
+	}
+
+	app.infoLog.Printf("Set role of %s to %s", email, role)
+	return nil
+}
+
+// sendDigests emails every user their unread notifications of the kinds
+// they've asked for. It's meant to be run once a day.
+func (app *application) sendDigests() error {
+	digests, err := app.notifications.GetDigests()
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, d := range digests {
+		err := app.mailer.Send(d.Email, digestSubject(d), app.digestBody(d))
+		if err != nil {
+			app.errorLog.Printf("failed to send digest to %s: %v", d.UserID, err)
+			continue
+		}
+
+		ids := make([]uuid.UUID, len(d.Notifications))
+		for i, n := range d.Notifications {
+			ids[i] = n.ID
+		}
+
+		err = app.notifications.MarkEmailed(ids)
+		if err != nil {
+			return err
+		}
+		sent++
+	}
+
+	app.infoLog.Printf("Sent %d of %d notification digests", sent, len(digests))
+	return nil
+}
+
+func digestSubject(d models.Digest) string {
+	if len(d.Notifications) == 1 {
+		return "You have 1 new notification on clacksy"
+	}
+	return fmt.Sprintf("You have %d new notifications on clacksy", len(d.Notifications))
+}
+
+func (app *application) digestBody(d models.Digest) string {
+	var b strings.Builder
+
+	for _, n := range d.Notifications {
+		fmt.Fprintf(&b, "%s\n%s%s\n\n", n.Message(), app.baseURL, n.Path())
+	}
+
+	fmt.Fprintf(&b, "Change which notifications are emailed to you at %s/notifications\n", app.baseURL)
+
+	return b.String()
+}
@@ -3,6 +3,10 @@ package main
 type contextKey string
 
 const isAuthenticatedContextKey = contextKey("isAuthenticated")
+const accessContextKey = contextKey("access")
+const unreadContextKey = contextKey("unreadNotifications")
 const pageContextKey = contextKey("page")
 const userPlayContextKey = contextKey("userPlay")
+const guestIDContextKey = contextKey("guestID")
+const timezoneContextKey = contextKey("timezone")
 const authenticatedUserKey = contextKey("authenticatedUserID")
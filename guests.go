@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	guestCookieName   = "clacksy_guest"
+	guestCookieMaxAge = 400 * 24 * time.Hour
+)
+
+// newGuestSecret decodes the base64 GUEST_SECRET used to sign guest cookies.
+// Without one a random secret is used, so guests lose their plays whenever
+// the server restarts.
+func newGuestSecret(encoded string) ([]byte, error) {
+	if encoded != "" {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	return secret, err
+}
+
+// signGuestID returns the cookie value for guestID, the id followed by its
+// HMAC so visitors can't pick someone else's id.
+func signGuestID(secret []byte, guestID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(guestID))
+	return guestID + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyGuestID returns the guest id in a cookie value signed by signGuestID.
+func verifyGuestID(secret []byte, value string) (string, bool) {
+	guestID, _, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", false
+	}
+
+	if _, err := uuid.FromString(guestID); err != nil {
+		return "", false
+	}
+
+	if !hmac.Equal([]byte(value), []byte(signGuestID(secret, guestID))) {
+		return "", false
+	}
+
+	return guestID, true
+}
+
+// guestID is the id of the visitor playing without an account, or empty.
+func (app *application) guestID(r *http.Request) string {
+	guestID, ok := r.Context().Value(guestIDContextKey).(string)
+	if !ok {
+		return ""
+	}
+	return guestID
+}
+
+// requirePlayer lets visitors who aren't logged in play as a guest, giving
+// them a signed guest cookie the first time.
+func (app *application) requirePlayer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Cache-Control", "no-store")
+
+		if app.isAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var guestID string
+		if cookie, err := r.Cookie(guestCookieName); err == nil {
+			guestID, _ = verifyGuestID(app.guestSecret, cookie.Value)
+		}
+
+		if guestID == "" {
+			id, err := uuid.NewV4()
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+			guestID = id.String()
+		}
+
+		// Refreshed on every visit so regular guests keep their streak.
+		http.SetCookie(w, &http.Cookie{
+			Name:     guestCookieName,
+			Value:    signGuestID(app.guestSecret, guestID),
+			Path:     "/",
+			MaxAge:   int(guestCookieMaxAge.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		ctx := context.WithValue(r.Context(), guestIDContextKey, guestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// claimGuestPlays moves plays made as a guest into the account just logged in
+// to and forgets the guest. Failing to claim is logged rather than failing the
+// login.
+func (app *application) claimGuestPlays(w http.ResponseWriter, r *http.Request, userID string) int64 {
+	cookie, err := r.Cookie(guestCookieName)
+	if err != nil {
+		return 0
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: guestCookieName, Path: "/", MaxAge: -1})
+
+	guestID, ok := verifyGuestID(app.guestSecret, cookie.Value)
+	if !ok {
+		return 0
+	}
+
+	claimed, err := app.soundtests.ClaimGuestPlays(guestID, userID)
+	if err != nil {
+		app.errorLog.Printf("failed to claim guest plays: %v", err)
+		return 0
+	}
+
+	return claimed
+}
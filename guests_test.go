@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestVerifyGuestID(t *testing.T) {
+	secret := []byte("secret")
+	guestID := uuid.Must(uuid.NewV4()).String()
+	signed := signGuestID(secret, guestID)
+
+	tests := map[string]struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		"signed":         {value: signed, want: guestID, ok: true},
+		"other secret":   {value: signGuestID([]byte("other"), guestID), ok: false},
+		"swapped id":     {value: uuid.Must(uuid.NewV4()).String() + signed[len(guestID):], ok: false},
+		"unsigned":       {value: guestID, ok: false},
+		"not a uuid":     {value: signGuestID(secret, "admin"), ok: false},
+		"truncated hmac": {value: signed[:len(signed)-2], ok: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := verifyGuestID(secret, tc.value)
+			if ok != tc.ok || got != tc.want {
+				t.Errorf("got: %q, %v, want: %q, %v", got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
+
+func TestRequirePlayer(t *testing.T) {
+	app := application{guestSecret: []byte("secret")}
+	returningID := uuid.Must(uuid.NewV4()).String()
+
+	tests := map[string]struct {
+		authenticated bool
+		cookie        string
+		wantGuest     bool
+		wantGuestID   string
+	}{
+		"logged in":       {authenticated: true},
+		"new guest":       {wantGuest: true},
+		"returning guest": {cookie: signGuestID(app.guestSecret, returningID), wantGuest: true, wantGuestID: returningID},
+		"tampered cookie": {cookie: returningID + ".forged", wantGuest: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var gotGuestID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotGuestID = app.guestID(r)
+			})
+
+			ctx := context.WithValue(context.Background(), isAuthenticatedContextKey, tc.authenticated)
+			req, err := http.NewRequestWithContext(ctx, "GET", "/play", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: guestCookieName, Value: tc.cookie})
+			}
+
+			rr := httptest.NewRecorder()
+			app.requirePlayer(next).ServeHTTP(rr, req)
+
+			if !tc.wantGuest {
+				if gotGuestID != "" || rr.Result().Header.Get("Set-Cookie") != "" {
+					t.Errorf("logged in user treated as a guest %q", gotGuestID)
+				}
+				return
+			}
+
+			if tc.wantGuestID != "" && gotGuestID != tc.wantGuestID {
+				t.Errorf("got guest: %q, want: %q", gotGuestID, tc.wantGuestID)
+			}
+			if gotGuestID == "" || (tc.wantGuestID == "" && gotGuestID == returningID) {
+				t.Errorf("unexpected guest id %q", gotGuestID)
+			}
+
+			cookie := rr.Result().Header.Get("Set-Cookie")
+			if !strings.HasPrefix(cookie, guestCookieName+"="+signGuestID(app.guestSecret, gotGuestID)) || !strings.Contains(cookie, "HttpOnly") {
+				t.Errorf("unexpected cookie %q", cookie)
+			}
+		})
+	}
+}
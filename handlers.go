@@ -3,18 +3,24 @@ package main
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/0xhjohnson/clacksy/models"
 	"github.com/0xhjohnson/clacksy/validator"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
 )
 
 const (
@@ -62,7 +68,7 @@ func (app *application) addNewUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.users.Insert(form.Email, form.Password)
+	userID, err := app.users.Insert(form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicateEmail) {
 			form.AddFieldError("email", "Email address is already in use")
@@ -77,11 +83,63 @@ func (app *application) addNewUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+	err = app.sendEmailVerification(userID.String())
+	if err != nil {
+		app.errorLog.Printf("failed to send email verification to %s: %v", userID, err)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Check your email for a link to confirm your address, then log in.")
 
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
+// sendEmailVerification emails userID a link confirming they own their email
+// address, which makes their votes count for more.
+func (app *application) sendEmailVerification(userID string) error {
+	token, email, err := app.users.NewEmailVerification(userID)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Confirm this is your email address for clacksy by opening this link within two days:\n%s/user/verify-email?token=%s\n\nIf you didn't sign up for clacksy you can ignore this email.\n", app.baseURL, token)
+
+	return app.mailer.Send(email, "Confirm your clacksy email address", body)
+}
+
+// resendEmailVerification sends the current user a new verification link.
+func (app *application) resendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	err := app.sendEmailVerification(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "We've emailed you a new link to confirm your address.")
+
+	http.Redirect(w, r, "/user", http.StatusSeeOther)
+}
+
+// verifyEmail confirms the address an emailed link was sent to. The token is
+// all that's needed, so it works without logging in first.
+func (app *application) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	_, err := app.users.VerifyEmail(r.URL.Query().Get("token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "That link has expired or was already used. You can send a new one from your profile.")
+			http.Redirect(w, r, "/user", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your email address is confirmed.")
+
+	http.Redirect(w, r, "/user", http.StatusSeeOther)
+}
+
 type loginForm struct {
 	Email    string
 	Password string
@@ -125,6 +183,12 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 			data := app.newTemplateData(r)
 			data.Form = form
 			app.renderTemplate(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		} else if errors.Is(err, models.ErrSuspended) {
+			form.AddNonFieldError("This account has been suspended")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.renderTemplate(w, http.StatusForbidden, "login.tmpl", data)
 		} else {
 			app.serverError(w, err)
 		}
@@ -140,7 +204,17 @@ func (app *application) loginUser(w http.ResponseWriter, r *http.Request) {
 
 	app.sessionManager.Put(r.Context(), "authenticatedUserID", userID.String())
 
-	http.Redirect(w, r, "/vote", http.StatusSeeOther)
+	if claimed := app.claimGuestPlays(w, r, userID.String()); claimed > 0 {
+		app.sessionManager.Put(r.Context(), "flash", "The sounds you played as a guest are saved to your account")
+	}
+
+	// Someone who had to log in to take a challenge goes back to it.
+	redirect := "/vote"
+	if path := app.sessionManager.PopString(r.Context(), redirectAfterLoginKey); path != "" {
+		redirect = path
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
 }
 
 func (app *application) logoutUser(w http.ResponseWriter, r *http.Request) {
@@ -161,6 +235,7 @@ type soundtestForm struct {
 	Keyswitch      string
 	PlateMaterial  string
 	KeycapMaterial string
+	Attributes     map[string]string
 	Parts          models.AllParts
 	validator.Validator
 }
@@ -180,6 +255,7 @@ func (app *application) addSoundtestForm(w http.ResponseWriter, r *http.Request)
 			Switches:        keebParts.Switches,
 			PlateMaterials:  keebParts.PlateMaterials,
 			KeycapMaterials: keebParts.KeycapMaterials,
+			Attributes:      keebParts.Attributes,
 		},
 	}
 	app.renderTemplate(w, http.StatusOK, "soundtest.tmpl", data)
@@ -275,9 +351,17 @@ func (app *application) addSoundtest(w http.ResponseWriter, r *http.Request) {
 			Switches:        keebParts.Switches,
 			PlateMaterials:  keebParts.PlateMaterials,
 			KeycapMaterials: keebParts.KeycapMaterials,
+			Attributes:      keebParts.Attributes,
 		},
 	}
 
+	attributes, ok := attributeSelections(r.PostForm, keebParts.Attributes)
+	if !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.Attributes = attributes
+
 	form.CheckField(validator.NotBlank(form.Keyboard), "keyboard", "This field cannnot be blank")
 	form.CheckField(validator.NotBlank(form.Keyswitch), "keyswitch", "This field cannnot be blank")
 	form.CheckField(validator.NotBlank(form.PlateMaterial), "plate-material", "This field cannnot be blank")
@@ -305,253 +389,352 @@ func (app *application) addSoundtest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.soundtests.Insert(objKey, form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch, userID)
+	soundtestID, err := app.soundtests.Insert(objKey, form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch, userID, form.Attributes)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	uploader, err := app.users.GetProfileInfo(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	username := uploader.Username
+	if username == "" {
+		username = "anonymous"
+	}
+
+	app.emitWebhook(models.EventSoundTestUploaded, fmt.Sprintf("New soundtest from @%s %s/soundtest/%s", username, app.baseURL, soundtestID), map[string]any{
+		"soundtest_id": soundtestID,
+		"uploader":     username,
+		"url":          app.baseURL + "/soundtest/" + soundtestID.String(),
+		"audio_url":    staticURL + "/" + objKey,
+	})
+
 	app.sessionManager.Put(r.Context(), "flash", "Your soundtest was added successfully")
 
 	http.Redirect(w, r, "/soundtest/new", http.StatusSeeOther)
 }
 
-type votePageData struct {
-	SoundTests []models.SoundTestVote
-	HasMore    bool
-	Page       int
-	PrevPage   int
-	NextPage   int
-}
-
-func (app *application) vote(w http.ResponseWriter, r *http.Request) {
+func (app *application) getUserSoundtests(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-
-	page := r.Context().Value(pageContextKey).(int)
-	perPage := 10
 	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
 
-	soundtests, err := app.soundtests.GetLatest(page, perPage, userID)
+	soundtests, err := app.soundtests.GetByUser(userID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	data.PageData = votePageData{
-		SoundTests: soundtests,
-		HasMore:    len(soundtests) > 0 && soundtests[0].TotalTests > len(soundtests)*(page+1),
-		Page:       page,
-		PrevPage:   page - 1,
-		NextPage:   page + 1,
-	}
+	data.PageData = soundtests
 
-	app.renderTemplate(w, http.StatusOK, "vote.tmpl", data)
+	app.renderTemplate(w, http.StatusOK, "user-soundtests.tmpl", data)
 }
 
-func (app *application) upvote(w http.ResponseWriter, r *http.Request) {
+func (app *application) editSoundtestForm(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-
-	page := r.Context().Value(pageContextKey).(int)
-	perPage := 10
 	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
 	soundtestID := chi.URLParam(r, "soundtestID")
-	prevVote := r.FormValue("previous-vote")
+	if !validator.IsUUID(soundtestID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
 
-	vote := 1
-	if prevVote == "1" {
-		vote = 0
+	soundtest, err := app.soundtests.GetOwned(soundtestID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if soundtest.FeaturedOn != nil {
+		app.sessionManager.Put(r.Context(), "flash", "Soundtests can't be changed once they've been the sound of the day")
+		http.Redirect(w, r, "/user/soundtests", http.StatusSeeOther)
+		return
 	}
 
-	err := app.votes.Upsert(soundtestID, vote, userID)
+	keebParts, err := app.parts.GetAll()
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	soundtests, err := app.soundtests.GetLatest(page, perPage, userID)
+	attributes, err := app.soundtests.GetAttributeIDs(soundtestID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	data.PageData = votePageData{
-		SoundTests: soundtests,
-		HasMore:    true,
-		Page:       page,
-		PrevPage:   page - 1,
-		NextPage:   page + 1,
+	data.Form = soundtestForm{
+		Keyboard:       soundtest.KeyboardID.String(),
+		Keyswitch:      soundtest.KeyswitchID.String(),
+		PlateMaterial:  soundtest.PlateMaterialID.String(),
+		KeycapMaterial: soundtest.KeycapMaterialID.String(),
+		Attributes:     attributes,
+		Parts:          keebParts,
 	}
+	data.PageData = soundtest
 
-	app.renderTemplate(w, http.StatusOK, "vote.tmpl", data)
+	app.renderTemplate(w, http.StatusOK, "soundtest-edit.tmpl", data)
 }
 
-func (app *application) downvote(w http.ResponseWriter, r *http.Request) {
+func (app *application) updateSoundtest(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-
-	page := r.Context().Value(pageContextKey).(int)
-	perPage := 10
 	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
 	soundtestID := chi.URLParam(r, "soundtestID")
-	prevVote := r.FormValue("previous-vote")
+	if !validator.IsUUID(soundtestID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
 
-	vote := -1
-	if prevVote == "-1" {
-		vote = 0
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
 	}
 
-	err := app.votes.Upsert(soundtestID, vote, userID)
+	soundtest, err := app.soundtests.GetOwned(soundtestID, userID)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
 		return
 	}
 
-	soundtests, err := app.soundtests.GetLatest(page, perPage, userID)
+	if soundtest.FeaturedOn != nil {
+		app.sessionManager.Put(r.Context(), "flash", "Soundtests can't be changed once they've been the sound of the day")
+		http.Redirect(w, r, "/user/soundtests", http.StatusSeeOther)
+		return
+	}
+
+	keebParts, err := app.parts.GetAll()
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	data.PageData = votePageData{
-		SoundTests: soundtests,
-		HasMore:    true,
-		Page:       page,
-		PrevPage:   page - 1,
-		NextPage:   page + 1,
+	form := soundtestForm{
+		Keyboard:       r.PostForm.Get("keyboard"),
+		Keyswitch:      r.PostForm.Get("keyswitch"),
+		PlateMaterial:  r.PostForm.Get("plate-material"),
+		KeycapMaterial: r.PostForm.Get("keycap-material"),
+		Parts:          keebParts,
 	}
 
-	app.renderTemplate(w, http.StatusOK, "vote.tmpl", data)
-}
+	attributes, ok := attributeSelections(r.PostForm, keebParts.Attributes)
+	if !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+	form.Attributes = attributes
 
-type dailySound struct {
-	SoundTest      models.SoundTest
-	Parts          models.AllParts
-	Keyboard       string
-	Keyswitch      string
-	PlateMaterial  string
-	KeycapMaterial string
-}
+	form.CheckField(validator.IsUUID(form.Keyboard), "keyboard", "This field cannnot be blank")
+	form.CheckField(validator.IsUUID(form.Keyswitch), "keyswitch", "This field cannnot be blank")
+	form.CheckField(validator.IsUUID(form.PlateMaterial), "plate-material", "This field cannnot be blank")
+	form.CheckField(validator.IsUUID(form.KeycapMaterial), "keycap-material", "This field cannnot be blank")
 
-func (app *application) getDailySound(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
+	if !form.Valid() {
+		data.Form = form
+		data.PageData = soundtest
+		app.renderTemplate(w, http.StatusUnprocessableEntity, "soundtest-edit.tmpl", data)
+		return
+	}
 
-	soundtest, err := app.soundtests.GetDaily()
+	err = app.soundtests.Update(soundtestID, userID, form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch, form.Attributes)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusConflict)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your soundtest was updated successfully")
+
+	http.Redirect(w, r, "/user/soundtests", http.StatusSeeOther)
+}
+
+func (app *application) deleteSoundtest(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	soundtestID := chi.URLParam(r, "soundtestID")
+	if !validator.IsUUID(soundtestID) {
+		app.clientError(w, http.StatusNotFound)
 		return
 	}
-	partOpts, err := app.parts.GetDaily(soundtest.KeyboardID, soundtest.KeyswitchID, soundtest.PlateMaterialID)
+
+	objKey, err := app.soundtests.Delete(soundtestID, userID)
 	if err != nil {
-		app.serverError(w, err)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.sessionManager.Put(r.Context(), "flash", "Soundtests can't be deleted once they've been the sound of the day")
+			http.Redirect(w, r, "/user/soundtests", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
 		return
 	}
 
-	data.PageData = dailySound{
-		SoundTest: soundtest,
-		Parts:     partOpts,
+	_, err = app.s3Client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(os.Getenv("B2_BUCKET")),
+		Key:    aws.String(objKey),
+	})
+	if err != nil {
+		app.errorLog.Printf("failed to delete %s from storage: %v", objKey, err)
 	}
 
-	app.renderTemplate(w, http.StatusOK, "play.tmpl", data)
+	app.sessionManager.Put(r.Context(), "flash", "Your soundtest was deleted")
+
+	http.Redirect(w, r, "/user/soundtests", http.StatusSeeOther)
 }
 
-type dailyPlayForm struct {
-	Keyboard       string
-	Keyswitch      string
-	PlateMaterial  string
-	KeycapMaterial string
+type commentForm struct {
+	Body     string
+	ParentID string
 	validator.Validator
 }
 
-func (app *application) addPlayResult(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
+type commentView struct {
+	*models.Comment
+	Replies   []commentView
+	CanEdit   bool
+	CanDelete bool
+}
 
-	soundtest, err := app.soundtests.GetDaily()
-	if err != nil {
-		app.serverError(w, err)
-		return
+type soundtestPageData struct {
+	SoundTest  models.SoundTestDetail
+	Attributes []models.SoundTestAttribute
+	Comments   []commentView
+	ShowBuild  bool
+}
+
+func newCommentViews(comments []*models.Comment, userID string, isUploader bool) []commentView {
+	views := make([]commentView, 0, len(comments))
+
+	for _, c := range comments {
+		isAuthor := uuidEq(userID, c.CreatedByID)
+
+		views = append(views, commentView{
+			Comment:   c,
+			Replies:   newCommentViews(c.Replies, userID, isUploader),
+			CanEdit:   isAuthor && !c.Deleted,
+			CanDelete: (isAuthor || isUploader) && !c.Deleted,
+		})
 	}
-	partOpts, err := app.parts.GetDaily(soundtest.KeyboardID, soundtest.KeyswitchID, soundtest.PlateMaterialID)
-	if err != nil {
-		app.serverError(w, err)
-		return
+
+	return views
+}
+
+func (app *application) canRevealBuild(st models.SoundTestDetail, userID string, now time.Time) (bool, error) {
+	if uuidEq(userID, st.CreatedByID) {
+		return true, nil
 	}
 
-	data.PageData = dailySound{
-		SoundTest: soundtest,
-		Parts:     partOpts,
+	// It's already been picked for a date that hasn't started here yet.
+	if st.DailyDate != nil && st.DailyDate.After(models.CalendarDate(now)) {
+		return false, nil
 	}
 
-	err = r.ParseForm()
+	daily, err := app.soundtests.GetDaily(now)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
+		if errors.Is(err, pgx.ErrNoRows) {
+			return true, nil
+		}
+		return false, err
 	}
 
-	form := dailyPlayForm{
-		Keyboard:       r.PostForm.Get("keyboard"),
-		Keyswitch:      r.PostForm.Get("keyswitch"),
-		PlateMaterial:  r.PostForm.Get("plate-material"),
-		KeycapMaterial: r.PostForm.Get("keycap-material"),
+	if daily.ID != st.ID {
+		return true, nil
 	}
 
-	form.CheckField(validator.NotBlank(form.Keyboard), "keyboard", "This field cannnot be blank")
-	form.CheckField(validator.NotBlank(form.Keyswitch), "keyswitch", "This field cannnot be blank")
-	form.CheckField(validator.NotBlank(form.PlateMaterial), "plate-material", "This field cannnot be blank")
-	form.CheckField(validator.NotBlank(form.KeycapMaterial), "keycap-material", "This field cannnot be blank")
-
-	data.Form = form
-
-	if !form.Valid() {
-		app.renderTemplate(w, http.StatusUnprocessableEntity, "soundtest.tmpl", data)
-		return
+	if userID == "" {
+		return false, nil
 	}
 
-	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
-
-	err = app.soundtests.AddPlay(soundtest.ID, userID, form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch)
+	_, err = app.soundtests.GetPlay(userID, now)
 	if err != nil {
-		app.serverError(w, err)
-		return
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
 	}
 
-	app.renderTemplate(w, http.StatusOK, "grade.tmpl", data)
+	return true, nil
 }
 
-func (app *application) getGrade(w http.ResponseWriter, r *http.Request) {
+func (app *application) renderSoundtest(w http.ResponseWriter, r *http.Request, statusCode int, soundtestID string, form commentForm) {
 	data := app.newTemplateData(r)
-	playResult := r.Context().Value(userPlayContextKey).(models.SoundTestPlay)
-	data.PageData = playResult
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
 
-	app.renderTemplate(w, http.StatusOK, "grade.tmpl", data)
-}
+	soundtest, err := app.soundtests.Get(soundtestID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
 
-type profileForm struct {
-	Name     string
-	Username string
-	Email    string
-	validator.Validator
-}
+	if soundtest.Hidden && !uuidEq(userID, soundtest.CreatedByID) && !app.access(r).Can(models.PermViewHidden) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
 
-func (app *application) getUserProfile(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
-	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	showBuild, err := app.canRevealBuild(soundtest, userID, app.now(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
 
-	profile, err := app.users.GetProfileInfo(userID)
+	var attributes []models.SoundTestAttribute
+	if showBuild {
+		attributes, err = app.soundtests.GetAttributes(soundtestID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	comments, err := app.comments.GetThreads(soundtestID)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	data.Form = profileForm{
-		Name:     profile.Name,
-		Username: profile.Username,
-		Email:    profile.Email,
+	data.Form = form
+	data.PageData = soundtestPageData{
+		SoundTest:  soundtest,
+		Attributes: attributes,
+		Comments:   newCommentViews(comments, userID, uuidEq(userID, soundtest.CreatedByID)),
+		ShowBuild:  showBuild,
+	}
+
+	app.renderTemplate(w, statusCode, "soundtest-detail.tmpl", data)
+}
+
+func (app *application) getSoundtest(w http.ResponseWriter, r *http.Request) {
+	soundtestID := chi.URLParam(r, "soundtestID")
+	if !validator.IsUUID(soundtestID) {
+		app.clientError(w, http.StatusNotFound)
+		return
 	}
 
-	app.renderTemplate(w, http.StatusOK, "profile.tmpl", data)
+	app.renderSoundtest(w, r, http.StatusOK, soundtestID, commentForm{})
 }
 
-func (app *application) updateUserProfile(w http.ResponseWriter, r *http.Request) {
-	data := app.newTemplateData(r)
+func (app *application) addComment(w http.ResponseWriter, r *http.Request) {
+	soundtestID := chi.URLParam(r, "soundtestID")
+	if !validator.IsUUID(soundtestID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
 
 	err := r.ParseForm()
 	if err != nil {
@@ -559,51 +742,2812 @@ func (app *application) updateUserProfile(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	form := profileForm{
-		Name:     r.PostForm.Get("name"),
-		Username: r.PostForm.Get("username"),
-		Email:    r.PostForm.Get("email"),
+	form := commentForm{
+		Body:     strings.TrimSpace(r.PostForm.Get("body")),
+		ParentID: r.PostForm.Get("parent-id"),
 	}
 
-	form.CheckField(validator.MinChars(form.Username, 3), "username", "This field must be at least 3 characters.")
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannnot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Body), "body", "This field cannnot be blank")
+	form.CheckField(validator.MaxChars(form.Body, 2000), "body", "This field cannot be more than 2000 characters long")
 
-	data.Form = form
+	if form.ParentID != "" && !validator.IsUUID(form.ParentID) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
 
 	if !form.Valid() {
-		app.renderTemplate(w, http.StatusUnprocessableEntity, "profile.tmpl", data)
+		app.renderSoundtest(w, r, http.StatusUnprocessableEntity, soundtestID, form)
 		return
 	}
 
 	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
 
-	err = app.users.UpdateProfile(userID, form.Email, form.Name, form.Username)
+	commentID, err := app.comments.Insert(soundtestID, form.ParentID, form.Body, userID)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateUsername) {
-			form.AddFieldError("username", "Username is already in use")
-
-			data := app.newTemplateData(r)
-			data.Form = form
-			app.renderTemplate(w, http.StatusUnprocessableEntity, "profile.tmpl", data)
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusBadRequest)
 		} else {
 			app.serverError(w, err)
 		}
-
 		return
 	}
 
-	profile, err := app.users.GetProfileInfo(userID)
+	err = app.notifications.NotifyComment(commentID)
 	if err != nil {
-		app.serverError(w, err)
-		return
+		app.errorLog.Printf("failed to notify about comment %s: %v", commentID, err)
 	}
 
-	data.Form = profileForm{
-		Name:     profile.Name,
-		Username: profile.Username,
-		Email:    profile.Email,
+	app.sessionManager.Put(r.Context(), "flash", "Your comment was added")
+
+	http.Redirect(w, r, "/soundtest/"+soundtestID+"#comments", http.StatusSeeOther)
+}
+
+func (app *application) updateComment(w http.ResponseWriter, r *http.Request) {
+	soundtestID := chi.URLParam(r, "soundtestID")
+	commentID := chi.URLParam(r, "commentID")
+	if !validator.IsUUID(soundtestID) || !validator.IsUUID(commentID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := commentForm{
+		Body: strings.TrimSpace(r.PostForm.Get("body")),
+	}
+
+	form.CheckField(validator.NotBlank(form.Body), "body", "This field cannnot be blank")
+	form.CheckField(validator.MaxChars(form.Body, 2000), "body", "This field cannot be more than 2000 characters long")
+
+	if !form.Valid() {
+		form.AddNonFieldError("Your comment was not updated: " + form.FieldErrors["body"])
+		app.renderSoundtest(w, r, http.StatusUnprocessableEntity, soundtestID, form)
+		return
+	}
+
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	err = app.comments.Update(commentID, form.Body, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusForbidden)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your comment was updated")
+
+	http.Redirect(w, r, "/soundtest/"+soundtestID+"#comment-"+commentID, http.StatusSeeOther)
+}
+
+func (app *application) deleteComment(w http.ResponseWriter, r *http.Request) {
+	soundtestID := chi.URLParam(r, "soundtestID")
+	commentID := chi.URLParam(r, "commentID")
+	if !validator.IsUUID(soundtestID) || !validator.IsUUID(commentID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	err := app.comments.Delete(commentID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusForbidden)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "The comment was deleted")
+
+	http.Redirect(w, r, "/soundtest/"+soundtestID+"#comments", http.StatusSeeOther)
+}
+
+type browseForm struct {
+	models.SoundTestFilter
+	Parts models.AllParts
+	validator.Validator
+}
+
+type browsePageData struct {
+	SoundTests []models.SoundTestVote
+	models.PageInfo
+	PrevQuery string
+	NextQuery string
+}
+
+func (app *application) browseSoundtests(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	page := r.Context().Value(pageContextKey).(models.PageRequest)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	query := r.URL.Query()
+
+	form := browseForm{
+		SoundTestFilter: models.SoundTestFilter{
+			Keyboard:       query.Get("keyboard"),
+			Keyswitch:      query.Get("keyswitch"),
+			KeyswitchType:  query.Get("keyswitch-type"),
+			PlateMaterial:  query.Get("plate-material"),
+			KeycapMaterial: query.Get("keycap-material"),
+			Uploader:       strings.TrimPrefix(strings.TrimSpace(query.Get("uploader")), "@"),
+			Query:          strings.TrimSpace(query.Get("q")),
+			Sort:           query.Get("sort"),
+		},
+	}
+
+	for key, value := range map[string]string{
+		"keyboard":        form.Keyboard,
+		"keyswitch":       form.Keyswitch,
+		"keyswitch-type":  form.KeyswitchType,
+		"plate-material":  form.PlateMaterial,
+		"keycap-material": form.KeycapMaterial,
+	} {
+		form.CheckField(value == "" || validator.IsUUID(value), key, "This field must be a valid selection")
+	}
+	form.CheckField(validator.PermittedValue(form.Sort, "", models.SortNewest, models.SortHot, models.SortTop, models.SortRising, models.SortControversial), "sort", "This field must be a valid sort order")
+	form.CheckField(validator.MaxChars(form.Query, 100), "q", "This field cannot be more than 100 characters long")
+
+	keebParts, err := app.parts.GetAll()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	form.Parts = keebParts
+
+	data.Form = form
+
+	if !form.Valid() {
+		data.PageData = browsePageData{}
+		app.renderTemplate(w, http.StatusUnprocessableEntity, "browse.tmpl", data)
+		return
+	}
+
+	soundtests, pageInfo, err := app.soundtests.Search(form.SoundTestFilter, page, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.PageData = browsePageData{
+		SoundTests: soundtests,
+		PageInfo:   pageInfo,
+		PrevQuery:  cursorQuery(query, "before", pageInfo.PrevCursor),
+		NextQuery:  cursorQuery(query, "after", pageInfo.NextCursor),
+	}
+
+	app.renderTemplate(w, http.StatusOK, "browse.tmpl", data)
+}
+
+type votePageData struct {
+	SoundTests []models.SoundTestVote
+	Ranking    string
+	Rankings   []string
+	models.PageInfo
+	PrevQuery string
+	NextQuery string
+}
+
+func (app *application) renderVoteFeed(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	page := r.Context().Value(pageContextKey).(models.PageRequest)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	query := r.URL.Query()
+
+	ranking := query.Get("sort")
+	if ranking == "" {
+		ranking = models.SortHot
+	}
+	if !validator.PermittedValue(ranking, models.Rankings...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	soundtests, pageInfo, err := app.soundtests.GetFeed(ranking, page, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.PageData = votePageData{
+		SoundTests: soundtests,
+		Ranking:    ranking,
+		Rankings:   models.Rankings,
+		PageInfo:   pageInfo,
+		PrevQuery:  cursorQuery(query, "before", pageInfo.PrevCursor),
+		NextQuery:  cursorQuery(query, "after", pageInfo.NextCursor),
+	}
+
+	app.renderTemplate(w, http.StatusOK, "vote.tmpl", data)
+}
+
+func (app *application) vote(w http.ResponseWriter, r *http.Request) {
+	app.renderVoteFeed(w, r)
+}
+
+func (app *application) upvote(w http.ResponseWriter, r *http.Request) {
+	app.castVote(w, r, 1)
+}
+
+func (app *application) downvote(w http.ResponseWriter, r *http.Request) {
+	app.castVote(w, r, -1)
+}
+
+// castVote records voteType for the current user, or clears their vote when
+// they repeat the vote they already made. htmx requests get the updated
+// vote-group fragment back; plain form posts are sent back where they came from.
+// Soundtests that don't exist or are hidden from the voter aren't found.
+func (app *application) castVote(w http.ResponseWriter, r *http.Request, voteType int) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	soundtestID := chi.URLParam(r, "soundtestID")
+	if !validator.IsUUID(soundtestID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	soundtest, err := app.soundtests.Get(soundtestID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if soundtest.Hidden && !uuidEq(userID, soundtest.CreatedByID) && !app.access(r).Can(models.PermViewHidden) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	prevVote := r.FormValue("previous-vote")
+
+	vote := voteType
+	if prevVote == strconv.Itoa(voteType) {
+		vote = 0
+	}
+
+	trust, err := app.users.GetTrust(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.votes.Upsert(soundtestID, vote, trust.Weight(time.Now()), userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if vote == 1 {
+		err = app.notifications.NotifyVoteMilestones(soundtestID)
+		if err != nil {
+			app.errorLog.Printf("failed to notify about votes on %s: %v", soundtestID, err)
+		}
+	}
+
+	if !isHTMX(r) {
+		http.Redirect(w, r, localRedirect(refererPath(r), "/vote"), http.StatusSeeOther)
+		return
+	}
+
+	updated, err := app.soundtests.GetVote(soundtestID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.renderPartial(w, http.StatusOK, "vote.tmpl", "vote-group", app.location(r), updated)
+}
+
+const (
+	// newAccountAge is how recently an account must have been created for
+	// its votes to show up in the vote report.
+	newAccountAge  = 7 * 24 * time.Hour
+	minRingMembers = 3
+	minRingVotes   = 2
+	minReportVotes = 3
+)
+
+type voteReportData struct {
+	Since      time.Time
+	Rings      []models.VoteRing
+	SoundTests []models.SuspiciousSoundTest
+}
+
+func (app *application) voteReport(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	since := time.Now().Add(-newAccountAge)
+
+	votes, err := app.votes.GetNewAccountVotes(since)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	soundtests, err := app.votes.GetSuspicious(since, minReportVotes)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.PageData = voteReportData{
+		Since:      since,
+		Rings:      models.DetectVoteRings(votes, minRingMembers, minRingVotes),
+		SoundTests: soundtests,
+	}
+
+	app.renderTemplate(w, http.StatusOK, "admin-votes.tmpl", data)
+}
+
+type reportForm struct {
+	SubjectType string
+	SubjectID   string
+	Reason      string
+	Details     string
+	Return      string
+	Reasons     []string
+	validator.Validator
+}
+
+func (app *application) reportSubjectForm(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	query := r.URL.Query()
+
+	form := reportForm{
+		SubjectType: query.Get("type"),
+		SubjectID:   query.Get("id"),
+		Return:      localRedirect(refererPath(r), "/"),
+		Reasons:     models.ReportReasons,
+	}
+
+	if !validator.PermittedValue(form.SubjectType, models.SubjectSoundTest, models.SubjectComment, models.SubjectUser) || !validator.IsUUID(form.SubjectID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	data.Form = form
+	app.renderTemplate(w, http.StatusOK, "report.tmpl", data)
+}
+
+func (app *application) reportSubject(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := reportForm{
+		SubjectType: r.PostForm.Get("type"),
+		SubjectID:   r.PostForm.Get("id"),
+		Reason:      r.PostForm.Get("reason"),
+		Details:     strings.TrimSpace(r.PostForm.Get("details")),
+		Return:      localRedirect(r.PostForm.Get("return"), "/"),
+		Reasons:     models.ReportReasons,
+	}
+
+	if !validator.PermittedValue(form.SubjectType, models.SubjectSoundTest, models.SubjectComment, models.SubjectUser) || !validator.IsUUID(form.SubjectID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.Reason, models.ReportReasons...), "reason", "This field must be a valid reason")
+	form.CheckField(validator.MaxChars(form.Details, 1000), "details", "This field cannot be more than 1000 characters long")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.renderTemplate(w, http.StatusUnprocessableEntity, "report.tmpl", data)
+		return
+	}
+
+	err = app.moderation.Report(form.SubjectType, form.SubjectID, form.Reason, form.Details, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks for the report, a moderator will take a look")
+
+	http.Redirect(w, r, form.Return, http.StatusSeeOther)
+}
+
+func (app *application) getReports(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	reports, err := app.moderation.GetOpen()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.PageData = reports
+
+	app.renderTemplate(w, http.StatusOK, "admin-reports.tmpl", data)
+}
+
+type moderationForm struct {
+	Action string
+	Note   string
+	soundtestForm
+}
+
+type reportPageData struct {
+	Report  models.Report
+	Actions []string
+}
+
+func (app *application) renderReport(w http.ResponseWriter, r *http.Request, statusCode int, report models.Report, form moderationForm) {
+	data := app.newTemplateData(r)
+
+	if report.SubjectType == models.SubjectSoundTest && report.OwnerID != nil && form.Parts.Keyboards == nil {
+		keebParts, err := app.parts.GetAll()
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		// Corrections only cover the parts players guess.
+		keebParts.Attributes = nil
+		form.Parts = keebParts
+
+		if form.Keyboard == "" {
+			soundtest, err := app.soundtests.GetOwned(report.SubjectID.String(), report.OwnerID.String())
+			if err != nil && !errors.Is(err, models.ErrNoRecord) {
+				app.serverError(w, err)
+				return
+			}
+			form.Keyboard = soundtest.KeyboardID.String()
+			form.Keyswitch = soundtest.KeyswitchID.String()
+			form.PlateMaterial = soundtest.PlateMaterialID.String()
+			form.KeycapMaterial = soundtest.KeycapMaterialID.String()
+		}
+	}
+
+	data.Form = form
+	data.PageData = reportPageData{
+		Report:  report,
+		Actions: models.Actions[report.SubjectType],
+	}
+
+	app.renderTemplate(w, statusCode, "admin-report.tmpl", data)
+}
+
+// openReport loads the report named in the URL, responding with a 404 if it
+// doesn't exist or has already been resolved.
+func (app *application) openReport(w http.ResponseWriter, r *http.Request) (models.Report, bool) {
+	reportID := chi.URLParam(r, "reportID")
+	if !validator.IsUUID(reportID) {
+		app.clientError(w, http.StatusNotFound)
+		return models.Report{}, false
+	}
+
+	report, err := app.moderation.GetOpenReport(reportID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return report, false
+	}
+
+	return report, true
+}
+
+func (app *application) getReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := app.openReport(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderReport(w, r, http.StatusOK, report, moderationForm{})
+}
+
+func (app *application) moderateReport(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	report, ok := app.openReport(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := moderationForm{
+		Action: r.PostForm.Get("action"),
+		Note:   strings.TrimSpace(r.PostForm.Get("note")),
+	}
+
+	if !models.CanModerate(report.SubjectType, form.Action) || form.Action == models.ActionCorrect {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if form.Action == models.ActionWarn {
+		form.CheckField(validator.NotBlank(form.Note), "note", "A warning needs a message for the user")
+	}
+	form.CheckField(validator.MaxChars(form.Note, 1000), "note", "This field cannot be more than 1000 characters long")
+
+	if !form.Valid() {
+		app.renderReport(w, r, http.StatusUnprocessableEntity, report, form)
+		return
+	}
+
+	objKey, err := app.moderation.Moderate(report.ID.String(), form.Action, userID, form.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrFeatured):
+			form.AddNonFieldError("Soundtests that have been the sound of the day can't be deleted, hide it instead")
+			app.renderReport(w, r, http.StatusConflict, report, form)
+		case errors.Is(err, models.ErrNoRecord):
+			app.clientError(w, http.StatusConflict)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if objKey != "" {
+		_, err = app.s3Client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(os.Getenv("B2_BUCKET")),
+			Key:    aws.String(objKey),
+		})
+		if err != nil {
+			app.errorLog.Printf("failed to delete %s from storage: %v", objKey, err)
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Report resolved")
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
+
+func (app *application) correctReportedParts(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	report, ok := app.openReport(w, r)
+	if !ok {
+		return
+	}
+
+	if report.SubjectType != models.SubjectSoundTest {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := moderationForm{
+		Action: models.ActionCorrect,
+		Note:   strings.TrimSpace(r.PostForm.Get("note")),
+		soundtestForm: soundtestForm{
+			Keyboard:       r.PostForm.Get("keyboard"),
+			Keyswitch:      r.PostForm.Get("keyswitch"),
+			PlateMaterial:  r.PostForm.Get("plate-material"),
+			KeycapMaterial: r.PostForm.Get("keycap-material"),
+		},
+	}
+
+	form.CheckField(validator.IsUUID(form.Keyboard), "keyboard", "This field cannnot be blank")
+	form.CheckField(validator.IsUUID(form.Keyswitch), "keyswitch", "This field cannnot be blank")
+	form.CheckField(validator.IsUUID(form.PlateMaterial), "plate-material", "This field cannnot be blank")
+	form.CheckField(validator.IsUUID(form.KeycapMaterial), "keycap-material", "This field cannnot be blank")
+	form.CheckField(validator.MaxChars(form.Note, 1000), "note", "This field cannot be more than 1000 characters long")
+
+	if !form.Valid() {
+		app.renderReport(w, r, http.StatusUnprocessableEntity, report, form)
+		return
+	}
+
+	err = app.moderation.CorrectParts(report.ID.String(), userID, form.Note, form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusConflict)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Parts corrected and report resolved")
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
+
+func (app *application) getModerationLog(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	entries, err := app.moderation.GetLog(200)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.PageData = entries
+
+	app.renderTemplate(w, http.StatusOK, "admin-log.tmpl", data)
+}
+
+type rolesPageData struct {
+	Query   string
+	Staff   []models.StaffMember
+	Results []models.StaffMember
+	Roles   []string
+}
+
+func (app *application) getRoles(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	pageData := rolesPageData{
+		Query: strings.TrimSpace(r.URL.Query().Get("q")),
+		Roles: models.Roles,
+	}
+
+	var err error
+
+	pageData.Staff, err = app.users.GetStaff()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if pageData.Query != "" {
+		pageData.Results, err = app.users.FindByHandle(pageData.Query)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	data.PageData = pageData
+
+	app.renderTemplate(w, http.StatusOK, "admin-roles.tmpl", data)
+}
+
+func (app *application) setUserRole(w http.ResponseWriter, r *http.Request) {
+	adminID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	userID := chi.URLParam(r, "userID")
+	if !validator.IsUUID(userID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	role := r.PostForm.Get("role")
+	if !models.ValidRole(role) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// Changing your own role could leave nobody able to assign roles.
+	if userID == adminID {
+		app.sessionManager.Put(r.Context(), "flash", "You can't change your own role")
+		http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+		return
+	}
+
+	err = app.users.SetRole(userID, role, adminID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Role updated")
+
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
+
+type dailySound struct {
+	SoundTest      models.SoundTest
+	Parts          models.AllParts
+	Guest          bool
+	Mode           string
+	Switches       map[string]bool
+	Catalog        models.Catalog
+	Attempts       []models.Attempt
+	AttemptsLeft   int
+	Hints          models.Hints
+	Keyboard       string
+	Keyswitch      string
+	PlateMaterial  string
+	KeycapMaterial string
+	Attributes     map[string]string
+}
+
+// dailyModeKey is the session key holding the day's sound and the mode a
+// guest was last shown it in, separated by a space. The modes players have
+// seen are kept in the database instead, so they follow them to other
+// browsers.
+const dailyModeKey = "dailyMode"
+
+// loadDailySound gets the sound of the day for the date it is at now with
+// what's needed to play it in mode, the whole catalog in hard mode or the
+// day's options otherwise. seen is the dailyModeKey session value. Once the
+// sound has been shown in a mode it can only be played in modes that show as
+// much, and once userID has made an attempt in hints mode they keep playing
+// in it. Guests, with an empty userID, can't play in hints mode.
+func (app *application) loadDailySound(mode, seen, userID string, now time.Time) (dailySound, error) {
+	daily := dailySound{Guest: userID == ""}
+
+	soundtest, err := app.soundtests.GetDaily(now)
+	if err != nil {
+		return daily, err
+	}
+	daily.SoundTest = soundtest
+
+	if !daily.Guest {
+		daily.Attempts, err = app.soundtests.GetAttempts(soundtest.ID, userID)
+		if err != nil {
+			return daily, err
+		}
+	}
+
+	var seenMode string
+	if id, m, ok := strings.Cut(seen, " "); ok && id == soundtest.ID.String() {
+		seenMode = m
+	}
+	if !daily.Guest {
+		// Players' modes are kept in the database, but what they saw as a
+		// guest before logging in still counts.
+		m, err := app.soundtests.GetSeenMode(soundtest.ID, userID)
+		if err != nil {
+			return daily, err
+		}
+		if m != "" && (seenMode == "" || models.CanSwitchMode(seenMode, m)) {
+			seenMode = m
+		}
+	}
+
+	allowed := func(m string) bool {
+		if !validator.PermittedValue(m, models.PlayModes...) || (daily.Guest && m == models.PlayModeHints) {
+			return false
+		}
+		if len(daily.Attempts) > 0 {
+			return m == models.PlayModeHints
+		}
+		return seenMode == "" || models.CanSwitchMode(seenMode, m)
+	}
+
+	if !allowed(mode) {
+		mode = models.PlayModeClassic
+		if len(daily.Attempts) > 0 {
+			mode = models.PlayModeHints
+		} else if seenMode != "" && allowed(seenMode) {
+			mode = seenMode
+		}
+	}
+	daily.Mode = mode
+
+	daily.Switches = map[string]bool{}
+	for _, m := range models.PlayModes {
+		daily.Switches[m] = m != mode && allowed(m)
+	}
+
+	if mode == models.PlayModeHard {
+		daily.Catalog, err = app.parts.GetCatalog()
+	} else {
+		daily.Parts, err = app.parts.GetDaily(soundtest)
+	}
+	if err != nil {
+		return daily, err
+	}
+
+	if mode == models.PlayModeHints {
+		hints, err := app.soundtests.GetHints(soundtest.ID)
+		if err != nil {
+			return daily, err
+		}
+		daily.Hints = hints.Reveal(len(daily.Attempts))
+		daily.AttemptsLeft = models.MaxAttempts - len(daily.Attempts)
+	}
+
+	daily.Parts.Attributes, err = app.parts.GetBonusRounds(soundtest.ID)
+	if err != nil {
+		return daily, err
+	}
+
+	return daily, nil
+}
+
+func (app *application) getDailySound(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	daily, err := app.loadDailySound(r.URL.Query().Get("mode"), app.sessionManager.GetString(r.Context(), dailyModeKey), userID, app.now(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if daily.Guest {
+		app.sessionManager.Put(r.Context(), dailyModeKey, daily.SoundTest.ID.String()+" "+daily.Mode)
+	} else {
+		err = app.soundtests.SetSeenMode(daily.SoundTest.ID, userID, daily.Mode)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	data.Form = dailyPlayForm{}
+	data.PageData = daily
+
+	app.renderTemplate(w, http.StatusOK, "play.tmpl", data)
+}
+
+// getDailyClip serves the opening seconds of the day's sound, all that hints
+// mode plays until the whole soundtest is unlocked.
+func (app *application) getDailyClip(w http.ResponseWriter, r *http.Request) {
+	soundtest, err := app.soundtests.GetDaily(app.now(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	clip, err := app.clips.get(soundtest.ID, func() ([]byte, error) {
+		return cutClip(staticURL + "/" + soundtest.URL)
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/aac")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, "", soundtest.LastUpdated, bytes.NewReader(clip))
+}
+
+type dailyPlayForm struct {
+	Keyboard       string
+	Keyswitch      string
+	PlateMaterial  string
+	KeycapMaterial string
+	validator.Validator
+}
+
+// matchGuesses resolves a hard mode form's typed guesses to part IDs,
+// replacing each guess with the ID it matched. Guesses that don't match
+// anything become field errors.
+func (form *dailyPlayForm) matchGuesses(catalog models.Catalog) {
+	guesses := []struct {
+		guess   *string
+		key     string
+		entries []models.CatalogEntry
+	}{
+		{&form.Keyboard, "keyboard", catalog.Keyboards},
+		{&form.Keyswitch, "keyswitch", catalog.Switches},
+		{&form.PlateMaterial, "plate-material", catalog.PlateMaterials},
+		{&form.KeycapMaterial, "keycap-material", catalog.KeycapMaterials},
+	}
+
+	for _, g := range guesses {
+		if !validator.NotBlank(*g.guess) {
+			continue
+		}
+
+		entry, ok := models.MatchPart(*g.guess, g.entries)
+		if !ok {
+			form.AddFieldError(g.key, "We don't know that one, pick one of the suggestions")
+			continue
+		}
+		*g.guess = entry.ID.String()
+	}
+}
+
+func (app *application) addPlayResult(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	mode := r.PostForm.Get("mode")
+	if mode == "" {
+		mode = models.PlayModeClassic
+	}
+
+	daily, err := app.loadDailySound(mode, app.sessionManager.GetString(r.Context(), dailyModeKey), userID, app.now(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// The form was for a mode that isn't allowed any more, like hard mode
+	// after the options were shown in another tab.
+	if daily.Mode != mode {
+		app.sessionManager.Put(r.Context(), "flash", "You've already seen today's sound in "+daily.Mode+" mode, so that's how you play it")
+		http.Redirect(w, r, "/play", http.StatusSeeOther)
+		return
+	}
+
+	form := dailyPlayForm{
+		Keyboard:       strings.TrimSpace(r.PostForm.Get("keyboard")),
+		Keyswitch:      strings.TrimSpace(r.PostForm.Get("keyswitch")),
+		PlateMaterial:  strings.TrimSpace(r.PostForm.Get("plate-material")),
+		KeycapMaterial: strings.TrimSpace(r.PostForm.Get("keycap-material")),
+	}
+
+	attributes, ok := attributeSelections(r.PostForm, daily.Parts.Attributes)
+	if !ok {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Keyboard), "keyboard", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.Keyswitch), "keyswitch", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.PlateMaterial), "plate-material", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.KeycapMaterial), "keycap-material", "This field cannnot be blank")
+
+	// Typed guesses are shown back as typed if the form has to be fixed.
+	daily.Keyboard = form.Keyboard
+	daily.Keyswitch = form.Keyswitch
+	daily.PlateMaterial = form.PlateMaterial
+	daily.KeycapMaterial = form.KeycapMaterial
+	daily.Attributes = attributes
+
+	if daily.Mode == models.PlayModeHard {
+		form.matchGuesses(daily.Catalog)
+	} else if (form.Keyboard != "" && !daily.Parts.HasKeyboard(form.Keyboard)) ||
+		(form.Keyswitch != "" && !daily.Parts.HasSwitch(form.Keyswitch)) ||
+		(form.PlateMaterial != "" && !daily.Parts.HasPlateMaterial(form.PlateMaterial)) ||
+		(form.KeycapMaterial != "" && !daily.Parts.HasKeycapMaterial(form.KeycapMaterial)) {
+		// Only the offered options can be submitted, anything else means the
+		// form was tampered with.
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	data.Form = form
+	data.PageData = daily
+
+	if !form.Valid() {
+		app.renderTemplate(w, http.StatusUnprocessableEntity, "play.tmpl", data)
+		return
+	}
+
+	if daily.Mode == models.PlayModeHints {
+		_, finished, err := app.soundtests.AddAttempt(daily.SoundTest.ID, userID, form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch, attributes)
+		if err != nil {
+			if errors.Is(err, models.ErrPlayOver) {
+				http.Redirect(w, r, "/play/grade", http.StatusSeeOther)
+			} else if errors.Is(err, models.ErrDuplicateAttempt) {
+				app.clientError(w, http.StatusConflict)
+			} else {
+				app.serverError(w, err)
+			}
+			return
+		}
+
+		if !finished {
+			app.sessionManager.Put(r.Context(), "flash", "Not quite, here's a hint")
+			http.Redirect(w, r, "/play?mode=hints", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, "/play/grade", http.StatusSeeOther)
+		return
+	}
+
+	if daily.Guest {
+		err = app.soundtests.AddGuestPlay(daily.SoundTest.ID, app.guestID(r), form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch, daily.Mode, attributes)
+	} else {
+		err = app.soundtests.AddPlay(daily.SoundTest.ID, userID, form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch, daily.Mode, attributes)
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/play/grade", http.StatusSeeOther)
+}
+
+func (app *application) getGrade(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	playResult := r.Context().Value(userPlayContextKey).(models.SoundTestPlay)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	var bonusRounds []models.PlayAttribute
+	var err error
+	if guestID := app.guestID(r); guestID != "" {
+		bonusRounds, err = app.soundtests.GetGuestPlayAttributes(playResult.SoundTestID, guestID)
+	} else {
+		bonusRounds, err = app.soundtests.GetPlayAttributes(playResult.SoundTestID, userID)
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	playResult.BonusRounds = bonusRounds
+
+	if playResult.Mode == models.PlayModeHints {
+		playResult.History, err = app.soundtests.GetAttempts(playResult.SoundTestID, userID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	data.PageData = playResult
+
+	app.renderTemplate(w, http.StatusOK, "grade.tmpl", data)
+}
+
+// Session keys for practice mode, the soundtest being practiced with and the
+// running score.
+const (
+	practiceSoundTestKey = "practiceSoundTestID"
+	practiceSoundsKey    = "practiceSounds"
+	practiceCorrectKey   = "practiceCorrect"
+)
+
+type practiceForm struct {
+	Keyboard       string
+	Keyswitch      string
+	PlateMaterial  string
+	KeycapMaterial string
+	Parts          models.AllParts
+	validator.Validator
+}
+
+type practiceData struct {
+	SoundTest models.SoundTest
+	Result    *models.SoundTestPlay
+	Sounds    int
+	Correct   int
+	Done      bool
+}
+
+// Possible is how many parts could have been right this session.
+func (d practiceData) Possible() int {
+	return d.Sounds * models.PartsPerPlay
+}
+
+func (app *application) newPracticeData(r *http.Request) practiceData {
+	return practiceData{
+		Sounds:  app.sessionManager.GetInt(r.Context(), practiceSoundsKey),
+		Correct: app.sessionManager.GetInt(r.Context(), practiceCorrectKey),
+	}
+}
+
+// practiceSound gets the soundtest userID is practicing with, picking a new
+// one if they've finished the last.
+func (app *application) practiceSound(r *http.Request, userID string) (models.SoundTest, error) {
+	if id := app.sessionManager.GetString(r.Context(), practiceSoundTestKey); id != "" {
+		st, err := app.soundtests.GetPracticeSound(id, userID)
+		if !errors.Is(err, models.ErrNoRecord) {
+			return st, err
+		}
+	}
+
+	st, err := app.soundtests.NextPracticeSound(userID)
+	if err != nil {
+		return st, err
+	}
+	app.sessionManager.Put(r.Context(), practiceSoundTestKey, st.ID.String())
+
+	return st, nil
+}
+
+func (app *application) getPractice(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	pageData := app.newPracticeData(r)
+
+	soundtest, err := app.practiceSound(r, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			pageData.Done = true
+			data.Form = practiceForm{}
+			data.PageData = pageData
+			app.renderTemplate(w, http.StatusOK, "practice.tmpl", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	pageData.SoundTest = soundtest
+
+	parts, err := app.parts.GetDaily(soundtest)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Form = practiceForm{Parts: parts}
+	data.PageData = pageData
+
+	app.renderTemplate(w, http.StatusOK, "practice.tmpl", data)
+}
+
+func (app *application) addPracticePlay(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// A resubmitted form, once the soundtest it was for has been played, or
+	// a soundtest that's since gone just moves on to the next one.
+	id := app.sessionManager.GetString(r.Context(), practiceSoundTestKey)
+	if id == "" {
+		http.Redirect(w, r, "/practice", http.StatusSeeOther)
+		return
+	}
+
+	soundtest, err := app.soundtests.GetPracticeSound(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/practice", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	parts, err := app.parts.GetDaily(soundtest)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	form := practiceForm{
+		Keyboard:       r.PostForm.Get("keyboard"),
+		Keyswitch:      r.PostForm.Get("keyswitch"),
+		PlateMaterial:  r.PostForm.Get("plate-material"),
+		KeycapMaterial: r.PostForm.Get("keycap-material"),
+		Parts:          parts,
+	}
+
+	form.CheckField(validator.NotBlank(form.Keyboard), "keyboard", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.Keyswitch), "keyswitch", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.PlateMaterial), "plate-material", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.KeycapMaterial), "keycap-material", "This field cannnot be blank")
+
+	if (form.Keyboard != "" && !parts.HasKeyboard(form.Keyboard)) ||
+		(form.Keyswitch != "" && !parts.HasSwitch(form.Keyswitch)) ||
+		(form.PlateMaterial != "" && !parts.HasPlateMaterial(form.PlateMaterial)) ||
+		(form.KeycapMaterial != "" && !parts.HasKeycapMaterial(form.KeycapMaterial)) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !form.Valid() {
+		pageData := app.newPracticeData(r)
+		pageData.SoundTest = soundtest
+
+		data.Form = form
+		data.PageData = pageData
+		app.renderTemplate(w, http.StatusUnprocessableEntity, "practice.tmpl", data)
+		return
+	}
+
+	play, err := app.soundtests.AddPracticePlay(soundtest.ID, userID, form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch)
+	if err != nil {
+		if errors.Is(err, models.ErrPlayOver) {
+			http.Redirect(w, r, "/practice", http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	pageData := app.newPracticeData(r)
+	pageData.SoundTest = soundtest
+	pageData.Result = &play
+	pageData.Sounds++
+	pageData.Correct += play.Correct()
+
+	app.sessionManager.Remove(r.Context(), practiceSoundTestKey)
+	app.sessionManager.Put(r.Context(), practiceSoundsKey, pageData.Sounds)
+	app.sessionManager.Put(r.Context(), practiceCorrectKey, pageData.Correct)
+
+	data.Form = practiceForm{}
+	data.PageData = pageData
+
+	app.renderTemplate(w, http.StatusOK, "practice.tmpl", data)
+}
+
+type roomJoinForm struct {
+	Code string
+	Name string
+	validator.Validator
+}
+
+// roomPage is what the room page needs to follow the room's event stream.
+type roomPage struct {
+	Code     string
+	PlayerID string
+	IsHost   bool
+}
+
+// roomTokenCookieName is the cookie holding the player's token for a room's
+// event stream, scoped to that stream's path.
+const roomTokenCookieName = "room_token"
+
+// roomPlayerKey is the session key holding the player's token for a room.
+func roomPlayerKey(code string) string {
+	return "roomPlayer:" + code
+}
+
+func (app *application) getRooms(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = roomJoinForm{Code: strings.ToUpper(r.URL.Query().Get("code"))}
+	app.renderTemplate(w, http.StatusOK, "rooms.tmpl", data)
+}
+
+func (app *application) createRoom(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	profile, err := app.users.GetProfileInfo(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	hostName := profile.Username
+	if hostName == "" {
+		hostName = "Host"
+	}
+
+	soundtests, err := app.soundtests.GetPartySounds(roomRounds)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if len(soundtests) == 0 {
+		app.sessionManager.Put(r.Context(), "flash", "There aren't any soundtests to play yet")
+		http.Redirect(w, r, "/rooms", http.StatusSeeOther)
+		return
+	}
+
+	var rounds []roomRound
+	for _, st := range soundtests {
+		parts, err := app.parts.GetDaily(st)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		rounds = append(rounds, roomRound{SoundTest: st, Parts: parts})
+	}
+
+	rm, host, err := app.rooms.create(userID, hostName, rounds)
+	if err != nil {
+		switch {
+		case errors.Is(err, errRoomHostLimit):
+			app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You can only host %d rooms at once", roomMaxHosted))
+			http.Redirect(w, r, "/rooms", http.StatusSeeOther)
+		case errors.Is(err, errRoomTooMany):
+			app.sessionManager.Put(r.Context(), "flash", "There are too many rooms open right now, try again later")
+			http.Redirect(w, r, "/rooms", http.StatusSeeOther)
+		default:
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), roomPlayerKey(rm.code), host.token)
+
+	http.Redirect(w, r, "/rooms/"+rm.code, http.StatusSeeOther)
+}
+
+func (app *application) joinRoom(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := roomJoinForm{
+		Code: strings.ToUpper(strings.TrimSpace(r.PostForm.Get("code"))),
+		Name: strings.TrimSpace(r.PostForm.Get("name")),
+	}
+
+	form.CheckField(validator.NotBlank(form.Code), "code", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannnot be blank")
+	form.CheckField(validator.MaxChars(form.Name, roomMaxName), "name", fmt.Sprintf("This field cannot be more than %d characters long", roomMaxName))
+
+	var rm *room
+	if form.Valid() {
+		rm, err = app.rooms.get(form.Code)
+		if err != nil {
+			form.AddFieldError("code", "There's no room with this code")
+		}
+	}
+
+	if form.Valid() {
+		// Players who are already in the room go straight back to it.
+		if _, ok := rm.player(app.sessionManager.GetString(r.Context(), roomPlayerKey(rm.code))); ok {
+			http.Redirect(w, r, "/rooms/"+rm.code, http.StatusSeeOther)
+			return
+		}
+
+		player, err := rm.join(form.Name)
+		switch {
+		case err == nil:
+			app.sessionManager.Put(r.Context(), roomPlayerKey(rm.code), player.token)
+			http.Redirect(w, r, "/rooms/"+rm.code, http.StatusSeeOther)
+			return
+		case errors.Is(err, errRoomNameTaken):
+			form.AddFieldError("name", "Someone in the room already has this name")
+		case errors.Is(err, errRoomFull):
+			form.AddNonFieldError("This room is full")
+		case errors.Is(err, errRoomFinished):
+			form.AddNonFieldError("This room's game is over")
+		default:
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.renderTemplate(w, http.StatusUnprocessableEntity, "rooms.tmpl", data)
+}
+
+// roomPlayer finds the room in the URL and the token of the player the
+// session is playing in it as, writing an error response if either is
+// missing.
+func (app *application) roomPlayer(w http.ResponseWriter, r *http.Request) (*room, string, bool) {
+	rm, err := app.rooms.get(chi.URLParam(r, "code"))
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return nil, "", false
+	}
+
+	token := app.sessionManager.GetString(r.Context(), roomPlayerKey(rm.code))
+	if _, ok := rm.player(token); !ok {
+		app.clientError(w, http.StatusForbidden)
+		return nil, "", false
+	}
+
+	return rm, token, true
+}
+
+func (app *application) getRoom(w http.ResponseWriter, r *http.Request) {
+	rm, err := app.rooms.get(chi.URLParam(r, "code"))
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	token := app.sessionManager.GetString(r.Context(), roomPlayerKey(rm.code))
+	player, ok := rm.player(token)
+	if !ok {
+		http.Redirect(w, r, "/rooms?code="+rm.code, http.StatusSeeOther)
+		return
+	}
+
+	// The event stream goes around the session middleware, so it's
+	// authorized by a cookie only sent to it rather than the token being put
+	// in its URL.
+	http.SetCookie(w, &http.Cookie{
+		Name:     roomTokenCookieName,
+		Value:    token,
+		Path:     "/rooms/" + rm.code + "/events",
+		MaxAge:   int(roomIdleTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	data := app.newTemplateData(r)
+	data.PageData = roomPage{
+		Code:     rm.code,
+		PlayerID: player.id,
+		IsHost:   rm.isHost(token),
+	}
+
+	app.renderTemplate(w, http.StatusOK, "room.tmpl", data)
+}
+
+func (app *application) startRoom(w http.ResponseWriter, r *http.Request) {
+	rm, token, ok := app.roomPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	err := rm.start(token)
+	if err != nil {
+		if errors.Is(err, errRoomNotHost) {
+			app.clientError(w, http.StatusForbidden)
+		} else {
+			app.clientError(w, http.StatusConflict)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) guessRoom(w http.ResponseWriter, r *http.Request) {
+	rm, token, ok := app.roomPlayer(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = rm.guess(token, roomGuess{
+		Keyboard:       r.PostForm.Get("keyboard"),
+		Keyswitch:      r.PostForm.Get("keyswitch"),
+		PlateMaterial:  r.PostForm.Get("plate-material"),
+		KeycapMaterial: r.PostForm.Get("keycap-material"),
+	})
+	if err != nil {
+		if errors.Is(err, errRoomBadGuess) {
+			app.clientError(w, http.StatusBadRequest)
+		} else {
+			app.clientError(w, http.StatusConflict)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// roomEvents streams a room's state to one of its players as server-sent
+// events. It runs without the session middleware, which buffers responses,
+// so the player is identified by the room_token cookie set by getRoom
+// instead, which is only sent to this room's events path.
+func (app *application) roomEvents(w http.ResponseWriter, r *http.Request) {
+	rm, err := app.rooms.get(chi.URLParam(r, "code"))
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	cookie, err := r.Cookie(roomTokenCookieName)
+	if err != nil {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+	if _, ok := rm.player(cookie.Value); !ok {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverError(w, errors.New("streaming isn't supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 1000\n\n")
+	flusher.Flush()
+
+	states, unsubscribe := rm.subscribe()
+	defer unsubscribe()
+
+	end := time.NewTimer(roomStreamDuration)
+	defer end.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-end.C:
+			return
+		case state, ok := <-states:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", state)
+			flusher.Flush()
+		}
+	}
+}
+
+// redirectAfterLoginKey is the session key for where to go after logging in,
+// set when a visitor opens a challenge link.
+const redirectAfterLoginKey = "redirectAfterLogin"
+
+type challengeForm struct {
+	Keyboard       string
+	Keyswitch      string
+	PlateMaterial  string
+	KeycapMaterial string
+	Parts          models.AllParts
+	validator.Validator
+}
+
+// challengeRow is one part of a challenge's soundtest with each player's
+// guess for it, empty for a player who hasn't answered.
+type challengeRow struct {
+	Part            string
+	Answer          string
+	ChallengerGuess string
+	OpponentGuess   string
+}
+
+type challengeData struct {
+	Challenge    models.Challenge
+	IsChallenger bool
+	ShareURL     string
+	// Taken is set when someone else is already the opponent.
+	Taken bool
+	// Upcoming and PlayDaily are set when the viewer can't answer yet, the
+	// soundtest being the sound of the day for a date that hasn't started or
+	// for today.
+	Upcoming   bool
+	PlayDaily  bool
+	Answered   bool
+	Challenger *models.SoundTestPlay
+	Opponent   *models.SoundTestPlay
+	Rows       []challengeRow
+}
+
+// Result sums up the challenge once both players have answered.
+func (d challengeData) Result() string {
+	if d.Challenger == nil || d.Opponent == nil {
+		return ""
+	}
+
+	challenger, opponent := d.Challenger.Correct(), d.Opponent.Correct()
+	switch {
+	case challenger > opponent:
+		return fmt.Sprintf("@%s wins %d to %d", d.Challenge.CreatedBy, challenger, opponent)
+	case challenger < opponent:
+		return fmt.Sprintf("@%s wins %d to %d", d.Challenge.Opponent, opponent, challenger)
+	default:
+		return fmt.Sprintf("A tie, %d each", challenger)
+	}
+}
+
+func newChallengeRows(challenger, opponent *models.SoundTestPlay) []challengeRow {
+	answer := challenger
+	if answer == nil {
+		answer = opponent
+	}
+	if answer == nil {
+		return nil
+	}
+
+	rows := []challengeRow{
+		{Part: "Keyboard", Answer: answer.CorrectKeyboard},
+		{Part: "Switches", Answer: answer.CorrectKeyswitch},
+		{Part: "Plate material", Answer: answer.CorrectPlateMaterial},
+		{Part: "Keycap material", Answer: answer.CorrectKeycapMaterial},
+	}
+	if challenger != nil {
+		rows[0].ChallengerGuess = challenger.Keyboard
+		rows[1].ChallengerGuess = challenger.Keyswitch
+		rows[2].ChallengerGuess = challenger.PlateMaterial
+		rows[3].ChallengerGuess = challenger.KeycapMaterial
+	}
+	if opponent != nil {
+		rows[0].OpponentGuess = opponent.Keyboard
+		rows[1].OpponentGuess = opponent.Keyswitch
+		rows[2].OpponentGuess = opponent.PlateMaterial
+		rows[3].OpponentGuess = opponent.KeycapMaterial
+	}
+
+	return rows
+}
+
+func (app *application) createChallenge(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	soundtestID := r.PostForm.Get("soundtest-id")
+	if !validator.IsUUID(soundtestID) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	soundtest, err := app.soundtests.Get(soundtestID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if soundtest.Hidden && !uuidEq(userID, soundtest.CreatedByID) && !app.access(r).Can(models.PermViewHidden) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	challengeID, err := app.challenges.Insert(soundtestID, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/challenge/"+challengeID.String(), http.StatusSeeOther)
+}
+
+// loadChallenge gets the challenge in the URL and its soundtest, writing an
+// error response if it doesn't exist or userID can't see it.
+func (app *application) loadChallenge(w http.ResponseWriter, r *http.Request, userID string) (models.Challenge, models.SoundTestDetail, bool) {
+	challengeID := chi.URLParam(r, "challengeID")
+	if !validator.IsUUID(challengeID) {
+		app.clientError(w, http.StatusNotFound)
+		return models.Challenge{}, models.SoundTestDetail{}, false
+	}
+
+	challenge, err := app.challenges.Get(challengeID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return challenge, models.SoundTestDetail{}, false
+	}
+
+	soundtest, err := app.soundtests.Get(challenge.SoundTest.ID.String(), userID)
+	if err != nil {
+		app.serverError(w, err)
+		return challenge, soundtest, false
+	}
+
+	if soundtest.Hidden && !uuidEq(userID, soundtest.CreatedByID) && !app.access(r).Can(models.PermViewHidden) {
+		app.clientError(w, http.StatusNotFound)
+		return challenge, soundtest, false
+	}
+
+	return challenge, soundtest, true
+}
+
+// challengeAnswer gets userID's answer to the challenge's soundtest, nil if
+// they haven't answered.
+func (app *application) challengeAnswer(challenge models.Challenge, userID string) (*models.SoundTestPlay, error) {
+	answer, err := app.challenges.GetAnswer(challenge.SoundTest.ID.String(), userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &answer, nil
+}
+
+func (app *application) renderChallenge(w http.ResponseWriter, r *http.Request, statusCode int, form challengeForm) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	challenge, soundtest, ok := app.loadChallenge(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if !app.isAuthenticated(r) {
+		app.sessionManager.Put(r.Context(), redirectAfterLoginKey, r.URL.Path)
+
+		data.Form = form
+		data.PageData = challengeData{Challenge: challenge}
+		app.renderTemplate(w, statusCode, "challenge.tmpl", data)
+		return
+	}
+
+	mine, err := app.challengeAnswer(challenge, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Someone who already played the soundtest takes the challenge just by
+	// opening it.
+	if mine != nil && challenge.OpponentID == nil && !uuidEq(userID, challenge.CreatedByID) {
+		err = app.challenges.SetOpponent(challenge.ID.String(), userID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		challenge, err = app.challenges.Get(challenge.ID.String())
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	pageData := challengeData{
+		Challenge:    challenge,
+		IsChallenger: uuidEq(userID, challenge.CreatedByID),
+		ShareURL:     app.baseURL + "/challenge/" + challenge.ID.String(),
+		Answered:     mine != nil,
+	}
+	isOpponent := challenge.OpponentID != nil && uuidEq(userID, *challenge.OpponentID)
+	pageData.Taken = !pageData.IsChallenger && challenge.OpponentID != nil && !isOpponent
+
+	switch {
+	case pageData.Taken:
+	case mine == nil:
+		now := app.now(r)
+
+		canAnswer, err := app.canRevealBuild(soundtest, userID, now)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		if !canAnswer {
+			pageData.Upcoming = soundtest.DailyDate != nil && soundtest.DailyDate.After(models.CalendarDate(now))
+			pageData.PlayDaily = !pageData.Upcoming
+			break
+		}
+
+		if form.Parts.Keyboards == nil {
+			form.Parts, err = app.parts.GetDaily(challenge.SoundTest)
+			if err != nil {
+				app.serverError(w, err)
+				return
+			}
+		}
+	default:
+		if pageData.IsChallenger {
+			pageData.Challenger = mine
+			if challenge.OpponentID != nil {
+				pageData.Opponent, err = app.challengeAnswer(challenge, challenge.OpponentID.String())
+			}
+		} else {
+			pageData.Opponent = mine
+			pageData.Challenger, err = app.challengeAnswer(challenge, challenge.CreatedByID.String())
+		}
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		pageData.Rows = newChallengeRows(pageData.Challenger, pageData.Opponent)
+	}
+
+	data.Form = form
+	data.PageData = pageData
+
+	app.renderTemplate(w, statusCode, "challenge.tmpl", data)
+}
+
+func (app *application) getChallenge(w http.ResponseWriter, r *http.Request) {
+	app.renderChallenge(w, r, http.StatusOK, challengeForm{})
+}
+
+func (app *application) answerChallenge(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	challenge, soundtest, ok := app.loadChallenge(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The challenge page explains why someone can't answer, whether it's
+	// taken or the soundtest is their sound of the day.
+	isChallenger := uuidEq(userID, challenge.CreatedByID)
+	taken := !isChallenger && challenge.OpponentID != nil && !uuidEq(userID, *challenge.OpponentID)
+
+	canAnswer, err := app.canRevealBuild(soundtest, userID, app.now(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if taken || !canAnswer {
+		http.Redirect(w, r, "/challenge/"+challenge.ID.String(), http.StatusSeeOther)
+		return
+	}
+
+	parts, err := app.parts.GetDaily(challenge.SoundTest)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	form := challengeForm{
+		Keyboard:       r.PostForm.Get("keyboard"),
+		Keyswitch:      r.PostForm.Get("keyswitch"),
+		PlateMaterial:  r.PostForm.Get("plate-material"),
+		KeycapMaterial: r.PostForm.Get("keycap-material"),
+		Parts:          parts,
+	}
+
+	form.CheckField(validator.NotBlank(form.Keyboard), "keyboard", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.Keyswitch), "keyswitch", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.PlateMaterial), "plate-material", "This field cannnot be blank")
+	form.CheckField(validator.NotBlank(form.KeycapMaterial), "keycap-material", "This field cannnot be blank")
+
+	if (form.Keyboard != "" && !parts.HasKeyboard(form.Keyboard)) ||
+		(form.Keyswitch != "" && !parts.HasSwitch(form.Keyswitch)) ||
+		(form.PlateMaterial != "" && !parts.HasPlateMaterial(form.PlateMaterial)) ||
+		(form.KeycapMaterial != "" && !parts.HasKeycapMaterial(form.KeycapMaterial)) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !form.Valid() {
+		app.renderChallenge(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	// A resubmitted form keeps the first answer.
+	_, err = app.challenges.AddAnswer(challenge.SoundTest.ID, userID, form.Keyboard, form.PlateMaterial, form.KeycapMaterial, form.Keyswitch)
+	if err != nil && !errors.Is(err, models.ErrPlayOver) {
+		app.serverError(w, err)
+		return
+	}
+
+	if !isChallenger {
+		err = app.challenges.SetOpponent(challenge.ID.String(), userID)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/challenge/"+challenge.ID.String(), http.StatusSeeOther)
+}
+
+// Session keys for the pair of soundtests being compared, so the choice can't
+// be made on a pair that wasn't shown.
+const (
+	compareCriterionKey = "compareCriterion"
+	compareAKey         = "compareA"
+	compareBKey         = "compareB"
+)
+
+const (
+	compareA = "a"
+	compareB = "b"
+)
+
+// compareReveal is one of the pair with its build, once the user has picked.
+type compareReveal struct {
+	Label     string
+	SoundTest models.SoundTestDetail
+	Picked    bool
+}
+
+type compareData struct {
+	Criterion string
+	Criteria  []string
+	A         models.SoundTest
+	B         models.SoundTest
+	Reveals   []compareReveal
+	Done      bool
+}
+
+// getCompare shows a new blind pair to compare on the criterion in the query,
+// whether it sounds better by default.
+func (app *application) getCompare(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	criterion := r.URL.Query().Get("criterion")
+	if criterion == "" {
+		criterion = models.CriterionBetter
+	}
+
+	if !validator.PermittedValue(criterion, models.Criteria...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	pageData := compareData{Criterion: criterion, Criteria: models.Criteria}
+
+	a, b, err := app.comparisons.GetPair(userID, criterion, app.now(r))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			pageData.Done = true
+			data.PageData = pageData
+			app.renderTemplate(w, http.StatusOK, "compare.tmpl", data)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+	pageData.A, pageData.B = a, b
+
+	app.sessionManager.Put(r.Context(), compareCriterionKey, criterion)
+	app.sessionManager.Put(r.Context(), compareAKey, a.ID.String())
+	app.sessionManager.Put(r.Context(), compareBKey, b.ID.String())
+
+	data.PageData = pageData
+
+	app.renderTemplate(w, http.StatusOK, "compare.tmpl", data)
+}
+
+// addComparison records which of the pair in the session the user picked,
+// weighted by their trust like votes, then reveals both builds.
+func (app *application) addComparison(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	winner := r.PostForm.Get("winner")
+	if !validator.PermittedValue(winner, compareA, compareB) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// A resubmitted form has no pair left in the session and just gets a new
+	// one.
+	criterion := app.sessionManager.GetString(r.Context(), compareCriterionKey)
+	a := app.sessionManager.GetString(r.Context(), compareAKey)
+	b := app.sessionManager.GetString(r.Context(), compareBKey)
+	if criterion == "" || a == "" || b == "" {
+		http.Redirect(w, r, "/compare?criterion="+url.QueryEscape(r.PostForm.Get("criterion")), http.StatusSeeOther)
+		return
+	}
+
+	// Either soundtest might have been deleted since the pair was shown.
+	revealA, err := app.soundtests.Get(a, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/compare?criterion="+url.QueryEscape(criterion), http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	revealB, err := app.soundtests.Get(b, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			http.Redirect(w, r, "/compare?criterion="+url.QueryEscape(criterion), http.StatusSeeOther)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	winnerID, loserID := a, b
+	if winner == compareB {
+		winnerID, loserID = b, a
+	}
+
+	trust, err := app.users.GetTrust(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.comparisons.Add(criterion, winnerID, loserID, trust.Weight(time.Now()), userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), compareCriterionKey)
+	app.sessionManager.Remove(r.Context(), compareAKey)
+	app.sessionManager.Remove(r.Context(), compareBKey)
+
+	data.PageData = compareData{
+		Criterion: criterion,
+		Criteria:  models.Criteria,
+		Reveals: []compareReveal{
+			{Label: "Sound A", SoundTest: revealA, Picked: winner == compareA},
+			{Label: "Sound B", SoundTest: revealB, Picked: winner == compareB},
+		},
+	}
+
+	app.renderTemplate(w, http.StatusOK, "compare.tmpl", data)
+}
+
+const (
+	// Subjects compared fewer times than these are left off tier lists, one
+	// lucky matchup says little.
+	minTierComparisons          = 5
+	minSoundTestTierComparisons = 3
+)
+
+type tiersData struct {
+	Criterion string
+	Criteria  []string
+	Subject   string
+	Subjects  []string
+	Tiers     []models.Tier
+	Updated   *time.Time
+}
+
+// getTiers shows the community tier list of switches, keyboards or
+// soundtests on a criterion, from the ratings last fitted by
+// -rate-comparisons.
+func (app *application) getTiers(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	query := r.URL.Query()
+
+	criterion := query.Get("criterion")
+	if criterion == "" {
+		criterion = models.CriterionBetter
+	}
+
+	subject := query.Get("subject")
+	if subject == "" {
+		subject = models.SubjectKeyswitch
+	}
+
+	if !validator.PermittedValue(criterion, models.Criteria...) ||
+		!validator.PermittedValue(subject, models.RatingSubjects...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	minComparisons := minTierComparisons
+	if subject == models.SubjectSoundTest {
+		minComparisons = minSoundTestTierComparisons
+	}
+
+	ratings, err := app.comparisons.GetRatings(subject, criterion, minComparisons, app.now(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	updated, err := app.comparisons.LastRated()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	pageData := tiersData{
+		Criterion: criterion,
+		Criteria:  models.Criteria,
+		Subject:   subject,
+		Subjects:  models.RatingSubjects,
+		Updated:   updated,
+	}
+	if len(ratings) > 0 {
+		pageData.Tiers = models.TierList(criterion, ratings)
+	}
+
+	data.PageData = pageData
+
+	app.renderTemplate(w, http.StatusOK, "tiers.tmpl", data)
+}
+
+type profileForm struct {
+	Name            string
+	Username        string
+	Email           string
+	Bio             string
+	ShowPlayHistory bool
+	Timezone        string
+	Avatar          string
+	EmailVerified   bool
+	validator.Validator
+}
+
+func newProfileForm(profile models.ProfileInfo) profileForm {
+	return profileForm{
+		Name:            profile.Name,
+		Username:        profile.Username,
+		Email:           profile.Email,
+		Bio:             profile.Bio,
+		ShowPlayHistory: profile.ShowPlayHistory,
+		Timezone:        profile.Timezone,
+		Avatar:          profile.Avatar,
+		EmailVerified:   profile.EmailVerified,
+	}
+}
+
+func (app *application) getUserProfile(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	profile, err := app.users.GetProfileInfo(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	warnings, err := app.users.GetWarnings(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Form = newProfileForm(profile)
+	data.PageData = warnings
+
+	app.renderTemplate(w, http.StatusOK, "profile.tmpl", data)
+}
+
+func (app *application) updateUserProfile(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	warnings, err := app.users.GetWarnings(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	data.PageData = warnings
+
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	profile, err := app.users.GetProfileInfo(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	form := profileForm{
+		Name:            r.PostForm.Get("name"),
+		Username:        r.PostForm.Get("username"),
+		Email:           r.PostForm.Get("email"),
+		Bio:             strings.TrimSpace(r.PostForm.Get("bio")),
+		ShowPlayHistory: r.PostForm.Get("show-play-history") == "on",
+		Timezone:        strings.TrimSpace(r.PostForm.Get("timezone")),
+		Avatar:          profile.Avatar,
+		EmailVerified:   profile.EmailVerified,
+	}
+
+	form.CheckField(validator.MinChars(form.Username, 3), "username", "This field must be at least 3 characters.")
+	form.CheckField(form.Username == "" || validator.Matches(form.Username, validator.UsernameRegex), "username", "Usernames can only use letters, numbers, dots, dashes and underscores")
+	form.CheckField(!strings.EqualFold(form.Username, "anonymous"), "username", "Username is already in use")
+	form.CheckField(validator.MaxChars(form.Bio, 300), "bio", "This field cannot be more than 300 characters long")
+	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannnot be blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRegex), "email", "This field must be a valid email address")
+	_, validTimezone := loadTimezone(form.Timezone)
+	form.CheckField(form.Timezone == "" || validTimezone, "timezone", "This field must be a timezone like Europe/London")
+
+	data.Form = form
+
+	if !form.Valid() {
+		app.renderTemplate(w, http.StatusUnprocessableEntity, "profile.tmpl", data)
+		return
+	}
+
+	err = app.users.UpdateProfile(userID, form.Email, form.Name, form.Username, form.Bio, form.ShowPlayHistory, form.Timezone)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateUsername) {
+			form.AddFieldError("username", "Username is already in use")
+
+			data := app.newTemplateData(r)
+			data.Form = form
+			data.PageData = warnings
+			app.renderTemplate(w, http.StatusUnprocessableEntity, "profile.tmpl", data)
+		} else {
+			app.serverError(w, err)
+		}
+
+		return
+	}
+
+	if form.Email != profile.Email {
+		err = app.sendEmailVerification(userID)
+		if err != nil {
+			app.errorLog.Printf("failed to send email verification to %s: %v", userID, err)
+		}
+	}
+
+	profile, err = app.users.GetProfileInfo(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Form = newProfileForm(profile)
+
+	app.renderTemplate(w, http.StatusOK, "profile.tmpl", data)
+}
+
+// avatarTypes maps the image types accepted as avatars to their extension.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+func (app *application) updateAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	r.Body = http.MaxBytesReader(w, r.Body, 2*MB)
+	err := r.ParseMultipartForm(2 * MB)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	defer file.Close()
+
+	fileHeader := make([]byte, 512)
+	n, err := file.Read(fileHeader)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	filetype := http.DetectContentType(fileHeader[:n])
+	ext, ok := avatarTypes[filetype]
+	if !ok {
+		app.sessionManager.Put(r.Context(), "flash", "Avatars must be a PNG, JPEG, GIF or WebP image")
+		http.Redirect(w, r, "/user", http.StatusSeeOther)
+		return
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	name, err := uuid.NewV4()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	objKey := filepath.Join("avatars", userID, name.String()+ext)
+
+	_, err = app.s3Client.PutObject(&s3.PutObjectInput{
+		Body:        file,
+		Bucket:      aws.String(os.Getenv("B2_BUCKET")),
+		Key:         aws.String(objKey),
+		ContentType: aws.String(filetype),
+	})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.replaceAvatar(w, r, userID, objKey, "Avatar updated")
+}
+
+func (app *application) deleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	app.replaceAvatar(w, r, userID, "", "Avatar removed")
+}
+
+func (app *application) replaceAvatar(w http.ResponseWriter, r *http.Request, userID, objKey, flash string) {
+	previous, err := app.users.SetAvatar(userID, objKey)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if previous != "" {
+		_, err = app.s3Client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(os.Getenv("B2_BUCKET")),
+			Key:    aws.String(previous),
+		})
+		if err != nil {
+			app.errorLog.Printf("failed to delete %s from storage: %v", previous, err)
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", flash)
+
+	http.Redirect(w, r, "/user", http.StatusSeeOther)
+}
+
+// challengeHistoryLength is how many challenges are listed on a profile.
+const challengeHistoryLength = 10
+
+type publicProfileData struct {
+	Profile     models.PublicProfile
+	SoundTests  []models.UserSoundTest
+	PlayRecord  *models.PlayRecord
+	Challenges  []models.ChallengeResult
+	Follows     models.FollowCounts
+	IsFollowing bool
+	IsOwn       bool
+}
+
+func (app *application) getPublicProfile(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	profile, err := app.users.GetPublicProfile(chi.URLParam(r, "username"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
 	}
 
-	app.renderTemplate(w, http.StatusOK, "profile.tmpl", data)
+	pageData := publicProfileData{
+		Profile: profile,
+		IsOwn:   app.isAuthenticated(r) && uuidEq(userID, profile.ID),
+	}
+
+	pageData.Follows, err = app.follows.GetCounts(profile.ID.String())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if app.isAuthenticated(r) && !pageData.IsOwn {
+		pageData.IsFollowing, err = app.follows.IsFollowing(userID, profile.ID.String())
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
+	soundtests, err := app.soundtests.GetByUser(profile.ID.String())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	// Listing today's sound of the day, or one picked for a date that hasn't
+	// started here yet, with its build would spoil the daily.
+	var dailyID uuid.UUID
+	now := app.now(r)
+	if !pageData.IsOwn {
+		daily, err := app.soundtests.GetDaily(now)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			app.serverError(w, err)
+			return
+		}
+		dailyID = daily.ID
+	}
+
+	canSeeHidden := pageData.IsOwn || app.access(r).Can(models.PermViewHidden)
+	for _, st := range soundtests {
+		upcoming := !pageData.IsOwn && st.DailyDate != nil && st.DailyDate.After(models.CalendarDate(now))
+		if st.ID == dailyID || upcoming || (st.Hidden && !canSeeHidden) {
+			continue
+		}
+		pageData.SoundTests = append(pageData.SoundTests, st)
+	}
+
+	if profile.ShowPlayHistory || pageData.IsOwn {
+		record, err := app.soundtests.GetPlayRecord(profile.ID.String(), now)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		pageData.PlayRecord = &record
+	}
+
+	// Others only see challenges that are over.
+	if profile.ShowPlayHistory || pageData.IsOwn {
+		challenges, err := app.challenges.GetHistory(profile.ID.String(), challengeHistoryLength)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		for _, c := range challenges {
+			if pageData.IsOwn || c.Outcome() != "" {
+				pageData.Challenges = append(pageData.Challenges, c)
+			}
+		}
+	}
+
+	data.PageData = pageData
+
+	app.renderTemplate(w, http.StatusOK, "public-profile.tmpl", data)
+}
+
+func (app *application) followUser(w http.ResponseWriter, r *http.Request) {
+	app.setFollowing(w, r, true)
+}
+
+func (app *application) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	app.setFollowing(w, r, false)
+}
+
+func (app *application) setFollowing(w http.ResponseWriter, r *http.Request, follow bool) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	username := chi.URLParam(r, "username")
+
+	profile, err := app.users.GetPublicProfile(username)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	if uuidEq(userID, profile.ID) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if follow {
+		err = app.follows.Follow(userID, profile.ID.String())
+	} else {
+		err = app.follows.Unfollow(userID, profile.ID.String())
+	}
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if follow {
+		err = app.notifications.NotifyFollower(profile.ID.String(), userID)
+		if err != nil {
+			app.errorLog.Printf("failed to notify %s about a follower: %v", profile.ID, err)
+		}
+	}
+
+	http.Redirect(w, r, "/u/"+url.PathEscape(profile.Username), http.StatusSeeOther)
+}
+
+type webhookForm struct {
+	URL    string
+	Events []string
+	validator.Validator
+}
+
+func (f webhookForm) Subscribed(event string) bool {
+	return validator.PermittedValue(event, f.Events...)
+}
+
+type webhooksData struct {
+	Webhooks []models.Webhook
+	Events   []string
+}
+
+func (app *application) renderWebhooks(w http.ResponseWriter, r *http.Request, status int, form webhookForm) {
+	data := app.newTemplateData(r)
+
+	webhooks, err := app.webhooks.GetAll()
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Form = form
+	data.PageData = webhooksData{
+		Webhooks: webhooks,
+		Events:   models.WebhookEvents,
+	}
+
+	app.renderTemplate(w, status, "admin-webhooks.tmpl", data)
+}
+
+func (app *application) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	app.renderWebhooks(w, r, http.StatusOK, webhookForm{})
+}
+
+func (app *application) addWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := webhookForm{
+		URL:    strings.TrimSpace(r.PostForm.Get("url")),
+		Events: r.PostForm["events"],
+	}
+
+	target, err := url.Parse(form.URL)
+	validURL := err == nil && (target.Scheme == "https" || target.Scheme == "http") && target.Host != ""
+
+	form.CheckField(validator.NotBlank(form.URL), "url", "This field cannnot be blank")
+	form.CheckField(validURL, "url", "This field must be an http or https URL")
+	form.CheckField(validator.MaxChars(form.URL, 2000), "url", "This field cannot be more than 2000 characters long")
+	form.CheckField(len(form.Events) > 0, "events", "Pick at least one event")
+	for _, event := range form.Events {
+		form.CheckField(validator.PermittedValue(event, models.WebhookEvents...), "events", "This field must only contain valid events")
+	}
+
+	if !form.Valid() {
+		app.renderWebhooks(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	_, err = app.webhooks.Insert(form.URL, form.Events, userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Webhook added")
+
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+func (app *application) setWebhookActive(w http.ResponseWriter, r *http.Request) {
+	webhookID := chi.URLParam(r, "webhookID")
+	if !validator.IsUUID(webhookID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	active, err := strconv.ParseBool(r.FormValue("active"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.webhooks.SetActive(webhookID, active)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+func (app *application) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID := chi.URLParam(r, "webhookID")
+	if !validator.IsUUID(webhookID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err := app.webhooks.Delete(webhookID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusNotFound)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Webhook deleted")
+
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+const recentDeliveries = 100
+
+func (app *application) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+
+	webhookID := r.URL.Query().Get("webhook")
+	if webhookID != "" && !validator.IsUUID(webhookID) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := app.webhooks.GetDeliveries(webhookID, recentDeliveries)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.PageData = deliveries
+
+	app.renderTemplate(w, http.StatusOK, "admin-webhook-deliveries.tmpl", data)
+}
+
+func (app *application) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	deliveryID := chi.URLParam(r, "deliveryID")
+	if !validator.IsUUID(deliveryID) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err := app.webhooks.Redeliver(deliveryID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusConflict)
+		} else {
+			app.serverError(w, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Delivery queued to be sent again")
+
+	http.Redirect(w, r, localRedirect(refererPath(r), "/admin/webhooks/deliveries"), http.StatusSeeOther)
+}
+
+const recentNotifications = 50
+
+type notificationsData struct {
+	Notifications []models.Notification
+	Kinds         []string
+	Labels        map[string]string
+	Email         map[string]bool
+}
+
+func (app *application) getNotifications(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	viewed := time.Now()
+
+	notifications, err := app.notifications.GetRecent(userID, recentNotifications)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	email, err := app.notifications.GetEmailPreferences(userID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.notifications.MarkAllRead(userID, viewed)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.Unread = 0
+	data.PageData = notificationsData{
+		Notifications: notifications,
+		Kinds:         models.NotificationKinds,
+		Labels:        models.NotificationLabels,
+		Email:         email,
+	}
+
+	app.renderTemplate(w, http.StatusOK, "notifications.tmpl", data)
+}
+
+func (app *application) updateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	prefs := make(map[string]bool, len(models.NotificationKinds))
+	for _, kind := range models.NotificationKinds {
+		prefs[kind] = r.PostForm.Get("email-"+kind) == "on"
+	}
+
+	err = app.notifications.SetEmailPreferences(userID, prefs)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Email preferences saved")
+
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+const leaderboardSize = 50
+
+const (
+	leaderboardEveryone  = "everyone"
+	leaderboardFollowing = "following"
+)
+
+type leaderboardData struct {
+	Entries []models.LeaderboardEntry
+	Period  string
+	Periods []string
+	Who     string
+	Mode    string
+	Modes   []string
+}
+
+func (app *application) getLeaderboard(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	userID := app.sessionManager.GetString(r.Context(), "authenticatedUserID")
+	query := r.URL.Query()
+
+	period := query.Get("period")
+	if period == "" {
+		period = models.PeriodWeek
+	}
+
+	who := query.Get("who")
+	if who == "" {
+		who = leaderboardEveryone
+	}
+
+	mode := query.Get("mode")
+	if mode == "" {
+		mode = models.PlayModeClassic
+	}
+
+	if !validator.PermittedValue(period, models.LeaderboardPeriods...) ||
+		!validator.PermittedValue(who, leaderboardEveryone, leaderboardFollowing) ||
+		!validator.PermittedValue(mode, models.PlayModes...) {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	followingOnly := who == leaderboardFollowing
+	if followingOnly && !app.isAuthenticated(r) {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	entries, err := app.soundtests.GetLeaderboard(period, mode, followingOnly, userID, leaderboardSize)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	data.PageData = leaderboardData{
+		Entries: entries,
+		Period:  period,
+		Periods: models.LeaderboardPeriods,
+		Who:     who,
+		Mode:    mode,
+		Modes:   models.PlayModes,
+	}
+
+	app.renderTemplate(w, http.StatusOK, "leaderboard.tmpl", data)
 }
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"runtime/debug"
+	"strings"
+
+	"github.com/0xhjohnson/clacksy/models"
 )
 
 func (app *application) serverError(w http.ResponseWriter, err error) {
@@ -27,6 +31,18 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	return isAuthenticated
 }
 
+// access is the signed in user's role and permissions, or the zero Access for
+// anonymous visitors.
+func (app *application) access(r *http.Request) models.Access {
+	access, _ := r.Context().Value(accessContextKey).(models.Access)
+	return access
+}
+
+func (app *application) unreadNotifications(r *http.Request) int {
+	unread, _ := r.Context().Value(unreadContextKey).(int)
+	return unread
+}
+
 func (app *application) hasPlayed(r *http.Request) bool {
 	hasPlayed := r.Context().Value(userPlayContextKey)
 	return hasPlayed != nil
@@ -35,3 +51,88 @@ func (app *application) hasPlayed(r *http.Request) bool {
 func filenameWithoutExt(fileName string) string {
 	return fileName[:len(fileName)-len(filepath.Ext(fileName))]
 }
+
+// attributeSelections collects the optional build attribute options picked in
+// form. Attributes left blank are skipped; an option that doesn't belong to its
+// attribute means the form was tampered with and ok is false.
+func attributeSelections(form url.Values, attributes []models.BuildAttribute) (selections map[string]string, ok bool) {
+	selections = make(map[string]string)
+
+	for _, attribute := range attributes {
+		optionID := form.Get("attribute-" + attribute.ID.String())
+		if optionID == "" {
+			continue
+		}
+
+		valid := false
+		for _, option := range attribute.Options {
+			if uuidEq(optionID, option.ID) {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
+			return nil, false
+		}
+
+		selections[attribute.ID.String()] = optionID
+	}
+
+	return selections, true
+}
+
+func cursorQuery(query url.Values, key, cursor string) string {
+	q := url.Values{}
+	for k, values := range query {
+		q[k] = values
+	}
+
+	q.Del("after")
+	q.Del("before")
+	q.Set(key, cursor)
+
+	return q.Encode()
+}
+
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+// localRedirect returns target when it is a path on this site, escaped so it
+// is safe to echo back, or fallback when target is empty, unparseable or could
+// point anywhere else. Browsers treat a backslash like a slash, so any target
+// containing one is refused.
+func localRedirect(target, fallback string) string {
+	if strings.Contains(target, `\`) {
+		return fallback
+	}
+
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return fallback
+	}
+	if !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") || strings.Contains(u.Path, `\`) {
+		return fallback
+	}
+	if strings.ContainsAny(u.RawQuery, "\"'<>` \\") {
+		return fallback
+	}
+
+	if u.RawQuery != "" {
+		return u.EscapedPath() + "?" + u.RawQuery
+	}
+
+	return u.EscapedPath()
+}
+
+// refererPath returns the path and query of the request's Referer when it
+// points back at this site, or an empty string so localRedirect falls back.
+func refererPath(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Host == "" || u.Host != r.Host {
+		return ""
+	}
+
+	return u.RequestURI()
+}
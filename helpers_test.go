@@ -7,10 +7,13 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/0xhjohnson/clacksy/models"
+	"github.com/gofrs/uuid"
 )
 
 func TestFilenameWithoutExt(t *testing.T) {
@@ -198,3 +201,188 @@ func TestServerError(t *testing.T) {
 		})
 	}
 }
+
+func TestAttributeSelections(t *testing.T) {
+	profile := uuid.Must(uuid.FromString("05ff139b-8b9a-4341-a161-8628c3e038e7"))
+	sa := uuid.Must(uuid.FromString("2a0f3ad4-216d-43db-a731-fdab599e2d45"))
+	mount := uuid.Must(uuid.FromString("8d3b6c2e-6f4a-4a4e-9d59-3c2f1a0e7b11"))
+	gasket := uuid.Must(uuid.FromString("c6a1f9e2-1d3b-4c5e-8f7a-9b0c1d2e3f40"))
+
+	attributes := []models.BuildAttribute{
+		{ID: profile, Options: []models.BuildAttributeOption{{ID: sa}}},
+		{ID: mount, Options: []models.BuildAttributeOption{{ID: gasket}}},
+	}
+
+	tests := map[string]struct {
+		form   url.Values
+		want   map[string]string
+		wantOk bool
+	}{
+		"nothing selected": {
+			form:   url.Values{},
+			want:   map[string]string{},
+			wantOk: true,
+		},
+		"some selected": {
+			form:   url.Values{"attribute-" + profile.String(): {sa.String()}},
+			want:   map[string]string{profile.String(): sa.String()},
+			wantOk: true,
+		},
+		"option from another attribute": {
+			form:   url.Values{"attribute-" + profile.String(): {gasket.String()}},
+			want:   nil,
+			wantOk: false,
+		},
+		"unknown attribute ignored": {
+			form:   url.Values{"attribute-nope": {sa.String()}, "attribute-" + mount.String(): {gasket.String()}},
+			want:   map[string]string{mount.String(): gasket.String()},
+			wantOk: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := attributeSelections(tc.form, attributes)
+			if ok != tc.wantOk {
+				t.Fatalf("want ok: %t, got: %t", tc.wantOk, ok)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCursorQuery(t *testing.T) {
+	tests := map[string]struct {
+		query  url.Values
+		key    string
+		cursor string
+		want   string
+	}{
+		"empty query": {
+			query:  url.Values{},
+			key:    "after",
+			cursor: "abc",
+			want:   "after=abc",
+		},
+		"keeps filters": {
+			query:  url.Values{"q": {"ink"}, "sort": {"top"}},
+			key:    "after",
+			cursor: "abc",
+			want:   "after=abc&q=ink&sort=top",
+		},
+		"replaces opposite cursor": {
+			query:  url.Values{"after": {"abc"}, "q": {"ink"}},
+			key:    "before",
+			cursor: "def",
+			want:   "before=def&q=ink",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := cursorQuery(tc.query, tc.key, tc.cursor)
+			if tc.want != got {
+				t.Errorf("want: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLocalRedirect(t *testing.T) {
+	tests := map[string]struct {
+		target string
+		want   string
+	}{
+		"empty": {
+			target: "",
+			want:   "/vote",
+		},
+		"path and query": {
+			target: "/soundtests?sort=top&after=abc",
+			want:   "/soundtests?sort=top&after=abc",
+		},
+		"absolute url": {
+			target: "https://evil.example/phish",
+			want:   "/vote",
+		},
+		"protocol relative": {
+			target: "//evil.example/phish",
+			want:   "/vote",
+		},
+		"double slash path": {
+			target: "/%2F/evil.example",
+			want:   "/vote",
+		},
+		"backslash": {
+			target: `/\evil.example`,
+			want:   "/vote",
+		},
+		"encoded backslash": {
+			target: "/%5Cevil.example",
+			want:   "/vote",
+		},
+		"encoded quote": {
+			target: "/%22%3E%3Cscript%3Ealert(1)%3C/script%3E",
+			want:   "/%22%3E%3Cscript%3Ealert(1)%3C/script%3E",
+		},
+		"raw quote": {
+			target: `/"><script>`,
+			want:   "/%22%3E%3Cscript%3E",
+		},
+		"quote in query": {
+			target: `/soundtests?q="><script>`,
+			want:   "/vote",
+		},
+		"relative path": {
+			target: "soundtests",
+			want:   "/vote",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := localRedirect(tc.target, "/vote")
+			if tc.want != got {
+				t.Errorf("want: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRefererPath(t *testing.T) {
+	tests := map[string]struct {
+		referer string
+		want    string
+	}{
+		"none": {
+			referer: "",
+			want:    "",
+		},
+		"same site": {
+			referer: "https://example.com/soundtests?sort=top",
+			want:    "/soundtests?sort=top",
+		},
+		"other site": {
+			referer: "https://evil.example/phish",
+			want:    "",
+		},
+		"same site encoded": {
+			referer: "https://example.com/%22%3E",
+			want:    "/%22%3E",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Referer", tc.referer)
+
+			got := refererPath(r)
+			if tc.want != got {
+				t.Errorf("want: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+type mailer interface {
+	Send(to, subject, body string) error
+}
+
+// newMailer sends mail through SMTP_HOST when it's set, otherwise it only
+// logs what would have been sent.
+func newMailer(infoLog *log.Logger) mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return &logMailer{log: infoLog}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "clacksy <noreply@clacksy.com>"
+	}
+
+	return &smtpMailer{
+		addr: host + ":" + port,
+		auth: smtp.PlainAuth("", os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), host),
+		from: from,
+	}
+}
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func (m *smtpMailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("mailer: header contains a newline")
+	}
+
+	msg := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+
+	return smtp.SendMail(m.addr, m.auth, fromAddress(m.from), []string{to}, []byte(msg))
+}
+
+// fromAddress pulls the bare address out of a "name <address>" From header.
+func fromAddress(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		return strings.TrimSuffix(from[i+1:], ">")
+	}
+	return from
+}
+
+type logMailer struct {
+	log *log.Logger
+}
+
+func (m *logMailer) Send(to, subject, body string) error {
+	m.log.Printf("Mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
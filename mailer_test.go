@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestFromAddress(t *testing.T) {
+	tests := map[string]struct {
+		from string
+		want string
+	}{
+		"bare address": {from: "noreply@clacksy.com", want: "noreply@clacksy.com"},
+		"named":        {from: "clacksy <noreply@clacksy.com>", want: "noreply@clacksy.com"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := fromAddress(tc.from); got != tc.want {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	m := &smtpMailer{addr: "localhost:0", from: "noreply@clacksy.com"}
+
+	err := m.Send("a@b.com\r\nBcc: c@d.com", "hi", "body")
+	if err == nil {
+		t.Error("expected an error for a recipient containing a newline")
+	}
+}
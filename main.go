@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
+	// The image has no zoneinfo, users' timezones are looked up in this.
+	_ "time/tzdata"
 
 	"github.com/0xhjohnson/clacksy/models"
 	"github.com/0xhjohnson/clacksy/ui"
+	"github.com/0xhjohnson/clacksy/validator"
 	"github.com/alexedwards/scs/pgxstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/aws/aws-sdk-go/aws"
@@ -22,19 +28,50 @@ import (
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+const (
+	defaultPageSize = 10
+	maxPageSize     = 50
+
+	// browsePageSize is the browse page's default, which lists more at once
+	// than the vote feed.
+	browsePageSize = 20
+)
+
 type application struct {
 	errorLog       *log.Logger
 	infoLog        *log.Logger
 	sessionManager *scs.SessionManager
 	templateCache  map[string]*template.Template
+	pageSize       int
 	users          *models.UserModel
 	soundtests     *models.SoundTestModel
 	parts          *models.PartsModel
 	votes          *models.VoteModel
+	comments       *models.CommentModel
+	moderation     *models.ModerationModel
+	follows        *models.FollowModel
+	notifications  *models.NotificationModel
+	webhooks       *models.WebhookModel
+	challenges     *models.ChallengeModel
+	comparisons    *models.ComparisonModel
+	mailer         mailer
+	baseURL        string
+	guestSecret    []byte
+	rooms          *roomHub
+	clips          *clipCache
 	s3Client       *s3.S3
 }
 
 func main() {
+	featureDaily := flag.Bool("feature-daily", false, "feature the sound of the day for each current date and exit")
+	reconcileTallies := flag.Bool("reconcile-tallies", false, "rebuild vote tallies from the vote table and exit")
+	rateComparisons := flag.Bool("rate-comparisons", false, "fit ratings and tier lists to every comparison and exit")
+	setRole := flag.String("set-role", "", "give the user with -email this role and exit")
+	email := flag.String("email", "", "email of the user for -set-role")
+	deliverWebhooks := flag.Bool("deliver-webhooks", false, "send webhook deliveries that are due and exit")
+	sendDigests := flag.Bool("send-digests", false, "email unread notifications to users who want them and exit")
+	flag.Parse()
+
 	databaseURL := os.Getenv("DATABASE_URL")
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -42,9 +79,29 @@ func main() {
 	}
 	addr := ":" + port
 
+	pageSize, err := strconv.Atoi(os.Getenv("PAGE_SIZE"))
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		pageSize = defaultPageSize
+	}
+
+	difficulty := os.Getenv("DAILY_DIFFICULTY")
+	if difficulty != "" && !validator.PermittedValue(difficulty, models.Difficulties...) {
+		log.Fatalf("DAILY_DIFFICULTY must be one of %s", strings.Join(models.Difficulties, ", "))
+	}
+
+	baseURL := strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "https://clacksy.com"
+	}
+
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	guestSecret, err := newGuestSecret(os.Getenv("GUEST_SECRET"))
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
 	dbpool, err := openDbPool(databaseURL)
 	if err != nil {
 		errorLog.Fatal(err)
@@ -75,25 +132,88 @@ func main() {
 		infoLog:        infoLog,
 		sessionManager: sessionManager,
 		templateCache:  templateCache,
+		pageSize:       pageSize,
 		users:          &models.UserModel{DB: dbpool},
 		soundtests:     &models.SoundTestModel{DB: dbpool},
-		parts:          &models.PartsModel{DB: dbpool},
+		parts:          &models.PartsModel{DB: dbpool, Difficulty: difficulty},
 		votes:          &models.VoteModel{DB: dbpool},
+		comments:       &models.CommentModel{DB: dbpool},
+		moderation:     &models.ModerationModel{DB: dbpool},
+		follows:        &models.FollowModel{DB: dbpool},
+		notifications:  &models.NotificationModel{DB: dbpool},
+		webhooks:       &models.WebhookModel{DB: dbpool},
+		challenges:     &models.ChallengeModel{DB: dbpool},
+		comparisons:    &models.ComparisonModel{DB: dbpool},
+		mailer:         newMailer(infoLog),
+		baseURL:        baseURL,
+		guestSecret:    guestSecret,
+		rooms:          newRoomHub(roomRoundTime, roomRevealTime),
+		clips:          &clipCache{},
 		s3Client:       s3Client,
 	}
 
+	switch {
+	case *featureDaily:
+		err = app.featureDaily()
+	case *reconcileTallies:
+		err = app.reconcileTallies()
+	case *rateComparisons:
+		err = app.rateComparisons()
+	case *deliverWebhooks:
+		err = app.deliverDueWebhooks()
+	case *sendDigests:
+		err = app.sendDigests()
+	case *setRole != "":
+		err = app.setRole(*email, *setRole)
+	default:
+		err = app.serve(addr)
+	}
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+}
+
+func (app *application) serve(addr string) error {
 	srv := &http.Server{
 		Addr:         addr,
-		ErrorLog:     errorLog,
+		ErrorLog:     app.errorLog,
 		Handler:      app.routes(),
 		IdleTimeout:  2 * time.Minute,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
 
-	infoLog.Printf("Starting server on %s", addr)
-	err = srv.ListenAndServe()
-	errorLog.Fatal(err)
+	stop := make(chan struct{})
+	defer close(stop)
+	go app.runWebhookWorker(stop)
+	go app.runRankRefresher(stop)
+	go app.rooms.runSweeper(stop)
+
+	app.infoLog.Printf("Starting server on %s", addr)
+	return srv.ListenAndServe()
+}
+
+// rankRefreshInterval is how often the scores ranked listings sort by are
+// retaken. Someone paging through a ranking as they're retaken may see a
+// soundtest twice or miss one.
+const rankRefreshInterval = 10 * time.Minute
+
+// runRankRefresher refreshes the ranking snapshot until stop is closed.
+func (app *application) runRankRefresher(stop <-chan struct{}) {
+	ticker := time.NewTicker(rankRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := app.soundtests.RefreshRanks()
+			if err != nil {
+				app.errorLog.Printf("failed to refresh rankings: %v", err)
+			}
+		}
+	}
 }
 
 func openDbPool(dsn string) (*pgxpool.Pool, error) {
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/0xhjohnson/clacksy/models"
 	"github.com/jackc/pgx/v4"
 )
 
@@ -20,6 +21,36 @@ func (app *application) requireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// requireRole responds as if the page doesn't exist for anyone whose role is
+// less privileged than role.
+func (app *application) requireRole(role string) func(http.Handler) http.Handler {
+	return app.requireAccess(func(a models.Access) bool {
+		return a.AtLeast(role)
+	})
+}
+
+// requirePermission responds as if the page doesn't exist for anyone whose
+// role hasn't been granted permission.
+func (app *application) requirePermission(permission string) func(http.Handler) http.Handler {
+	return app.requireAccess(func(a models.Access) bool {
+		return a.Can(permission)
+	})
+}
+
+func (app *application) requireAccess(allowed func(models.Access) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.isAuthenticated(r) || !allowed(app.access(r)) {
+				app.clientError(w, http.StatusNotFound)
+				return
+			}
+
+			w.Header().Add("Cache-Control", "no-store")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := app.sessionManager.GetString(r.Context(), string(authenticatedUserKey))
@@ -28,14 +59,34 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		exists, err := app.users.Exists(id)
+		status, err := app.users.Status(id)
 		if err != nil {
 			app.serverError(w, err)
 			return
 		}
 
-		if exists {
+		if status.Suspended {
+			app.sessionManager.Remove(r.Context(), string(authenticatedUserKey))
+			app.sessionManager.Put(r.Context(), "flash", "Your account has been suspended")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		if status.Exists {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, accessContextKey, status.Access)
+			ctx = context.WithValue(ctx, unreadContextKey, status.Unread)
+
+			if status.Timezone == "" {
+				if tz := browserTimezone(r); tz != "" {
+					err := app.users.SetDefaultTimezone(id, tz)
+					if err != nil {
+						app.errorLog.Print(err)
+					}
+					status.Timezone = tz
+				}
+			}
+			ctx = context.WithValue(ctx, timezoneContextKey, status.Timezone)
 			r = r.WithContext(ctx)
 		}
 
@@ -43,31 +94,62 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// paginate reads the requested page of a listing from the query, app.pageSize
+// rows unless ?limit= asks for another size.
 func (app *application) paginate(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		pageQ := r.URL.Query().Get("page")
+	return app.paginateBy(app.pageSize)(next)
+}
 
-		page := 0
+// paginateBy is paginate for listings with their own default page size.
+func (app *application) paginateBy(pageSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+
+			page := models.PageRequest{Limit: pageSize}
+
+			if limitQ := query.Get("limit"); limitQ != "" {
+				limit, err := strconv.Atoi(limitQ)
+				if err != nil || limit < 1 || limit > maxPageSize {
+					app.clientError(w, http.StatusBadRequest)
+					return
+				}
+				page.Limit = limit
+			}
 
-		if pageQ != "" {
-			var err error
-			page, err = strconv.Atoi(pageQ)
-			if err != nil {
-				app.serverError(w, err)
-				return
+			if after := query.Get("after"); after != "" {
+				cursor, err := models.DecodeCursor(after)
+				if err != nil {
+					app.clientError(w, http.StatusBadRequest)
+					return
+				}
+				page.After = &cursor
+			} else if before := query.Get("before"); before != "" {
+				cursor, err := models.DecodeCursor(before)
+				if err != nil {
+					app.clientError(w, http.StatusBadRequest)
+					return
+				}
+				page.Before = &cursor
 			}
-		}
 
-		ctx := context.WithValue(r.Context(), pageContextKey, page)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			ctx := context.WithValue(r.Context(), pageContextKey, page)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
 
 func (app *application) userDailyPlay(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID := app.sessionManager.GetString(r.Context(), string(authenticatedUserKey))
 
-		userPlay, err := app.soundtests.GetPlay(userID)
+		var userPlay models.SoundTestPlay
+		var err error
+		if guestID := app.guestID(r); guestID != "" {
+			userPlay, err = app.soundtests.GetGuestPlay(guestID, app.now(r))
+		} else {
+			userPlay, err = app.soundtests.GetPlay(userID, app.now(r))
+		}
 		if err != nil {
 			switch {
 			case err == pgx.ErrNoRows:
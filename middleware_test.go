@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/0xhjohnson/clacksy/models"
+	"github.com/gofrs/uuid"
 )
 
 func TestRequireAuth(t *testing.T) {
@@ -190,3 +193,190 @@ func TestVerifyPlayed(t *testing.T) {
 		})
 	}
 }
+
+func TestPaginate(t *testing.T) {
+	app := application{pageSize: 10}
+
+	cursor := models.Cursor{ID: uuid.Must(uuid.FromString("05ff139b-8b9a-4341-a161-8628c3e038e7"))}
+
+	tests := map[string]struct {
+		query          string
+		pageSize       int
+		wantStatusCode int
+		wantLimit      int
+		wantAfter      bool
+		wantBefore     bool
+	}{
+		"first page": {
+			query:          "",
+			wantStatusCode: http.StatusOK,
+			wantLimit:      10,
+		},
+		"own page size": {
+			query:          "",
+			pageSize:       20,
+			wantStatusCode: http.StatusOK,
+			wantLimit:      20,
+		},
+		"own page size with limit": {
+			query:          "?limit=5",
+			pageSize:       20,
+			wantStatusCode: http.StatusOK,
+			wantLimit:      5,
+		},
+		"after cursor": {
+			query:          "?after=" + cursor.Encode(),
+			wantStatusCode: http.StatusOK,
+			wantLimit:      10,
+			wantAfter:      true,
+		},
+		"before cursor with limit": {
+			query:          "?before=" + cursor.Encode() + "&limit=25",
+			wantStatusCode: http.StatusOK,
+			wantLimit:      25,
+			wantBefore:     true,
+		},
+		"invalid cursor": {
+			query:          "?after=nope",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		"limit too large": {
+			query:          "?limit=500",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		"limit not a number": {
+			query:          "?limit=ten",
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got models.PageRequest
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Context().Value(pageContextKey).(models.PageRequest)
+				w.WriteHeader(http.StatusOK)
+			})
+
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/vote"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler := app.paginate(next)
+			if tc.pageSize != 0 {
+				handler = app.paginateBy(tc.pageSize)(next)
+			}
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatusCode {
+				t.Fatalf("handler returned wrong status code, got: %d, want: %d", rr.Code, tc.wantStatusCode)
+			}
+			if tc.wantStatusCode != http.StatusOK {
+				return
+			}
+
+			if got.Limit != tc.wantLimit {
+				t.Errorf("wrong limit, got: %d, want: %d", got.Limit, tc.wantLimit)
+			}
+			if (got.After != nil) != tc.wantAfter {
+				t.Errorf("wrong after cursor, got: %v, want set: %t", got.After, tc.wantAfter)
+			}
+			if (got.Before != nil) != tc.wantBefore {
+				t.Errorf("wrong before cursor, got: %v, want set: %t", got.Before, tc.wantBefore)
+			}
+		})
+	}
+}
+
+func TestRequireAccess(t *testing.T) {
+	moderator := models.Access{
+		Role:        models.RoleModerator,
+		Permissions: []string{models.PermModerateReports},
+	}
+	admin := models.Access{
+		Role:        models.RoleAdmin,
+		Permissions: []string{models.PermModerateReports, models.PermAssignRoles},
+	}
+
+	tests := map[string]struct {
+		middleware      func(http.Handler) http.Handler
+		access          models.Access
+		isAuthenticated bool
+		wantStatusCode  int
+	}{
+		"role matches": {
+			middleware:      (&application{}).requireRole(models.RoleModerator),
+			access:          moderator,
+			isAuthenticated: true,
+			wantStatusCode:  http.StatusOK,
+		},
+		"more privileged role": {
+			middleware:      (&application{}).requireRole(models.RoleModerator),
+			access:          admin,
+			isAuthenticated: true,
+			wantStatusCode:  http.StatusOK,
+		},
+		"less privileged role": {
+			middleware:      (&application{}).requireRole(models.RoleAdmin),
+			access:          moderator,
+			isAuthenticated: true,
+			wantStatusCode:  http.StatusNotFound,
+		},
+		"plain user": {
+			middleware:      (&application{}).requireRole(models.RoleModerator),
+			access:          models.Access{Role: models.RoleUser},
+			isAuthenticated: true,
+			wantStatusCode:  http.StatusNotFound,
+		},
+		"unknown role": {
+			middleware:      (&application{}).requireRole("owner"),
+			access:          admin,
+			isAuthenticated: true,
+			wantStatusCode:  http.StatusNotFound,
+		},
+		"has permission": {
+			middleware:      (&application{}).requirePermission(models.PermAssignRoles),
+			access:          admin,
+			isAuthenticated: true,
+			wantStatusCode:  http.StatusOK,
+		},
+		"missing permission": {
+			middleware:      (&application{}).requirePermission(models.PermAssignRoles),
+			access:          moderator,
+			isAuthenticated: true,
+			wantStatusCode:  http.StatusNotFound,
+		},
+		"not authenticated": {
+			middleware:      (&application{}).requirePermission(models.PermModerateReports),
+			access:          admin,
+			isAuthenticated: false,
+			wantStatusCode:  http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			ctx := context.WithValue(context.Background(), isAuthenticatedContextKey, tc.isAuthenticated)
+			ctx = context.WithValue(ctx, accessContextKey, tc.access)
+
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequestWithContext(ctx, "GET", "/admin/roles", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler := tc.middleware(next)
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantStatusCode {
+				t.Errorf("handler returned wrong status code, got: %d, want: %d", rr.Code, tc.wantStatusCode)
+			}
+		})
+	}
+}
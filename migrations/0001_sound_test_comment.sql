@@ -0,0 +1,12 @@
+CREATE TABLE sound_test_comment (
+  sound_test_comment_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  parent_id uuid REFERENCES sound_test_comment (sound_test_comment_id) ON DELETE CASCADE,
+  body text NOT NULL,
+  created timestamptz NOT NULL DEFAULT now(),
+  last_updated timestamptz NOT NULL DEFAULT now(),
+  created_by uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  deleted boolean NOT NULL DEFAULT false
+);
+
+CREATE INDEX sound_test_comment_sound_test_id_idx ON sound_test_comment (sound_test_id, created);
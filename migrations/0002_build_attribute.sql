@@ -0,0 +1,81 @@
+CREATE TABLE build_attribute (
+  build_attribute_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  name text NOT NULL UNIQUE,
+  sort_order integer NOT NULL DEFAULT 0,
+  bonus_round boolean NOT NULL DEFAULT false
+);
+
+CREATE TABLE build_attribute_option (
+  build_attribute_option_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  build_attribute_id uuid NOT NULL REFERENCES build_attribute (build_attribute_id) ON DELETE CASCADE,
+  name text NOT NULL,
+  UNIQUE (build_attribute_id, name),
+  UNIQUE (build_attribute_id, build_attribute_option_id)
+);
+
+CREATE TABLE sound_test_attribute (
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  build_attribute_id uuid NOT NULL,
+  build_attribute_option_id uuid NOT NULL,
+  PRIMARY KEY (sound_test_id, build_attribute_id),
+  FOREIGN KEY (build_attribute_id, build_attribute_option_id)
+    REFERENCES build_attribute_option (build_attribute_id, build_attribute_option_id) ON DELETE CASCADE
+);
+
+CREATE TABLE sound_test_play_attribute (
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  created_by uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  build_attribute_id uuid NOT NULL,
+  build_attribute_option_id uuid NOT NULL,
+  PRIMARY KEY (sound_test_id, created_by, build_attribute_id),
+  FOREIGN KEY (build_attribute_id, build_attribute_option_id)
+    REFERENCES build_attribute_option (build_attribute_id, build_attribute_option_id) ON DELETE CASCADE
+);
+
+INSERT INTO build_attribute (name, sort_order, bonus_round) VALUES
+  ('Keycap profile', 1, true),
+  ('Mounting style', 2, true),
+  ('Case material', 3, false),
+  ('Foam / dampening', 4, false),
+  ('Lube', 5, false),
+  ('Stabilizers', 6, false),
+  ('Recording mic', 7, false);
+
+INSERT INTO build_attribute_option (build_attribute_id, name)
+SELECT ba.build_attribute_id, o.name
+FROM build_attribute ba
+JOIN (VALUES
+  ('Keycap profile', 'Cherry'),
+  ('Keycap profile', 'OEM'),
+  ('Keycap profile', 'SA'),
+  ('Keycap profile', 'DSA'),
+  ('Keycap profile', 'XDA'),
+  ('Keycap profile', 'MT3'),
+  ('Keycap profile', 'KAT'),
+  ('Mounting style', 'Tray'),
+  ('Mounting style', 'Top'),
+  ('Mounting style', 'Gasket'),
+  ('Mounting style', 'Leaf spring'),
+  ('Mounting style', 'Integrated plate'),
+  ('Mounting style', 'O-ring'),
+  ('Case material', 'Aluminum'),
+  ('Case material', 'Polycarbonate'),
+  ('Case material', 'ABS'),
+  ('Case material', 'Acrylic'),
+  ('Case material', 'Wood'),
+  ('Foam / dampening', 'None'),
+  ('Foam / dampening', 'Case foam'),
+  ('Foam / dampening', 'Plate foam'),
+  ('Foam / dampening', 'Case and plate foam'),
+  ('Foam / dampening', 'PE foam mod'),
+  ('Lube', 'Stock'),
+  ('Lube', 'Hand lubed'),
+  ('Lube', 'Factory lubed'),
+  ('Stabilizers', 'Stock'),
+  ('Stabilizers', 'Tuned'),
+  ('Stabilizers', 'Holee modded'),
+  ('Recording mic', 'Phone'),
+  ('Recording mic', 'Condenser'),
+  ('Recording mic', 'Dynamic'),
+  ('Recording mic', 'Lavalier')
+) AS o (attribute, name) ON o.attribute = ba.name;
@@ -0,0 +1,13 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX keyboard_name_trgm_idx ON keyboard USING gin (name gin_trgm_ops);
+CREATE INDEX keyswitch_name_trgm_idx ON keyswitch USING gin (name gin_trgm_ops);
+CREATE INDEX keyswitch_type_name_trgm_idx ON keyswitch_type USING gin (name gin_trgm_ops);
+CREATE INDEX plate_material_name_trgm_idx ON plate_material USING gin (name gin_trgm_ops);
+CREATE INDEX keycap_material_name_trgm_idx ON keycap_material USING gin (name gin_trgm_ops);
+
+CREATE INDEX sound_test_keyboard_id_idx ON sound_test (keyboard_id);
+CREATE INDEX sound_test_keyswitch_id_idx ON sound_test (keyswitch_id);
+CREATE INDEX sound_test_plate_material_id_idx ON sound_test (plate_material_id);
+CREATE INDEX sound_test_keycap_material_id_idx ON sound_test (keycap_material_id);
+CREATE INDEX sound_test_created_by_idx ON sound_test (created_by);
@@ -0,0 +1 @@
+CREATE INDEX sound_test_uploaded_id_idx ON sound_test (uploaded DESC, sound_test_id DESC);
@@ -0,0 +1,8 @@
+ALTER TABLE user_profile ADD COLUMN email_verified timestamptz;
+
+-- Weight of the voter's account when the vote was cast, see models.TrustSignals.
+-- Existing votes keep full weight.
+ALTER TABLE vote ADD COLUMN weight real NOT NULL DEFAULT 1;
+
+CREATE INDEX sound_test_play_created_by_idx ON sound_test_play (created_by);
+CREATE INDEX vote_created_by_idx ON vote (created_by);
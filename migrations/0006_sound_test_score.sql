@@ -0,0 +1,44 @@
+ALTER TABLE vote ADD COLUMN last_updated timestamptz NOT NULL DEFAULT now();
+
+CREATE INDEX vote_last_updated_idx ON vote (last_updated);
+
+-- Lower bound of the 95% Wilson score interval for the share of upvotes.
+CREATE FUNCTION wilson_lower_bound(up float8, down float8) RETURNS float8
+LANGUAGE sql IMMUTABLE AS $$
+  SELECT CASE WHEN up + down <= 0 THEN 0 ELSE
+    ((up + 1.9208) / (up + down)
+      - 1.96 * sqrt((up * down) / (up + down) + 0.9604) / (up + down))
+    / (1 + 3.8416 / (up + down))
+  END
+$$;
+
+-- Net score on a log scale plus an upload time bonus, so every 12.5 hours of
+-- age is worth a factor of ten in votes.
+CREATE FUNCTION hot_score(score float8, uploaded timestamptz) RETURNS float8
+LANGUAGE sql IMMUTABLE AS $$
+  SELECT sign(score) * log(GREATEST(abs(score), 1)) + extract(epoch FROM uploaded) / 45000
+$$;
+
+-- Scores behind the hot, top and rising rankings. Votes are trust weighted,
+-- upvotes and downvotes are raw counts for display.
+CREATE VIEW sound_test_score AS
+SELECT
+  st.sound_test_id,
+  t.upvotes,
+  t.downvotes,
+  t.weighted_upvotes,
+  t.weighted_downvotes,
+  hot_score(t.weighted_upvotes - t.weighted_downvotes, st.uploaded) AS hot,
+  wilson_lower_bound(t.weighted_upvotes, t.weighted_downvotes) AS top,
+  t.recent / sqrt(extract(epoch FROM now() - st.uploaded) / 3600 + 2) AS rising
+FROM sound_test st
+CROSS JOIN LATERAL (
+  SELECT
+    count(*) FILTER (WHERE v.vote_type = 1) AS upvotes,
+    count(*) FILTER (WHERE v.vote_type = -1) AS downvotes,
+    COALESCE(SUM(v.weight) FILTER (WHERE v.vote_type = 1), 0)::float8 AS weighted_upvotes,
+    COALESCE(SUM(v.weight) FILTER (WHERE v.vote_type = -1), 0)::float8 AS weighted_downvotes,
+    COALESCE(SUM(v.vote_type * v.weight) FILTER (WHERE v.last_updated > now() - interval '24 hours'), 0)::float8 AS recent
+  FROM vote v
+  WHERE v.sound_test_id = st.sound_test_id
+) t;
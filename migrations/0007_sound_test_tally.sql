@@ -0,0 +1,45 @@
+-- Vote counts per soundtest, kept up to date by VoteModel.Upsert. Run
+-- clacksy -reconcile-tallies to rebuild them from the vote table.
+CREATE TABLE sound_test_tally (
+  sound_test_id uuid PRIMARY KEY REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  upvotes integer NOT NULL DEFAULT 0,
+  downvotes integer NOT NULL DEFAULT 0,
+  weighted_upvotes float8 NOT NULL DEFAULT 0,
+  weighted_downvotes float8 NOT NULL DEFAULT 0
+);
+
+INSERT INTO sound_test_tally (sound_test_id, upvotes, downvotes, weighted_upvotes, weighted_downvotes)
+SELECT
+  st.sound_test_id,
+  count(v.*) FILTER (WHERE v.vote_type = 1),
+  count(v.*) FILTER (WHERE v.vote_type = -1),
+  COALESCE(SUM(v.weight::float8) FILTER (WHERE v.vote_type = 1), 0),
+  COALESCE(SUM(v.weight::float8) FILTER (WHERE v.vote_type = -1), 0)
+FROM sound_test st
+LEFT JOIN vote v ON v.sound_test_id = st.sound_test_id
+GROUP BY st.sound_test_id;
+
+CREATE INDEX vote_sound_test_id_last_updated_idx ON vote (sound_test_id, last_updated);
+DROP INDEX vote_last_updated_idx;
+
+DROP VIEW sound_test_score;
+
+-- Scores behind the hot, top and rising rankings. Votes are trust weighted,
+-- upvotes and downvotes are raw counts for display.
+CREATE VIEW sound_test_score AS
+SELECT
+  st.sound_test_id,
+  COALESCE(t.upvotes, 0) AS upvotes,
+  COALESCE(t.downvotes, 0) AS downvotes,
+  COALESCE(t.weighted_upvotes, 0) AS weighted_upvotes,
+  COALESCE(t.weighted_downvotes, 0) AS weighted_downvotes,
+  hot_score(COALESCE(t.weighted_upvotes - t.weighted_downvotes, 0), st.uploaded) AS hot,
+  wilson_lower_bound(COALESCE(t.weighted_upvotes, 0), COALESCE(t.weighted_downvotes, 0)) AS top,
+  r.recent / sqrt(extract(epoch FROM now() - st.uploaded) / 3600 + 2) AS rising
+FROM sound_test st
+LEFT JOIN sound_test_tally t ON t.sound_test_id = st.sound_test_id
+CROSS JOIN LATERAL (
+  SELECT COALESCE(SUM(v.vote_type * v.weight::float8), 0) AS recent
+  FROM vote v
+  WHERE v.sound_test_id = st.sound_test_id AND v.last_updated > now() - interval '24 hours'
+) r;
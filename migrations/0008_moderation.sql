@@ -0,0 +1,55 @@
+ALTER TABLE sound_test ADD COLUMN hidden boolean NOT NULL DEFAULT false;
+ALTER TABLE user_profile ADD COLUMN suspended timestamptz;
+
+CREATE TABLE report (
+  report_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  subject_type text NOT NULL CHECK (subject_type IN ('soundtest', 'comment', 'user')),
+  subject_id uuid NOT NULL,
+  reason text NOT NULL CHECK (reason IN ('offensive', 'mislabeled', 'spam', 'other')),
+  details text NOT NULL DEFAULT '',
+  created timestamptz NOT NULL DEFAULT now(),
+  created_by uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  resolved timestamptz,
+  resolved_by uuid REFERENCES user_profile (user_profile_id) ON DELETE SET NULL
+);
+
+CREATE INDEX report_open_idx ON report (created) WHERE resolved IS NULL;
+CREATE INDEX report_subject_idx ON report (subject_type, subject_id);
+
+CREATE TABLE user_warning (
+  user_warning_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_profile_id uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  message text NOT NULL,
+  created timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX user_warning_user_profile_id_idx ON user_warning (user_profile_id, created);
+
+-- Every moderation action, kept even after its subject or moderator is gone.
+CREATE TABLE moderation_log (
+  moderation_log_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  action text NOT NULL,
+  subject_type text NOT NULL,
+  subject_id uuid NOT NULL,
+  report_id uuid,
+  note text NOT NULL DEFAULT '',
+  created timestamptz NOT NULL DEFAULT now(),
+  created_by uuid NOT NULL
+);
+
+CREATE INDEX moderation_log_created_idx ON moderation_log (created DESC);
+
+CREATE FUNCTION moderation_log_immutable() RETURNS trigger
+LANGUAGE plpgsql AS $$
+BEGIN
+  RAISE EXCEPTION 'moderation_log is append only';
+END
+$$;
+
+CREATE TRIGGER moderation_log_immutable
+BEFORE UPDATE OR DELETE ON moderation_log
+FOR EACH ROW EXECUTE FUNCTION moderation_log_immutable();
+
+CREATE TRIGGER moderation_log_no_truncate
+BEFORE TRUNCATE ON moderation_log
+FOR EACH STATEMENT EXECUTE FUNCTION moderation_log_immutable();
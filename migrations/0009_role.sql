@@ -0,0 +1,45 @@
+CREATE TABLE role (
+  role_id text PRIMARY KEY,
+  rank integer NOT NULL UNIQUE
+);
+
+INSERT INTO role (role_id, rank) VALUES
+  ('user', 0),
+  ('moderator', 1),
+  ('admin', 2);
+
+CREATE TABLE permission (
+  permission_id text PRIMARY KEY,
+  description text NOT NULL
+);
+
+INSERT INTO permission (permission_id, description) VALUES
+  ('reports:moderate', 'Work the report queue and take moderation actions'),
+  ('votes:review', 'See the suspicious voting report'),
+  ('moderation-log:view', 'Read the moderation log'),
+  ('soundtests:view-hidden', 'See soundtests hidden by moderators'),
+  ('roles:assign', 'Change user roles');
+
+CREATE TABLE role_permission (
+  role_id text NOT NULL REFERENCES role (role_id) ON DELETE CASCADE,
+  permission_id text NOT NULL REFERENCES permission (permission_id) ON DELETE CASCADE,
+  PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO role_permission (role_id, permission_id) VALUES
+  ('moderator', 'reports:moderate'),
+  ('moderator', 'votes:review'),
+  ('moderator', 'moderation-log:view'),
+  ('moderator', 'soundtests:view-hidden'),
+  ('admin', 'reports:moderate'),
+  ('admin', 'votes:review'),
+  ('admin', 'moderation-log:view'),
+  ('admin', 'soundtests:view-hidden'),
+  ('admin', 'roles:assign');
+
+ALTER TABLE user_profile ADD COLUMN role_id text NOT NULL DEFAULT 'user' REFERENCES role (role_id);
+
+CREATE INDEX user_profile_role_id_idx ON user_profile (role_id) WHERE role_id <> 'user';
+
+-- Role changes made from the command line have no moderator.
+ALTER TABLE moderation_log ALTER COLUMN created_by DROP NOT NULL;
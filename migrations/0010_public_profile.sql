@@ -0,0 +1,10 @@
+ALTER TABLE user_profile ADD COLUMN bio text NOT NULL DEFAULT '';
+ALTER TABLE user_profile ADD COLUMN avatar text;
+ALTER TABLE user_profile ADD COLUMN show_play_history boolean NOT NULL DEFAULT true;
+
+CREATE INDEX IF NOT EXISTS sound_test_featured_on_idx ON sound_test (featured_on) WHERE featured_on IS NOT NULL;
+
+-- Profiles list a user's uploads newest first, which this covers along with
+-- everything the single column index from 0003 did.
+DROP INDEX IF EXISTS sound_test_created_by_idx;
+CREATE INDEX sound_test_created_by_uploaded_idx ON sound_test (created_by, uploaded);
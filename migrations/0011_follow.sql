@@ -0,0 +1,10 @@
+CREATE TABLE follow (
+  follower_id uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  followee_id uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  created timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (follower_id, followee_id),
+  CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follow_followee_id_idx ON follow (followee_id);
+CREATE INDEX sound_test_play_created_by_submitted_idx ON sound_test_play (created_by, submitted);
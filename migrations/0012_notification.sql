@@ -0,0 +1,31 @@
+CREATE TABLE notification (
+  notification_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_profile_id uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  kind text NOT NULL CHECK (kind IN ('featured', 'comment', 'reply', 'votes', 'follower')),
+  sound_test_id uuid REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  comment_id uuid REFERENCES sound_test_comment (sound_test_comment_id) ON DELETE CASCADE,
+  actor_id uuid REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  milestone integer,
+  created timestamptz NOT NULL DEFAULT now(),
+  read timestamptz,
+  emailed timestamptz
+);
+
+CREATE INDEX notification_user_profile_id_idx ON notification (user_profile_id, created DESC);
+CREATE INDEX notification_unread_idx ON notification (user_profile_id) WHERE read IS NULL;
+CREATE INDEX notification_unemailed_idx ON notification (user_profile_id) WHERE emailed IS NULL;
+
+-- Events that can only happen once per subject. Inserts use ON CONFLICT DO
+-- NOTHING so repeating them is harmless.
+CREATE UNIQUE INDEX notification_featured_key ON notification (sound_test_id) WHERE kind = 'featured';
+CREATE UNIQUE INDEX notification_votes_key ON notification (sound_test_id, milestone) WHERE kind = 'votes';
+CREATE UNIQUE INDEX notification_follower_key ON notification (user_profile_id, actor_id) WHERE kind = 'follower';
+
+-- Which kinds of notification a user gets in their email digest. Kinds without
+-- a row use the default in models.DefaultEmailDigest.
+CREATE TABLE notification_preference (
+  user_profile_id uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  kind text NOT NULL,
+  email boolean NOT NULL,
+  PRIMARY KEY (user_profile_id, kind)
+);
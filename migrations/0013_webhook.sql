@@ -0,0 +1,32 @@
+CREATE TABLE webhook (
+  webhook_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  url text NOT NULL,
+  secret text NOT NULL,
+  events text[] NOT NULL,
+  active boolean NOT NULL DEFAULT true,
+  created timestamptz NOT NULL DEFAULT now(),
+  created_by uuid REFERENCES user_profile (user_profile_id) ON DELETE SET NULL
+);
+
+CREATE TABLE webhook_delivery (
+  webhook_delivery_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  webhook_id uuid NOT NULL REFERENCES webhook (webhook_id) ON DELETE CASCADE,
+  event text NOT NULL,
+  payload jsonb NOT NULL,
+  status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+  attempts integer NOT NULL DEFAULT 0,
+  next_attempt timestamptz NOT NULL DEFAULT now(),
+  last_status_code integer,
+  last_error text NOT NULL DEFAULT '',
+  created timestamptz NOT NULL DEFAULT now(),
+  delivered timestamptz
+);
+
+CREATE INDEX webhook_delivery_due_idx ON webhook_delivery (next_attempt) WHERE status = 'pending';
+CREATE INDEX webhook_delivery_webhook_id_idx ON webhook_delivery (webhook_id, created DESC);
+
+INSERT INTO permission (permission_id, description) VALUES
+  ('webhooks:manage', 'Configure outgoing webhooks and read their delivery log');
+
+INSERT INTO role_permission (role_id, permission_id) VALUES
+  ('admin', 'webhooks:manage');
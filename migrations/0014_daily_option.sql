@@ -0,0 +1,9 @@
+CREATE TABLE daily_option (
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  part text NOT NULL CHECK (part IN ('keyboard', 'keyswitch', 'plate-material')),
+  position int NOT NULL,
+  part_id uuid NOT NULL,
+  created timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (sound_test_id, part, position),
+  UNIQUE (sound_test_id, part, part_id)
+);
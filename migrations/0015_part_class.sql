@@ -0,0 +1,22 @@
+-- Classes used to choose plausible distractors for the daily play. Parts left
+-- unclassified are only ever close to each other by keyswitch type or name.
+ALTER TABLE keyboard
+  ADD COLUMN layout text,
+  ADD COLUMN price_class text CHECK (price_class IN ('budget', 'mid', 'premium'));
+
+ALTER TABLE plate_material ADD COLUMN family text CHECK (family IN ('metal', 'polymer', 'composite', 'none'));
+
+UPDATE plate_material SET family = 'metal'
+WHERE name ~* '(alu|brass|steel|copper|titanium|metal)';
+
+UPDATE plate_material SET family = 'polymer'
+WHERE family IS NULL AND name ~* '(pom|polycarbonate|\mpc\M|pp|abs|nylon|pe\M)';
+
+UPDATE plate_material SET family = 'composite'
+WHERE family IS NULL AND name ~* '(fr-?4|carbon|cf\M|g10)';
+
+UPDATE plate_material SET family = 'none'
+WHERE family IS NULL AND name ~* '(plateless|none)';
+
+UPDATE keyboard SET layout = substring(name from '(\d{2,3}%|TKL|tkl|[Ff]ull[ -]?[Ss]ize)')
+WHERE name ~ '(\d{2,3}%|TKL|tkl|[Ff]ull[ -]?[Ss]ize)';
@@ -0,0 +1,37 @@
+ALTER TABLE sound_test_play ADD COLUMN hard_mode boolean NOT NULL DEFAULT false;
+
+-- Other names a part goes by, matched when typing guesses in hard mode.
+CREATE TABLE part_alias (
+  part text NOT NULL CHECK (part IN ('keyboard', 'keyswitch', 'plate-material', 'keycap-material')),
+  part_id uuid NOT NULL,
+  alias text NOT NULL,
+  created timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (part, alias)
+);
+
+CREATE INDEX part_alias_part_id_idx ON part_alias (part, part_id);
+
+INSERT INTO part_alias (part, part_id, alias)
+SELECT 'plate-material', plate_material_id, alias
+FROM plate_material
+JOIN (VALUES
+  ('aluminum', 'alu'),
+  ('aluminum', 'aluminium'),
+  ('polycarbonate', 'pc'),
+  ('carbon fiber', 'cf'),
+  ('carbon fiber', 'carbon fibre'),
+  ('fr4', 'fr-4')
+) a (material, alias) ON lower(name) = a.material
+ON CONFLICT DO NOTHING;
+
+INSERT INTO part_alias (part, part_id, alias)
+SELECT 'keyswitch', keyswitch_id, alias
+FROM keyswitch
+JOIN (VALUES
+  ('holy panda', 'hp'),
+  ('cherry mx blue', 'mx blue'),
+  ('cherry mx brown', 'mx brown'),
+  ('cherry mx red', 'mx red'),
+  ('cherry mx black', 'mx black')
+) a (switch, alias) ON lower(name) = a.switch
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,20 @@
+ALTER TABLE sound_test_play
+  ADD COLUMN mode text NOT NULL DEFAULT 'classic' CHECK (mode IN ('classic', 'hard', 'hints')),
+  ADD COLUMN attempts int NOT NULL DEFAULT 1;
+
+UPDATE sound_test_play SET mode = 'hard' WHERE hard_mode;
+
+ALTER TABLE sound_test_play DROP COLUMN hard_mode;
+
+-- Every guess made in hints mode, the last one is also the play.
+CREATE TABLE sound_test_attempt (
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  created_by uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  attempt int NOT NULL CHECK (attempt > 0),
+  keyboard_id uuid NOT NULL REFERENCES keyboard (keyboard_id),
+  plate_material_id uuid NOT NULL REFERENCES plate_material (plate_material_id),
+  keycap_material_id uuid NOT NULL REFERENCES keycap_material (keycap_material_id),
+  keyswitch_id uuid NOT NULL REFERENCES keyswitch (keyswitch_id),
+  submitted timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (sound_test_id, created_by, attempt)
+);
@@ -0,0 +1,17 @@
+-- Daily plays by visitors without an account, identified by a signed cookie.
+-- They're copied into sound_test_play when the visitor logs in.
+CREATE TABLE guest_play (
+  guest_id uuid NOT NULL,
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  submitted timestamptz NOT NULL DEFAULT now(),
+  keyboard_id uuid NOT NULL REFERENCES keyboard (keyboard_id),
+  plate_material_id uuid NOT NULL REFERENCES plate_material (plate_material_id),
+  keycap_material_id uuid NOT NULL REFERENCES keycap_material (keycap_material_id),
+  keyswitch_id uuid NOT NULL REFERENCES keyswitch (keyswitch_id),
+  mode text NOT NULL CHECK (mode IN ('classic', 'hard')),
+  attempts int NOT NULL DEFAULT 1,
+  attributes jsonb NOT NULL DEFAULT '{}',
+  claimed_by uuid REFERENCES user_profile (user_profile_id) ON DELETE SET NULL,
+  claimed timestamptz,
+  PRIMARY KEY (guest_id, sound_test_id)
+);
@@ -0,0 +1,19 @@
+-- The IANA timezone a user plays and reads dates in, NULL until they've
+-- visited with a browser that reports one or picked one on their profile.
+ALTER TABLE user_profile ADD COLUMN timezone text;
+
+-- Sounds of the day are keyed by calendar date so every player gets the one
+-- for their local date, featured_on stays as when it was picked.
+ALTER TABLE sound_test ADD COLUMN daily_date date UNIQUE;
+
+UPDATE sound_test st
+SET daily_date = d.day
+FROM (
+  SELECT DISTINCT ON ((featured_on AT TIME ZONE 'UTC')::date)
+    sound_test_id,
+    (featured_on AT TIME ZONE 'UTC')::date AS day
+  FROM sound_test
+  WHERE featured_on IS NOT NULL
+  ORDER BY (featured_on AT TIME ZONE 'UTC')::date, featured_on DESC
+) d
+WHERE st.sound_test_id = d.sound_test_id;
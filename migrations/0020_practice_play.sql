@@ -0,0 +1,12 @@
+-- Guesses made in practice mode, which plays soundtests that were never the
+-- sound of the day. Each user practices with a soundtest once.
+CREATE TABLE practice_play (
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  created_by uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  keyboard_id uuid NOT NULL REFERENCES keyboard (keyboard_id),
+  plate_material_id uuid NOT NULL REFERENCES plate_material (plate_material_id),
+  keycap_material_id uuid NOT NULL REFERENCES keycap_material (keycap_material_id),
+  keyswitch_id uuid NOT NULL REFERENCES keyswitch (keyswitch_id),
+  submitted timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (sound_test_id, created_by)
+);
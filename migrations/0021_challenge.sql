@@ -0,0 +1,27 @@
+-- A player challenging someone to a soundtest with a link. The opponent is
+-- whoever answers through the link first.
+CREATE TABLE challenge (
+  challenge_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  created_by uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  opponent_id uuid REFERENCES user_profile (user_profile_id) ON DELETE SET NULL,
+  created timestamptz NOT NULL DEFAULT now(),
+  CHECK (opponent_id <> created_by)
+);
+
+CREATE INDEX challenge_created_by_idx ON challenge (created_by, created DESC);
+CREATE INDEX challenge_opponent_id_idx ON challenge (opponent_id, created DESC);
+
+-- Each player's answer to a soundtest they've been challenged on, used by
+-- every challenge on it. A daily or practice play of the soundtest is copied
+-- here rather than answering again.
+CREATE TABLE challenge_play (
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  created_by uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  keyboard_id uuid NOT NULL REFERENCES keyboard (keyboard_id),
+  plate_material_id uuid NOT NULL REFERENCES plate_material (plate_material_id),
+  keycap_material_id uuid NOT NULL REFERENCES keycap_material (keycap_material_id),
+  keyswitch_id uuid NOT NULL REFERENCES keyswitch (keyswitch_id),
+  submitted timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (sound_test_id, created_by)
+);
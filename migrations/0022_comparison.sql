@@ -0,0 +1,27 @@
+-- Blind A/B comparisons, a user picking which of two soundtests sounds better
+-- or is thockier. Each user judges a pair once per criterion and their
+-- choice is weighted by their trust like votes are.
+CREATE TABLE comparison (
+  comparison_id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  criterion text NOT NULL CHECK (criterion IN ('better', 'thock')),
+  winner_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  loser_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  weight real NOT NULL DEFAULT 1,
+  created_by uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  created timestamptz NOT NULL DEFAULT now(),
+  CHECK (winner_id <> loser_id)
+);
+
+CREATE UNIQUE INDEX comparison_pair_key ON comparison (created_by, criterion, least(winner_id, loser_id), greatest(winner_id, loser_id));
+
+-- Ratings fitted to every comparison by -rate-comparisons, for soundtests and
+-- for the switches and keyboards in them.
+CREATE TABLE rating (
+  subject text NOT NULL CHECK (subject IN ('soundtest', 'keyswitch', 'keyboard')),
+  subject_id uuid NOT NULL,
+  criterion text NOT NULL CHECK (criterion IN ('better', 'thock')),
+  rating float8 NOT NULL,
+  comparisons int NOT NULL,
+  updated timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (subject, criterion, subject_id)
+);
@@ -0,0 +1,41 @@
+-- Recent trust weighted net votes per soundtest for the rising ranking, kept
+-- by VoteModel.Upsert so ranking doesn't scan the vote table. The sum halves
+-- every 12 hours since recent_at.
+ALTER TABLE sound_test_tally
+  ADD COLUMN recent float8 NOT NULL DEFAULT 0,
+  ADD COLUMN recent_at timestamptz NOT NULL DEFAULT now();
+
+-- recent as of now, decayed from when it was last updated.
+CREATE FUNCTION decay_recent(recent float8, recent_at timestamptz) RETURNS float8
+LANGUAGE sql STABLE AS $$
+  SELECT recent * power(0.5, extract(epoch FROM now() - recent_at) / 43200)
+$$;
+
+UPDATE sound_test_tally t
+SET recent = v.recent, recent_at = now()
+FROM (
+  SELECT sound_test_id, SUM(decay_recent(vote_type * weight::float8, last_updated)) AS recent
+  FROM vote
+  GROUP BY sound_test_id
+) v
+WHERE v.sound_test_id = t.sound_test_id;
+
+DROP VIEW sound_test_score;
+
+-- Scores behind the hot, top and rising rankings. Votes are trust weighted,
+-- upvotes and downvotes are raw counts for display.
+CREATE VIEW sound_test_score AS
+SELECT
+  st.sound_test_id,
+  COALESCE(t.upvotes, 0) AS upvotes,
+  COALESCE(t.downvotes, 0) AS downvotes,
+  COALESCE(t.weighted_upvotes, 0) AS weighted_upvotes,
+  COALESCE(t.weighted_downvotes, 0) AS weighted_downvotes,
+  hot_score(COALESCE(t.weighted_upvotes - t.weighted_downvotes, 0), st.uploaded) AS hot,
+  wilson_lower_bound(COALESCE(t.weighted_upvotes, 0), COALESCE(t.weighted_downvotes, 0)) AS top,
+  COALESCE(decay_recent(t.recent, t.recent_at), 0) / sqrt(extract(epoch FROM now() - st.uploaded) / 3600 + 2) AS rising
+FROM sound_test st
+LEFT JOIN sound_test_tally t ON t.sound_test_id = st.sound_test_id;
+
+-- Only the rising ranking's scan of recent votes used this.
+DROP INDEX vote_sound_test_id_last_updated_idx;
@@ -0,0 +1,14 @@
+-- A snapshot of the scores ranked listings sort by, refreshed every few
+-- minutes by the server. Live scores move with every vote and rising ones
+-- with the clock, so paging by them would skip or repeat soundtests.
+CREATE MATERIALIZED VIEW sound_test_rank AS
+SELECT
+  sound_test_id,
+  hot,
+  top,
+  rising,
+  (upvotes + downvotes)::float8 / GREATEST(abs(upvotes - downvotes), 1) AS controversial
+FROM sound_test_score;
+
+-- Needed to refresh it concurrently.
+CREATE UNIQUE INDEX sound_test_rank_sound_test_id_idx ON sound_test_rank (sound_test_id);
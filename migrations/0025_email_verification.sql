@@ -0,0 +1,11 @@
+-- Links emailed to users to confirm they own their address, which sets
+-- user_profile.email_verified. Only a hash of each link's token is kept, and
+-- a link only confirms the address it was sent to.
+CREATE TABLE email_verification (
+  token_hash bytea PRIMARY KEY,
+  user_profile_id uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  email text NOT NULL,
+  expires timestamptz NOT NULL
+);
+
+CREATE INDEX email_verification_user_profile_id_idx ON email_verification (user_profile_id);
@@ -0,0 +1,25 @@
+-- 0015 added keyboard.price_class without filling it in. Class keyboards by
+-- maker and model, more specific names first, so distractors can match on
+-- price as well as layout. Anything unmatched, or added later, stays unclassed
+-- and is only close to other keyboards by layout.
+UPDATE keyboard SET price_class = 'premium'
+WHERE name ~* '(keycult|\mtgr\M|\mrama\M|\mmode\M|satisfaction ?75|\mgeon\M|\mmatrix\M|wilba|\msinga\M|\mjris\M|space ?65|owlab|\mu80\M|\mfrog\M|bauer|mekanisk|kbd8x|think ?6\.5)';
+
+UPDATE keyboard SET price_class = 'mid'
+WHERE price_class IS NULL AND name ~* '(gmmk ?pro|keychron ?q[0-9]|monsgeek ?m[0-9]|ducky|leopold|varmilo|\mdrop\M|massdrop|nuphy|kbdfans|\mkbd ?67|idobao|\mtofu|\mzoom ?[0-9]|\mqk ?[0-9]|\mneo ?[0-9]|wooting|cannonkeys)';
+
+UPDATE keyboard SET price_class = 'budget'
+WHERE price_class IS NULL AND name ~* '(keychron|\makko\M|royal ?kludge|\mrk ?[0-9]|redragon|epomaker|\mgmmk\M|glorious|womier|tecware|ajazz|monsgeek|\mxvx\M|logitech|razer|corsair|hyperx|steelseries)';
+
+-- 0015 classed any plate with "pp" anywhere or a word ending in "pe" in its
+-- name as a polymer. Reclassify with whole words and full names only.
+UPDATE plate_material SET family = NULL WHERE family = 'polymer';
+
+UPDATE plate_material SET family = 'polymer'
+WHERE family IS NULL AND name ~* '(\m(pom|pc|pp|pe|hdpe|uhmwpe|abs)\M|polycarbonate|polypropylene|polyethylene|polyoxymethylene|delrin|nylon|acrylic|acetal)';
+
+UPDATE plate_material SET family = 'composite'
+WHERE family IS NULL AND name ~* '(fr-?4|carbon|cf\M|g10)';
+
+UPDATE plate_material SET family = 'none'
+WHERE family IS NULL AND name ~* '(plateless|none)';
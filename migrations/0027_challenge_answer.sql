@@ -0,0 +1,32 @@
+-- Each player's answer to a soundtest for challenges: the first of their
+-- challenge, daily and practice plays of it, in hints mode their first guess
+-- before any hints. Daily and practice plays used to be copied into
+-- challenge_play the first time a challenge was viewed.
+CREATE VIEW challenge_answer AS
+SELECT DISTINCT ON (sound_test_id, created_by)
+  sound_test_id,
+  created_by,
+  keyboard_id,
+  plate_material_id,
+  keycap_material_id,
+  keyswitch_id,
+  submitted
+FROM (
+  SELECT sound_test_id, created_by, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id, submitted
+  FROM challenge_play
+  UNION ALL
+  SELECT
+    stp.sound_test_id,
+    stp.created_by,
+    COALESCE(a.keyboard_id, stp.keyboard_id),
+    COALESCE(a.plate_material_id, stp.plate_material_id),
+    COALESCE(a.keycap_material_id, stp.keycap_material_id),
+    COALESCE(a.keyswitch_id, stp.keyswitch_id),
+    COALESCE(a.submitted, stp.submitted)
+  FROM sound_test_play stp
+  LEFT JOIN sound_test_attempt a ON a.sound_test_id = stp.sound_test_id AND a.created_by = stp.created_by AND a.attempt = 1
+  UNION ALL
+  SELECT sound_test_id, created_by, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id, submitted
+  FROM practice_play
+) answers
+ORDER BY sound_test_id, created_by, submitted;
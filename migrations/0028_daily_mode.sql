@@ -0,0 +1,10 @@
+-- The most revealing mode each player has seen the sound of the day in. A
+-- soundtest is only featured on one day, so this is per player and date, and
+-- unlike the session it follows the player to other browsers.
+CREATE TABLE daily_mode (
+  sound_test_id uuid NOT NULL REFERENCES sound_test (sound_test_id) ON DELETE CASCADE,
+  created_by uuid NOT NULL REFERENCES user_profile (user_profile_id) ON DELETE CASCADE,
+  mode text NOT NULL CHECK (mode IN ('classic', 'hard', 'hints')),
+  seen timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (sound_test_id, created_by)
+);
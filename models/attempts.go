@@ -0,0 +1,275 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+)
+
+// Play modes. Classic picks from the day's options, hard types guesses and
+// hints allows MaxAttempts picks with a hint after each wrong one. Hints mode
+// only says how many parts a wrong pick got right, not which, so the options
+// can't simply be ruled out one attempt at a time.
+const (
+	PlayModeClassic = "classic"
+	PlayModeHard    = "hard"
+	PlayModeHints   = "hints"
+)
+
+var PlayModes = []string{PlayModeClassic, PlayModeHard, PlayModeHints}
+
+// modeReveals orders play modes by how much of the answer they show before
+// the first guess.
+var modeReveals = []string{PlayModeHard, PlayModeHints, PlayModeClassic}
+
+func modeReveal(mode string) int {
+	for i, m := range modeReveals {
+		if m == mode {
+			return i
+		}
+	}
+	return -1
+}
+
+// CanSwitchMode reports whether a player who has seen the day's sound in mode
+// from can go on to play it in mode to. Switching to a mode that shows less,
+// like from the classic options to hard mode, would let them play it knowing
+// more than the mode allows.
+func CanSwitchMode(from, to string) bool {
+	return modeReveal(to) >= modeReveal(from)
+}
+
+// GetSeenMode returns the mode userID has seen soundtestID in, or an empty
+// string if they haven't seen it yet.
+func (m *SoundTestModel) GetSeenMode(soundtestID uuid.UUID, userID string) (string, error) {
+	var mode string
+
+	stmt := `SELECT mode FROM daily_mode WHERE sound_test_id = $1 AND created_by = $2`
+
+	err := m.DB.QueryRow(context.Background(), stmt, soundtestID, userID).Scan(&mode)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", err
+	}
+
+	return mode, nil
+}
+
+// SetSeenMode records that userID has seen soundtestID in mode. A mode that
+// shows less than one already seen is ignored, so a page loaded in an older
+// tab can't unlock it again.
+func (m *SoundTestModel) SetSeenMode(soundtestID uuid.UUID, userID, mode string) error {
+	stmt := `INSERT INTO daily_mode (sound_test_id, created_by, mode)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (sound_test_id, created_by) DO UPDATE
+		SET mode = EXCLUDED.mode, seen = now()
+		WHERE array_position($4::text[], EXCLUDED.mode) >= array_position($4::text[], daily_mode.mode)`
+
+	_, err := m.DB.Exec(context.Background(), stmt, soundtestID, userID, mode, modeReveals)
+	return err
+}
+
+// MaxAttempts is how many guesses a hints mode play gets, one more than there
+// are hints so the last guess is made with every hint shown.
+const MaxAttempts = 5
+
+// Hints unlocked one at a time in hints mode, in this order.
+const (
+	HintSwitchType = iota + 1
+	HintPlateFamily
+	HintFullClip
+	HintSpectrogram
+)
+
+// PlayPoints scores a play. Classic and hard plays score a point per correct
+// part. In hints mode each correct part is worth one point for every attempt
+// left unused, plus one.
+func PlayPoints(mode string, correct, attempts int) int {
+	if mode != PlayModeHints || attempts < 1 || attempts > MaxAttempts {
+		return correct
+	}
+	return correct * (MaxAttempts + 1 - attempts)
+}
+
+// Attempt is one hints mode guess and which parts it got right.
+type Attempt struct {
+	Number                int
+	Keyboard              string
+	KeyboardCorrect       bool
+	Keyswitch             string
+	KeyswitchCorrect      bool
+	PlateMaterial         string
+	PlateMaterialCorrect  bool
+	KeycapMaterial        string
+	KeycapMaterialCorrect bool
+	Submitted             time.Time
+}
+
+func (a Attempt) Correct() int {
+	correct := 0
+	for _, ok := range []bool{a.KeyboardCorrect, a.KeyswitchCorrect, a.PlateMaterialCorrect, a.KeycapMaterialCorrect} {
+		if ok {
+			correct++
+		}
+	}
+	return correct
+}
+
+// AddAttempt stores a hints mode guess. The play ends, and is stored as the
+// user's play, when every part is right or it was the last attempt, in which
+// case finished is true. ErrPlayOver is returned if the user has already
+// finished playing the soundtest and ErrDuplicateAttempt if another guess
+// was stored at the same time.
+func (m *SoundTestModel) AddAttempt(soundtestID uuid.UUID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch string, attributes map[string]string) (attempt int, finished bool, err error) {
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var played bool
+
+	err = tx.QueryRow(context.Background(), "SELECT EXISTS (SELECT true FROM sound_test_play WHERE sound_test_id = $1 AND created_by = $2)", soundtestID, userID).Scan(&played)
+	if err != nil {
+		return 0, false, err
+	}
+	if played {
+		return 0, false, ErrPlayOver
+	}
+
+	var correct int
+
+	stmt := `INSERT INTO sound_test_attempt (sound_test_id, created_by, attempt, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id)
+		SELECT $1, $2, COALESCE(max(attempt), 0) + 1, $3, $4, $5, $6
+		FROM sound_test_attempt
+		WHERE sound_test_id = $1 AND created_by = $2
+		RETURNING
+			attempt,
+			(keyboard_id = (SELECT keyboard_id FROM sound_test WHERE sound_test_id = $1))::int
+			+ (plate_material_id = (SELECT plate_material_id FROM sound_test WHERE sound_test_id = $1))::int
+			+ (keycap_material_id = (SELECT keycap_material_id FROM sound_test WHERE sound_test_id = $1))::int
+			+ (keyswitch_id = (SELECT keyswitch_id FROM sound_test WHERE sound_test_id = $1))::int`
+
+	// Two guesses submitted at once both number themselves after the same
+	// last attempt, the primary key makes the second fail.
+	err = tx.QueryRow(context.Background(), stmt, soundtestID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch).Scan(&attempt, &correct)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return 0, false, ErrDuplicateAttempt
+		}
+		return 0, false, err
+	}
+
+	if attempt > MaxAttempts {
+		return 0, false, ErrPlayOver
+	}
+
+	if correct == PartsPerPlay || attempt == MaxAttempts {
+		err = addPlay(tx, soundtestID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch, PlayModeHints, attempt, attributes)
+		if err != nil {
+			return 0, false, err
+		}
+		finished = true
+	}
+
+	return attempt, finished, tx.Commit(context.Background())
+}
+
+func (m *SoundTestModel) GetAttempts(soundtestID uuid.UUID, userID string) ([]Attempt, error) {
+	var attempts []Attempt
+
+	stmt := `SELECT
+			a.attempt,
+			k.name,
+			a.keyboard_id = st.keyboard_id,
+			ks.name,
+			a.keyswitch_id = st.keyswitch_id,
+			pm.name,
+			a.plate_material_id = st.plate_material_id,
+			km.name,
+			a.keycap_material_id = st.keycap_material_id,
+			a.submitted
+		FROM sound_test_attempt a
+		JOIN sound_test st USING (sound_test_id)
+		JOIN keyboard k ON k.keyboard_id = a.keyboard_id
+		JOIN keyswitch ks ON ks.keyswitch_id = a.keyswitch_id
+		JOIN plate_material pm ON pm.plate_material_id = a.plate_material_id
+		JOIN keycap_material km ON km.keycap_material_id = a.keycap_material_id
+		WHERE a.sound_test_id = $1 AND a.created_by = $2
+		ORDER BY a.attempt`
+
+	rows, err := m.DB.Query(context.Background(), stmt, soundtestID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a Attempt
+
+		err := rows.Scan(&a.Number, &a.Keyboard, &a.KeyboardCorrect, &a.Keyswitch, &a.KeyswitchCorrect, &a.PlateMaterial, &a.PlateMaterialCorrect, &a.KeycapMaterial, &a.KeycapMaterialCorrect, &a.Submitted)
+		if err != nil {
+			return nil, err
+		}
+
+		attempts = append(attempts, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// Hints are the clues given in hints mode. Empty fields are unknown or not
+// revealed yet.
+type Hints struct {
+	SwitchType  string
+	PlateFamily string
+	FullClip    bool
+	Spectrogram bool
+}
+
+// Reveal keeps the first n hints, the ones unlocked after n wrong attempts.
+func (h Hints) Reveal(n int) Hints {
+	var r Hints
+	if n >= HintSwitchType {
+		r.SwitchType = h.SwitchType
+	}
+	if n >= HintPlateFamily {
+		r.PlateFamily = h.PlateFamily
+	}
+	r.FullClip = n >= HintFullClip
+	r.Spectrogram = n >= HintSpectrogram
+	return r
+}
+
+// GetHints returns every hint for a soundtest, unrevealed.
+func (m *SoundTestModel) GetHints(soundtestID uuid.UUID) (Hints, error) {
+	var h Hints
+
+	stmt := `SELECT kt.name, COALESCE(pm.family, '')
+		FROM sound_test st
+		JOIN keyswitch k ON k.keyswitch_id = st.keyswitch_id
+		JOIN keyswitch_type kt ON kt.keyswitch_type_id = k.keyswitch_type_id
+		JOIN plate_material pm ON pm.plate_material_id = st.plate_material_id
+		WHERE st.sound_test_id = $1`
+
+	err := m.DB.QueryRow(context.Background(), stmt, soundtestID).Scan(&h.SwitchType, &h.PlateFamily)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return h, ErrNoRecord
+		}
+		return h, err
+	}
+	h.FullClip = true
+	h.Spectrogram = true
+
+	return h, nil
+}
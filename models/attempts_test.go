@@ -0,0 +1,76 @@
+package models
+
+import "testing"
+
+func TestPlayPoints(t *testing.T) {
+	tests := map[string]struct {
+		mode     string
+		correct  int
+		attempts int
+		want     int
+	}{
+		"classic":             {mode: PlayModeClassic, correct: 3, attempts: 1, want: 3},
+		"hard":                {mode: PlayModeHard, correct: 4, attempts: 1, want: 4},
+		"hints first attempt": {mode: PlayModeHints, correct: 4, attempts: 1, want: 4 * MaxAttempts},
+		"hints last attempt":  {mode: PlayModeHints, correct: 4, attempts: MaxAttempts, want: 4},
+		"hints ran out":       {mode: PlayModeHints, correct: 2, attempts: MaxAttempts, want: 2},
+		"hints bad attempts":  {mode: PlayModeHints, correct: 2, attempts: 0, want: 2},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := PlayPoints(tc.mode, tc.correct, tc.attempts); got != tc.want {
+				t.Errorf("got: %d, want: %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHintsReveal(t *testing.T) {
+	all := Hints{SwitchType: "Linear", PlateFamily: "metal", FullClip: true, Spectrogram: true}
+
+	tests := []struct {
+		n    int
+		want Hints
+	}{
+		{0, Hints{}},
+		{1, Hints{SwitchType: "Linear"}},
+		{2, Hints{SwitchType: "Linear", PlateFamily: "metal"}},
+		{3, Hints{SwitchType: "Linear", PlateFamily: "metal", FullClip: true}},
+		{MaxAttempts, all},
+	}
+
+	for _, tc := range tests {
+		if got := all.Reveal(tc.n); got != tc.want {
+			t.Errorf("Reveal(%d) got: %+v, want: %+v", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestAttemptCorrect(t *testing.T) {
+	a := Attempt{KeyboardCorrect: true, PlateMaterialCorrect: true}
+	if got := a.Correct(); got != 2 {
+		t.Errorf("got: %d, want: 2", got)
+	}
+}
+
+func TestCanSwitchMode(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{PlayModeClassic, PlayModeClassic, true},
+		{PlayModeClassic, PlayModeHard, false},
+		{PlayModeClassic, PlayModeHints, false},
+		{PlayModeHints, PlayModeClassic, true},
+		{PlayModeHints, PlayModeHard, false},
+		{PlayModeHard, PlayModeHints, true},
+		{PlayModeHard, PlayModeClassic, true},
+	}
+
+	for _, tc := range tests {
+		if got := CanSwitchMode(tc.from, tc.to); got != tc.want {
+			t.Errorf("CanSwitchMode(%q, %q) got: %v, want: %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type ChallengeModel struct {
+	DB *pgxpool.Pool
+}
+
+type Challenge struct {
+	ID          uuid.UUID
+	SoundTest   SoundTest
+	CreatedByID uuid.UUID
+	CreatedBy   string
+	OpponentID  *uuid.UUID
+	Opponent    string
+	Created     time.Time
+}
+
+// ChallengeResult is a challenge as one of its players sees it in their
+// history. Scores are nil for players who haven't answered yet.
+type ChallengeResult struct {
+	ID            uuid.UUID
+	SoundTestID   uuid.UUID
+	Created       time.Time
+	Opponent      string
+	Score         *int
+	OpponentScore *int
+}
+
+// Outcome is "won", "lost" or "tied" once both players have answered.
+func (c ChallengeResult) Outcome() string {
+	switch {
+	case c.Score == nil || c.OpponentScore == nil:
+		return ""
+	case *c.Score > *c.OpponentScore:
+		return "won"
+	case *c.Score < *c.OpponentScore:
+		return "lost"
+	default:
+		return "tied"
+	}
+}
+
+// challengePlayColumns and challengePlayJoins grade the challenge_answer cp.
+const (
+	challengePlayColumns = `cp.sound_test_id,
+		st.url,
+		cp.submitted,
+		COALESCE(up.username, 'anonymous'),
+		k.name,
+		ck.name,
+		pm.name,
+		cpm.name,
+		km.name,
+		ckm.name,
+		ks.name,
+		cks.name`
+
+	challengePlayJoins = `JOIN sound_test st USING (sound_test_id)
+		JOIN user_profile up ON st.created_by = up.user_profile_id
+		JOIN keyboard k ON cp.keyboard_id = k.keyboard_id
+		JOIN keyboard ck ON st.keyboard_id = ck.keyboard_id
+		JOIN plate_material pm ON cp.plate_material_id = pm.plate_material_id
+		JOIN plate_material cpm ON st.plate_material_id = cpm.plate_material_id
+		JOIN keycap_material km ON cp.keycap_material_id = km.keycap_material_id
+		JOIN keycap_material ckm ON st.keycap_material_id = ckm.keycap_material_id
+		JOIN keyswitch ks ON cp.keyswitch_id = ks.keyswitch_id
+		JOIN keyswitch cks ON st.keyswitch_id = cks.keyswitch_id`
+)
+
+// challengeScore counts the parts the challenge_answer alias got right, NULL
+// if there's no answer.
+func challengeScore(alias string) string {
+	return `(` + alias + `.keyboard_id = st.keyboard_id)::int
+		+ (` + alias + `.plate_material_id = st.plate_material_id)::int
+		+ (` + alias + `.keycap_material_id = st.keycap_material_id)::int
+		+ (` + alias + `.keyswitch_id = st.keyswitch_id)::int`
+}
+
+func (m *ChallengeModel) Insert(soundtestID, userID string) (uuid.UUID, error) {
+	var challengeID uuid.UUID
+
+	stmt := `INSERT INTO challenge (sound_test_id, created_by)
+		VALUES ($1, $2)
+		RETURNING challenge_id`
+
+	err := m.DB.QueryRow(context.Background(), stmt, soundtestID, userID).Scan(&challengeID)
+	return challengeID, err
+}
+
+func (m *ChallengeModel) Get(challengeID string) (Challenge, error) {
+	var c Challenge
+
+	stmt := `SELECT
+		  c.challenge_id,
+		  st.sound_test_id,
+		  st.url,
+		  st.uploaded,
+		  st.last_updated,
+		  st.keyboard_id,
+		  st.plate_material_id,
+		  st.keycap_material_id,
+		  st.keyswitch_id,
+		  st.created_by,
+		  st.featured_on,
+		  st.daily_date,
+		  c.created_by,
+		  COALESCE(cu.username, 'anonymous'),
+		  c.opponent_id,
+		  CASE WHEN c.opponent_id IS NULL THEN '' ELSE COALESCE(ou.username, 'anonymous') END,
+		  c.created
+		FROM challenge c
+		JOIN sound_test st USING (sound_test_id)
+		JOIN user_profile cu ON cu.user_profile_id = c.created_by
+		LEFT JOIN user_profile ou ON ou.user_profile_id = c.opponent_id
+		WHERE c.challenge_id = $1`
+
+	st := &c.SoundTest
+	err := m.DB.QueryRow(context.Background(), stmt, challengeID).Scan(&c.ID, &st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.KeyboardID, &st.PlateMaterialID, &st.KeycapMaterialID, &st.KeyswitchID, &st.CreatedBy, &st.FeaturedOn, &st.DailyDate, &c.CreatedByID, &c.CreatedBy, &c.OpponentID, &c.Opponent, &c.Created)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c, ErrNoRecord
+		}
+		return c, err
+	}
+
+	return c, nil
+}
+
+// SetOpponent makes userID the challenge's opponent unless someone already
+// is, or they made it.
+func (m *ChallengeModel) SetOpponent(challengeID, userID string) error {
+	stmt := `UPDATE challenge
+		SET opponent_id = $2
+		WHERE challenge_id = $1 AND opponent_id IS NULL AND created_by <> $2`
+
+	_, err := m.DB.Exec(context.Background(), stmt, challengeID, userID)
+	return err
+}
+
+// GetAnswer gets userID's graded answer to soundtestID for challenges, the
+// first of their challenge, daily and practice plays of it. In hints mode it's
+// their first guess before any hints. ErrNoRecord is returned if they haven't
+// answered.
+func (m *ChallengeModel) GetAnswer(soundtestID, userID string) (SoundTestPlay, error) {
+	p := SoundTestPlay{Mode: PlayModeClassic, Attempts: 1}
+
+	stmt := `SELECT ` + challengePlayColumns + `
+		FROM challenge_answer cp
+		` + challengePlayJoins + `
+		WHERE cp.sound_test_id = $1 AND cp.created_by = $2`
+
+	err := m.DB.QueryRow(context.Background(), stmt, soundtestID, userID).Scan(&p.SoundTestID, &p.URL, &p.Submitted, &p.CreatedBy, &p.Keyboard, &p.CorrectKeyboard, &p.PlateMaterial, &p.CorrectPlateMaterial, &p.KeycapMaterial, &p.CorrectKeycapMaterial, &p.Keyswitch, &p.CorrectKeyswitch)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return p, ErrNoRecord
+		}
+		return p, err
+	}
+
+	return p, nil
+}
+
+// AddAnswer stores userID's answer to soundtest for challenges and returns it
+// graded. ErrPlayOver is returned if they've already answered, including by
+// playing it daily or in practice.
+func (m *ChallengeModel) AddAnswer(soundtest uuid.UUID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch string) (SoundTestPlay, error) {
+	p := SoundTestPlay{Mode: PlayModeClassic, Attempts: 1}
+
+	stmt := `WITH play AS (
+			INSERT INTO challenge_play (sound_test_id, created_by, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id)
+			SELECT $1::uuid, $2::uuid, $3::uuid, $4::uuid, $5::uuid, $6::uuid
+			WHERE NOT EXISTS (
+			  SELECT true
+			  FROM challenge_answer
+			  WHERE sound_test_id = $1 AND created_by = $2
+			)
+			RETURNING *
+		)
+		SELECT ` + challengePlayColumns + `
+		FROM play cp
+		` + challengePlayJoins
+
+	err := m.DB.QueryRow(context.Background(), stmt, soundtest, userID, keyboard, plateMaterial, keycapMaterial, keyswitch).Scan(&p.SoundTestID, &p.URL, &p.Submitted, &p.CreatedBy, &p.Keyboard, &p.CorrectKeyboard, &p.PlateMaterial, &p.CorrectPlateMaterial, &p.KeycapMaterial, &p.CorrectKeycapMaterial, &p.Keyswitch, &p.CorrectKeyswitch)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.Is(err, pgx.ErrNoRows) || (errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation) {
+			return p, ErrPlayOver
+		}
+		return p, err
+	}
+
+	return p, nil
+}
+
+// GetHistory gets the latest challenges userID made or took, newest first.
+func (m *ChallengeModel) GetHistory(userID string, limit int) ([]ChallengeResult, error) {
+	var results []ChallengeResult
+
+	stmt := `SELECT
+		  c.challenge_id,
+		  c.sound_test_id,
+		  c.created,
+		  CASE WHEN other.user_profile_id IS NULL THEN '' ELSE COALESCE(other.username, 'anonymous') END,
+		  ` + challengeScore("mine") + `,
+		  ` + challengeScore("theirs") + `
+		FROM challenge c
+		JOIN sound_test st USING (sound_test_id)
+		LEFT JOIN user_profile other ON other.user_profile_id = CASE WHEN c.created_by = $1 THEN c.opponent_id ELSE c.created_by END
+		LEFT JOIN challenge_answer mine ON mine.sound_test_id = c.sound_test_id AND mine.created_by = $1
+		LEFT JOIN challenge_answer theirs ON theirs.sound_test_id = c.sound_test_id AND theirs.created_by = other.user_profile_id
+		WHERE (c.created_by = $1 OR c.opponent_id = $1) AND NOT st.hidden
+		ORDER BY c.created DESC
+		LIMIT $2`
+
+	rows, err := m.DB.Query(context.Background(), stmt, userID, limit)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c ChallengeResult
+
+		err := rows.Scan(&c.ID, &c.SoundTestID, &c.Created, &c.Opponent, &c.Score, &c.OpponentScore)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, c)
+	}
+
+	return results, rows.Err()
+}
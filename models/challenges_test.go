@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestChallengeResultOutcome(t *testing.T) {
+	score := func(n int) *int { return &n }
+
+	tests := map[string]struct {
+		result ChallengeResult
+		want   string
+	}{
+		"won":              {result: ChallengeResult{Score: score(3), OpponentScore: score(1)}, want: "won"},
+		"lost":             {result: ChallengeResult{Score: score(0), OpponentScore: score(4)}, want: "lost"},
+		"tied":             {result: ChallengeResult{Score: score(2), OpponentScore: score(2)}, want: "tied"},
+		"nobody took it":   {result: ChallengeResult{Score: score(2)}, want: ""},
+		"waiting for mine": {result: ChallengeResult{OpponentScore: score(2)}, want: ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.result.Outcome(); got != tc.want {
+				t.Errorf("want: %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
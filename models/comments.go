@@ -0,0 +1,167 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Comment struct {
+	ID          uuid.UUID
+	SoundTestID uuid.UUID
+	ParentID    *uuid.UUID
+	Body        string
+	Created     time.Time
+	LastUpdated time.Time
+	CreatedByID uuid.UUID
+	CreatedBy   string
+	Deleted     bool
+	Replies     []*Comment
+}
+
+func (c *Comment) Edited() bool {
+	return c.LastUpdated.Sub(c.Created) > time.Second
+}
+
+type CommentModel struct {
+	DB *pgxpool.Pool
+}
+
+func (m *CommentModel) Insert(soundtestID, parentID, body, userID string) (uuid.UUID, error) {
+	var commentID uuid.UUID
+
+	stmt := `INSERT INTO sound_test_comment (sound_test_id, parent_id, body, created_by)
+		SELECT $1, NULLIF($2, '')::uuid, $3, $4
+		WHERE
+			NULLIF($2, '') IS NULL
+			OR EXISTS (
+				SELECT true
+				FROM sound_test_comment
+				WHERE sound_test_comment_id = NULLIF($2, '')::uuid AND sound_test_id = $1
+			)
+		RETURNING sound_test_comment_id`
+
+	err := m.DB.QueryRow(context.Background(), stmt, soundtestID, parentID, body, userID).Scan(&commentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return commentID, ErrNoRecord
+		}
+		return commentID, err
+	}
+
+	return commentID, nil
+}
+
+func (m *CommentModel) GetThreads(soundtestID string) ([]*Comment, error) {
+	var comments []Comment
+
+	stmt := `SELECT
+			c.sound_test_comment_id,
+			c.sound_test_id,
+			c.parent_id,
+			CASE WHEN c.deleted THEN '' ELSE c.body END,
+			c.created,
+			c.last_updated,
+			c.created_by,
+			COALESCE(up.username, 'anonymous'),
+			c.deleted
+		FROM sound_test_comment c
+		JOIN user_profile up ON up.user_profile_id = c.created_by
+		WHERE c.sound_test_id = $1
+		ORDER BY c.created`
+
+	rows, err := m.DB.Query(context.Background(), stmt, soundtestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Comment
+
+		err := rows.Scan(&c.ID, &c.SoundTestID, &c.ParentID, &c.Body, &c.Created, &c.LastUpdated, &c.CreatedByID, &c.CreatedBy, &c.Deleted)
+		if err != nil {
+			return nil, err
+		}
+
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ThreadComments(comments), nil
+}
+
+// ThreadComments nests replies under their parent comment. Comments are
+// expected in the order they should be displayed; replies to a missing parent
+// are promoted to the top level so they are never silently dropped.
+func ThreadComments(comments []Comment) []*Comment {
+	byID := make(map[uuid.UUID]*Comment, len(comments))
+	for i := range comments {
+		byID[comments[i].ID] = &comments[i]
+	}
+
+	var threads []*Comment
+	for i := range comments {
+		c := &comments[i]
+
+		if c.ParentID != nil {
+			if parent, ok := byID[*c.ParentID]; ok && parent != c {
+				parent.Replies = append(parent.Replies, c)
+				continue
+			}
+		}
+
+		threads = append(threads, c)
+	}
+
+	return threads
+}
+
+func (m *CommentModel) Update(commentID, body, userID string) error {
+	stmt := `UPDATE sound_test_comment
+		SET body = $2, last_updated = now()
+		WHERE sound_test_comment_id = $1 AND created_by = $3 AND NOT deleted`
+
+	tag, err := m.DB.Exec(context.Background(), stmt, commentID, body, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Delete soft deletes a comment so replies keep their place in the thread.
+// Comments can be removed by their author or moderated by the uploader of
+// the soundtest they were left on.
+func (m *CommentModel) Delete(commentID, userID string) error {
+	stmt := `UPDATE sound_test_comment c
+		SET deleted = true, last_updated = now()
+		FROM sound_test st
+		WHERE
+			c.sound_test_comment_id = $1
+			AND st.sound_test_id = c.sound_test_id
+			AND (c.created_by = $2 OR st.created_by = $2)
+			AND NOT c.deleted`
+
+	tag, err := m.DB.Exec(context.Background(), stmt, commentID, userID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
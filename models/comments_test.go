@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestThreadComments(t *testing.T) {
+	root := uuid.Must(uuid.FromString("05ff139b-8b9a-4341-a161-8628c3e038e7"))
+	reply := uuid.Must(uuid.FromString("2a0f3ad4-216d-43db-a731-fdab599e2d45"))
+	nested := uuid.Must(uuid.FromString("8d3b6c2e-6f4a-4a4e-9d59-3c2f1a0e7b11"))
+	orphan := uuid.Must(uuid.FromString("c6a1f9e2-1d3b-4c5e-8f7a-9b0c1d2e3f40"))
+	missing := uuid.Must(uuid.FromString("f0e1d2c3-b4a5-4968-8776-655443322110"))
+
+	comments := []Comment{
+		{ID: root},
+		{ID: reply, ParentID: &root},
+		{ID: nested, ParentID: &reply},
+		{ID: orphan, ParentID: &missing},
+	}
+
+	threads := ThreadComments(comments)
+
+	if len(threads) != 2 {
+		t.Fatalf("want 2 top level comments, got %d", len(threads))
+	}
+	if threads[0].ID != root || threads[1].ID != orphan {
+		t.Errorf("top level comments out of order, got %v and %v", threads[0].ID, threads[1].ID)
+	}
+	if len(threads[0].Replies) != 1 || threads[0].Replies[0].ID != reply {
+		t.Fatalf("want reply nested under root, got %v", threads[0].Replies)
+	}
+	if len(threads[0].Replies[0].Replies) != 1 || threads[0].Replies[0].Replies[0].ID != nested {
+		t.Errorf("want nested reply under reply, got %v", threads[0].Replies[0].Replies)
+	}
+}
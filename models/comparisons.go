@@ -0,0 +1,251 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type ComparisonModel struct {
+	DB *pgxpool.Pool
+}
+
+// GetPair picks two random soundtests for userID to compare on criterion,
+// ones they didn't upload and haven't compared with each other yet. Sounds of
+// the day for today or later are left out as their builds are shown after
+// comparing. ErrNoRecord is returned when there's no pair left.
+func (m *ComparisonModel) GetPair(userID, criterion string, today time.Time) (SoundTest, SoundTest, error) {
+	var a, b SoundTest
+
+	stmt := `WITH eligible AS (
+			SELECT
+			  sound_test_id,
+			  url,
+			  uploaded,
+			  last_updated,
+			  keyboard_id,
+			  plate_material_id,
+			  keycap_material_id,
+			  keyswitch_id,
+			  created_by
+			FROM sound_test
+			WHERE
+			  NOT hidden
+			  AND created_by <> $1
+			  AND (daily_date IS NULL OR daily_date < $3)
+		)
+		SELECT a.*, b.*
+		FROM (SELECT * FROM eligible ORDER BY random() LIMIT 20) a
+		CROSS JOIN LATERAL (
+			SELECT *
+			FROM eligible e
+			WHERE
+			  e.sound_test_id <> a.sound_test_id
+			  AND NOT EXISTS (
+			    SELECT true
+			    FROM comparison c
+			    WHERE
+			      c.created_by = $1
+			      AND c.criterion = $2
+			      AND least(c.winner_id, c.loser_id) = least(a.sound_test_id, e.sound_test_id)
+			      AND greatest(c.winner_id, c.loser_id) = greatest(a.sound_test_id, e.sound_test_id)
+			  )
+			ORDER BY random()
+			LIMIT 1
+		) b
+		LIMIT 1`
+
+	err := m.DB.QueryRow(context.Background(), stmt, userID, criterion, CalendarDate(today)).Scan(
+		&a.ID, &a.URL, &a.Uploaded, &a.LastUpdated, &a.KeyboardID, &a.PlateMaterialID, &a.KeycapMaterialID, &a.KeyswitchID, &a.CreatedBy,
+		&b.ID, &b.URL, &b.Uploaded, &b.LastUpdated, &b.KeyboardID, &b.PlateMaterialID, &b.KeycapMaterialID, &b.KeyswitchID, &b.CreatedBy,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return a, b, ErrNoRecord
+		}
+		return a, b, err
+	}
+
+	return a, b, nil
+}
+
+// Add records that userID picked winnerID over loserID on criterion, with a
+// weight from TrustSignals.Weight. Comparing the same pair again replaces the
+// earlier pick.
+func (m *ComparisonModel) Add(criterion, winnerID, loserID string, weight float64, userID string) error {
+	stmt := `INSERT INTO comparison (criterion, winner_id, loser_id, weight, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (created_by, criterion, least(winner_id, loser_id), greatest(winner_id, loser_id))
+		DO UPDATE SET winner_id = EXCLUDED.winner_id, loser_id = EXCLUDED.loser_id, weight = EXCLUDED.weight, created = now()`
+
+	_, err := m.DB.Exec(context.Background(), stmt, criterion, winnerID, loserID, weight, userID)
+	return err
+}
+
+// comparedPair is a comparison with the parts of both soundtests.
+type comparedPair struct {
+	criterion                       string
+	winner, loser                   uuid.UUID
+	winnerKeyswitch, loserKeyswitch uuid.UUID
+	winnerKeyboard, loserKeyboard   uuid.UUID
+	weight                          float64
+}
+
+// matchup is the pair as a matchup between subjects, false when both
+// soundtests have the same part so it says nothing about the part.
+func (p comparedPair) matchup(subject string) (Matchup, bool) {
+	m := Matchup{Winner: p.winner, Loser: p.loser, Weight: p.weight}
+
+	switch subject {
+	case SubjectKeyswitch:
+		m.Winner, m.Loser = p.winnerKeyswitch, p.loserKeyswitch
+	case SubjectKeyboard:
+		m.Winner, m.Loser = p.winnerKeyboard, p.loserKeyboard
+	}
+
+	return m, m.Winner != m.Loser
+}
+
+type ratingKey struct {
+	subject   string
+	criterion string
+}
+
+// groupMatchups splits pairs into the matchups for each subject and
+// criterion.
+func groupMatchups(pairs []comparedPair) map[ratingKey][]Matchup {
+	groups := map[ratingKey][]Matchup{}
+
+	for _, p := range pairs {
+		for _, subject := range RatingSubjects {
+			if m, ok := p.matchup(subject); ok {
+				key := ratingKey{subject, p.criterion}
+				groups[key] = append(groups[key], m)
+			}
+		}
+	}
+
+	return groups
+}
+
+// Rate refits every rating to the comparisons made so far, leaving out those
+// by suspended users and of hidden soundtests, and returns how many ratings
+// there are.
+func (m *ComparisonModel) Rate() (int, error) {
+	stmt := `SELECT c.criterion, c.winner_id, c.loser_id, w.keyswitch_id, l.keyswitch_id, w.keyboard_id, l.keyboard_id, c.weight::float8
+		FROM comparison c
+		JOIN sound_test w ON w.sound_test_id = c.winner_id
+		JOIN sound_test l ON l.sound_test_id = c.loser_id
+		JOIN user_profile up ON up.user_profile_id = c.created_by
+		WHERE up.suspended IS NULL AND NOT w.hidden AND NOT l.hidden`
+
+	rows, err := m.DB.Query(context.Background(), stmt)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var pairs []comparedPair
+	for rows.Next() {
+		var p comparedPair
+
+		err := rows.Scan(&p.criterion, &p.winner, &p.loser, &p.winnerKeyswitch, &p.loserKeyswitch, &p.winnerKeyboard, &p.loserKeyboard, &p.weight)
+		if err != nil {
+			return 0, err
+		}
+
+		pairs = append(pairs, p)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), "DELETE FROM rating")
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `INSERT INTO rating (subject, subject_id, criterion, rating, comparisons)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	rated := 0
+	for key, matchups := range groupMatchups(pairs) {
+		counts := map[uuid.UUID]int{}
+		for _, mu := range matchups {
+			counts[mu.Winner]++
+			counts[mu.Loser]++
+		}
+
+		for id, rating := range BradleyTerry(matchups) {
+			_, err = tx.Exec(context.Background(), stmt, key.subject, id, key.criterion, rating, counts[id])
+			if err != nil {
+				return 0, err
+			}
+			rated++
+		}
+	}
+
+	return rated, tx.Commit(context.Background())
+}
+
+// GetRatings gets the ratings of subject on criterion for those compared at
+// least minComparisons times, best first. Soundtests that are hidden or the
+// sound of the day for today or later are left out.
+func (m *ComparisonModel) GetRatings(subject, criterion string, minComparisons int, today time.Time) ([]RatedSubject, error) {
+	var subjects []RatedSubject
+
+	stmt := `SELECT
+		  r.subject_id,
+		  COALESCE(ks.name, k.name, stk.name || ' · ' || stks.name),
+		  r.rating,
+		  r.comparisons
+		FROM rating r
+		LEFT JOIN keyswitch ks ON r.subject = 'keyswitch' AND ks.keyswitch_id = r.subject_id
+		LEFT JOIN keyboard k ON r.subject = 'keyboard' AND k.keyboard_id = r.subject_id
+		LEFT JOIN sound_test st ON r.subject = 'soundtest' AND st.sound_test_id = r.subject_id
+		LEFT JOIN keyboard stk ON stk.keyboard_id = st.keyboard_id
+		LEFT JOIN keyswitch stks ON stks.keyswitch_id = st.keyswitch_id
+		WHERE
+		  r.subject = $1
+		  AND r.criterion = $2
+		  AND r.comparisons >= $3
+		  AND (r.subject <> 'soundtest' OR (NOT st.hidden AND (st.daily_date IS NULL OR st.daily_date < $4)))
+		ORDER BY r.rating DESC`
+
+	rows, err := m.DB.Query(context.Background(), stmt, subject, criterion, minComparisons, CalendarDate(today))
+	if err != nil {
+		return subjects, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s RatedSubject
+
+		err := rows.Scan(&s.ID, &s.Name, &s.Rating, &s.Comparisons)
+		if err != nil {
+			return subjects, err
+		}
+
+		subjects = append(subjects, s)
+	}
+
+	return subjects, rows.Err()
+}
+
+// LastRated is when ratings were last fitted, nil if they never have been.
+func (m *ComparisonModel) LastRated() (*time.Time, error) {
+	var updated *time.Time
+
+	err := m.DB.QueryRow(context.Background(), "SELECT max(updated) FROM rating").Scan(&updated)
+	return updated, err
+}
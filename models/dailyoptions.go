@@ -0,0 +1,230 @@
+package models
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sort"
+
+	"github.com/0xhjohnson/clacksy/validator"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	PartKeyboard      = "keyboard"
+	PartKeyswitch     = "keyswitch"
+	PartPlateMaterial = "plate-material"
+)
+
+// DailyOptionCount is how many choices, the correct one included, the daily
+// play offers for each part.
+const DailyOptionCount = 4
+
+// newOptionRand returns a source seeded from crypto/rand, so a soundtest's
+// options can't be worked out from anything public like its ID.
+func newOptionRand() (*rand.Rand, error) {
+	var seed [8]byte
+
+	_, err := crand.Read(seed[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(seed[:])))), nil
+}
+
+// Difficulty decides how close to the correct answer the daily play's
+// distractors are.
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+var Difficulties = []string{DifficultyEasy, DifficultyMedium, DifficultyHard}
+
+// partCandidate is a possible option and how alike it is to the correct
+// answer, higher is closer.
+type partCandidate struct {
+	ID        uuid.UUID
+	Closeness int
+}
+
+// pickOptions chooses n options from candidates, always including correct
+// exactly once, in a shuffled order. Easy picks distractors at random, medium
+// favours close ones and hard takes the closest there are.
+func pickOptions(correct uuid.UUID, candidates []partCandidate, n int, difficulty string, rng *rand.Rand) []uuid.UUID {
+	var pool []partCandidate
+	for _, c := range candidates {
+		if c.ID != correct {
+			pool = append(pool, c)
+		}
+	}
+
+	rng.Shuffle(len(pool), func(i, j int) {
+		pool[i], pool[j] = pool[j], pool[i]
+	})
+
+	switch difficulty {
+	case DifficultyHard:
+		sort.SliceStable(pool, func(i, j int) bool {
+			return pool[i].Closeness > pool[j].Closeness
+		})
+	case DifficultyMedium:
+		weightedShuffle(pool, rng)
+	}
+
+	opts := []uuid.UUID{correct}
+	for i := 0; i < len(pool) && len(opts) < n; i++ {
+		opts = append(opts, pool[i].ID)
+	}
+
+	rng.Shuffle(len(opts), func(i, j int) {
+		opts[i], opts[j] = opts[j], opts[i]
+	})
+
+	return opts
+}
+
+// weightedShuffle orders candidates by sampling without replacement, each
+// step of closeness making a candidate four times likelier to come first.
+func weightedShuffle(pool []partCandidate, rng *rand.Rand) {
+	for i := range pool {
+		total := 0
+		for _, c := range pool[i:] {
+			total += closenessWeight(c.Closeness)
+		}
+
+		pick := rng.Intn(total)
+		for j := i; j < len(pool); j++ {
+			pick -= closenessWeight(pool[j].Closeness)
+			if pick < 0 {
+				pool[i], pool[j] = pool[j], pool[i]
+				break
+			}
+		}
+	}
+}
+
+func closenessWeight(closeness int) int {
+	weight := 1
+	for i := 0; i < closeness; i++ {
+		weight *= 4
+	}
+	return weight
+}
+
+// ensureDailyOpts chooses and stores a soundtest's options the first time
+// they're asked for. Options are stored rather than chosen on every request so
+// refreshing the page doesn't reroll them and they survive parts being added to
+// the catalog later.
+func (m *PartsModel) ensureDailyOpts(st SoundTest) error {
+	var exists bool
+
+	err := m.DB.QueryRow(context.Background(), "SELECT EXISTS (SELECT true FROM daily_option WHERE sound_test_id = $1)", st.ID).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	parts := []struct {
+		part    string
+		correct uuid.UUID
+		stmt    string
+	}{
+		{PartKeyboard, st.KeyboardID, `SELECT
+				k.keyboard_id,
+				COALESCE((k.layout = c.layout)::int, 0) + COALESCE((k.price_class = c.price_class)::int, 0)
+			FROM keyboard k, keyboard c
+			WHERE c.keyboard_id = $1
+			ORDER BY k.keyboard_id`},
+		{PartKeyswitch, st.KeyswitchID, `SELECT
+				k.keyswitch_id,
+				(k.keyswitch_type_id = c.keyswitch_type_id)::int * 2 + (split_part(k.name, ' ', 1) = split_part(c.name, ' ', 1))::int
+			FROM keyswitch k, keyswitch c
+			WHERE c.keyswitch_id = $1
+			ORDER BY k.keyswitch_id`},
+		{PartPlateMaterial, st.PlateMaterialID, `SELECT
+				p.plate_material_id,
+				COALESCE((p.family = c.family)::int, 0) * 2
+			FROM plate_material p, plate_material c
+			WHERE c.plate_material_id = $1
+			ORDER BY p.plate_material_id`},
+	}
+
+	rng, err := newOptionRand()
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	// Options are random, so a concurrent request choosing them too waits on
+	// the soundtest's row and then keeps the ones already stored.
+	_, err = tx.Exec(context.Background(), "SELECT true FROM sound_test WHERE sound_test_id = $1 FOR UPDATE", st.ID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(context.Background(), "SELECT EXISTS (SELECT true FROM daily_option WHERE sound_test_id = $1)", st.ID).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	stmt := `INSERT INTO daily_option (sound_test_id, part, position, part_id)
+		VALUES ($1, $2, $3, $4)`
+
+	for _, p := range parts {
+		candidates, err := m.queryCandidates(p.stmt, p.correct)
+		if err != nil {
+			return err
+		}
+
+		for i, id := range pickOptions(p.correct, candidates, DailyOptionCount, m.difficulty(), rng) {
+			_, err = tx.Exec(context.Background(), stmt, st.ID, p.part, i, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func (m *PartsModel) difficulty() string {
+	if validator.PermittedValue(m.Difficulty, Difficulties...) {
+		return m.Difficulty
+	}
+	return DifficultyMedium
+}
+
+func (m *PartsModel) queryCandidates(stmt string, args ...any) ([]partCandidate, error) {
+	var candidates []partCandidate
+
+	rows, err := m.DB.Query(context.Background(), stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c partCandidate
+
+		err := rows.Scan(&c.ID, &c.Closeness)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return candidates, nil
+}
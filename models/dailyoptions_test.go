@@ -0,0 +1,102 @@
+package models
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func testOptionRand(t *testing.T) *rand.Rand {
+	rng, err := newOptionRand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rng
+}
+
+func TestPickOptions(t *testing.T) {
+	var catalog []partCandidate
+	for i := 0; i < 10; i++ {
+		catalog = append(catalog, partCandidate{ID: uuid.Must(uuid.NewV4()), Closeness: i % 3})
+	}
+	correct := catalog[0].ID
+
+	tests := map[string]struct {
+		candidates []partCandidate
+		want       int
+	}{
+		"large catalog":      {candidates: catalog, want: DailyOptionCount},
+		"small catalog":      {candidates: catalog[:2], want: 2},
+		"only the correct":   {candidates: catalog[:1], want: 1},
+		"correct not listed": {candidates: catalog[1:4], want: DailyOptionCount},
+		"empty catalog":      {candidates: nil, want: 1},
+	}
+
+	for _, difficulty := range Difficulties {
+		for name, tc := range tests {
+			t.Run(difficulty+" "+name, func(t *testing.T) {
+				opts := pickOptions(correct, tc.candidates, DailyOptionCount, difficulty, testOptionRand(t))
+
+				if len(opts) != tc.want {
+					t.Errorf("got %d options, want: %d", len(opts), tc.want)
+				}
+
+				seen := make(map[uuid.UUID]int)
+				for _, id := range opts {
+					seen[id]++
+				}
+				if seen[correct] != 1 {
+					t.Errorf("correct option offered %d times, want: 1", seen[correct])
+				}
+				if len(seen) != len(opts) {
+					t.Error("an option is offered more than once")
+				}
+			})
+		}
+	}
+}
+
+func TestPickOptionsHardTakesClosest(t *testing.T) {
+	correct := uuid.Must(uuid.NewV4())
+	candidates := []partCandidate{{ID: correct, Closeness: 3}}
+	close := make(map[uuid.UUID]bool)
+
+	for i := 0; i < 12; i++ {
+		c := partCandidate{ID: uuid.Must(uuid.NewV4())}
+		if i%4 == 0 {
+			c.Closeness = 2
+			close[c.ID] = true
+		}
+		candidates = append(candidates, c)
+	}
+
+	for i := 0; i < 20; i++ {
+		opts := pickOptions(correct, candidates, DailyOptionCount, DifficultyHard, testOptionRand(t))
+
+		for _, id := range opts {
+			if id != correct && !close[id] {
+				t.Fatalf("hard mode offered a distant distractor while close ones were left")
+			}
+		}
+	}
+}
+
+func TestWeightedShuffleFavoursClose(t *testing.T) {
+	rng := testOptionRand(t)
+	closeFirst := 0
+
+	for i := 0; i < 1000; i++ {
+		pool := []partCandidate{{Closeness: 0}, {Closeness: 0}, {Closeness: 0}, {Closeness: 2}}
+		pool[3].ID = uuid.Must(uuid.NewV4())
+		weightedShuffle(pool, rng)
+		if pool[0].Closeness == 2 {
+			closeFirst++
+		}
+	}
+
+	// The close candidate has weight 16 against three of weight 1.
+	if closeFirst < 750 {
+		t.Errorf("close candidate came first %d times out of 1000, want around 842", closeFirst)
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// The furthest offsets from UTC any timezone is at, between them every
+// calendar date that's today somewhere.
+var (
+	earliestZone = time.FixedZone("UTC-12", -12*60*60)
+	latestZone   = time.FixedZone("UTC+14", 14*60*60)
+)
+
+// CalendarDate is the date t falls on in its own location, as midnight UTC so
+// dates compare equal whichever zone they came from.
+func CalendarDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// CurrentDates lists the calendar dates it is somewhere in the world at now,
+// oldest first. A new one starts every day at 10:00 UTC, in Kiribati.
+func CurrentDates(now time.Time) []time.Time {
+	var dates []time.Time
+
+	last := CalendarDate(now.In(latestZone))
+	for d := CalendarDate(now.In(earliestZone)); !d.After(last); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d)
+	}
+
+	return dates
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarDate(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	at := time.Date(2023, time.March, 10, 20, 30, 0, 0, time.UTC)
+
+	want := time.Date(2023, time.March, 11, 0, 0, 0, 0, time.UTC)
+	if got := CalendarDate(at.In(tokyo)); !got.Equal(want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	want = time.Date(2023, time.March, 10, 0, 0, 0, 0, time.UTC)
+	if got := CalendarDate(at); !got.Equal(want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+func TestCurrentDates(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2023, time.March, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := map[string]struct {
+		now  time.Time
+		want []time.Time
+	}{
+		"just after midnight UTC": {
+			now:  time.Date(2023, time.March, 10, 0, 30, 0, 0, time.UTC),
+			want: []time.Time{day(9), day(10)},
+		},
+		"noon UTC": {
+			now:  time.Date(2023, time.March, 10, 12, 0, 0, 0, time.UTC),
+			want: []time.Time{day(10), day(11)},
+		},
+		"just before midnight UTC": {
+			now:  time.Date(2023, time.March, 10, 23, 30, 0, 0, time.UTC),
+			want: []time.Time{day(10), day(11)},
+		},
+		"between 10:00 and 12:00 UTC": {
+			now:  time.Date(2023, time.March, 10, 11, 0, 0, 0, time.UTC),
+			want: []time.Time{day(9), day(10), day(11)},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := CurrentDates(tc.now)
+			if len(got) != len(tc.want) {
+				t.Fatalf("want: %v, got: %v", tc.want, got)
+			}
+			for i := range got {
+				if !got[i].Equal(tc.want[i]) {
+					t.Errorf("want: %v, got: %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
@@ -6,4 +6,9 @@ var (
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateUsername  = errors.New("models: duplicate username")
+	ErrNoRecord           = errors.New("models: no matching record found")
+	ErrFeatured           = errors.New("models: soundtest has been featured")
+	ErrSuspended          = errors.New("models: account suspended")
+	ErrPlayOver           = errors.New("models: play is over")
+	ErrDuplicateAttempt   = errors.New("models: attempt already made")
 )
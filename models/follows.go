@@ -0,0 +1,54 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type FollowModel struct {
+	DB *pgxpool.Pool
+}
+
+type FollowCounts struct {
+	Followers int
+	Following int
+}
+
+// Follow makes followerID follow followeeID. Following someone twice is not
+// an error.
+func (m *FollowModel) Follow(followerID, followeeID string) error {
+	stmt := `INSERT INTO follow (follower_id, followee_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	_, err := m.DB.Exec(context.Background(), stmt, followerID, followeeID)
+	return err
+}
+
+func (m *FollowModel) Unfollow(followerID, followeeID string) error {
+	stmt := "DELETE FROM follow WHERE follower_id = $1 AND followee_id = $2"
+
+	_, err := m.DB.Exec(context.Background(), stmt, followerID, followeeID)
+	return err
+}
+
+func (m *FollowModel) IsFollowing(followerID, followeeID string) (bool, error) {
+	var following bool
+
+	stmt := "SELECT EXISTS (SELECT true FROM follow WHERE follower_id = $1 AND followee_id = $2)"
+
+	err := m.DB.QueryRow(context.Background(), stmt, followerID, followeeID).Scan(&following)
+	return following, err
+}
+
+func (m *FollowModel) GetCounts(userID string) (FollowCounts, error) {
+	var c FollowCounts
+
+	stmt := `SELECT
+			(SELECT count(*) FROM follow WHERE followee_id = $1),
+			(SELECT count(*) FROM follow WHERE follower_id = $1)`
+
+	err := m.DB.QueryRow(context.Background(), stmt, userID).Scan(&c.Followers, &c.Following)
+	return c, err
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gofrs/uuid"
+)
+
+// AddGuestPlay stores a daily play by a visitor without an account. Guests
+// can't play in hints mode.
+func (m *SoundTestModel) AddGuestPlay(soundtest uuid.UUID, guestID, keyboard, plateMaterial, keycapMaterial, keyswitch, mode string, attributes map[string]string) error {
+	attrs, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO guest_play (guest_id, sound_test_id, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id, mode, attributes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err = m.DB.Exec(context.Background(), stmt, guestID, soundtest, keyboard, plateMaterial, keycapMaterial, keyswitch, mode, attrs)
+	return err
+}
+
+// GetGuestPlayAttributes is GetPlayAttributes for a guest's play.
+func (m *SoundTestModel) GetGuestPlayAttributes(soundtestID uuid.UUID, guestID string) ([]PlayAttribute, error) {
+	var attributes []PlayAttribute
+
+	stmt := `SELECT
+			ba.name,
+			COALESCE(guess.name, ''),
+			correct.name
+		FROM sound_test_attribute sta
+		JOIN build_attribute ba USING (build_attribute_id)
+		JOIN build_attribute_option correct ON correct.build_attribute_option_id = sta.build_attribute_option_id
+		LEFT JOIN guest_play gp ON gp.sound_test_id = sta.sound_test_id AND gp.guest_id = $2
+		LEFT JOIN build_attribute_option guess ON guess.build_attribute_option_id::text = gp.attributes ->> sta.build_attribute_id::text
+		WHERE sta.sound_test_id = $1 AND ba.bonus_round
+		ORDER BY ba.sort_order, ba.name`
+
+	rows, err := m.DB.Query(context.Background(), stmt, soundtestID, guestID)
+	if err != nil {
+		return attributes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a PlayAttribute
+
+		err := rows.Scan(&a.Attribute, &a.Guess, &a.Correct)
+		if err != nil {
+			return attributes, err
+		}
+
+		attributes = append(attributes, a)
+	}
+
+	return attributes, rows.Err()
+}
+
+// ClaimGuestPlays copies a guest's unclaimed plays, and so their streak, into
+// userID's account and returns how many were copied. Plays of soundtests the
+// user already played in their account are left behind.
+func (m *SoundTestModel) ClaimGuestPlays(guestID, userID string) (int64, error) {
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	stmt := `UPDATE guest_play gp
+		SET claimed_by = $2, claimed = now()
+		WHERE
+			gp.guest_id = $1
+			AND gp.claimed IS NULL
+			AND NOT EXISTS (
+				SELECT true
+				FROM sound_test_play stp
+				WHERE stp.sound_test_id = gp.sound_test_id AND stp.created_by = $2
+			)`
+
+	tag, err := tx.Exec(context.Background(), stmt, guestID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// now() is fixed for the whole transaction, so claimed = now() picks out
+	// the plays claimed above.
+	stmt = `INSERT INTO sound_test_play (sound_test_id, created_by, submitted, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id, mode, attempts)
+		SELECT sound_test_id, claimed_by, submitted, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id, mode, attempts
+		FROM guest_play
+		WHERE guest_id = $1 AND claimed_by = $2 AND claimed = now()`
+
+	_, err = tx.Exec(context.Background(), stmt, guestID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `INSERT INTO sound_test_play_attribute (sound_test_id, created_by, build_attribute_id, build_attribute_option_id)
+		SELECT gp.sound_test_id, gp.claimed_by, a.key::uuid, a.value::uuid
+		FROM guest_play gp
+		CROSS JOIN jsonb_each_text(gp.attributes) a
+		WHERE gp.guest_id = $1 AND gp.claimed_by = $2 AND gp.claimed = now()`
+
+	_, err = tx.Exec(context.Background(), stmt, guestID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), tx.Commit(context.Background())
+}
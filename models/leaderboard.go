@@ -0,0 +1,107 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodAll   = "all"
+)
+
+// LeaderboardPeriods are how far back the leaderboard can count plays.
+var LeaderboardPeriods = []string{PeriodWeek, PeriodMonth, PeriodAll}
+
+// periodStart is when plays start counting for period, the zero time counts
+// every play.
+func periodStart(period string, now time.Time) time.Time {
+	switch period {
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7)
+	case PeriodMonth:
+		return now.AddDate(0, -1, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+// playCorrectParts counts the parts a play joined to its sound_test as st
+// guessed right, out of PartsPerPlay.
+const playCorrectParts = `(stp.keyboard_id = st.keyboard_id)::int
+	+ (stp.plate_material_id = st.plate_material_id)::int
+	+ (stp.keycap_material_id = st.keycap_material_id)::int
+	+ (stp.keyswitch_id = st.keyswitch_id)::int`
+
+type LeaderboardEntry struct {
+	Rank     int
+	UserID   uuid.UUID
+	Username string
+	Played   int
+	Correct  int
+	Perfect  int
+	Points   int
+}
+
+// GetLeaderboard ranks players by PlayPoints scored in daily plays over period,
+// then by perfect plays. Each of PlayModes is ranked on its own. With
+// followingOnly it only ranks userID and the users they follow.
+func (m *SoundTestModel) GetLeaderboard(period, mode string, followingOnly bool, userID string, limit int) ([]LeaderboardEntry, error) {
+	var entries []LeaderboardEntry
+
+	stmt := `SELECT
+			rank() OVER (ORDER BY sum(p.points) DESC, count(*) FILTER (WHERE p.correct = $5) DESC),
+			up.user_profile_id,
+			COALESCE(up.username, 'anonymous'),
+			count(*),
+			sum(p.correct),
+			count(*) FILTER (WHERE p.correct = $5),
+			sum(p.points)
+		FROM (
+			SELECT
+				stp.created_by,
+				c.correct,
+				c.correct * CASE WHEN stp.mode = 'hints' THEN greatest($7 + 1 - stp.attempts, 1) ELSE 1 END AS points
+			FROM sound_test_play stp
+			JOIN sound_test st USING (sound_test_id)
+			CROSS JOIN LATERAL (SELECT ` + playCorrectParts + ` AS correct) c
+			WHERE stp.submitted >= $1 AND stp.mode = $6
+		) p
+		JOIN user_profile up ON up.user_profile_id = p.created_by
+		WHERE
+			up.suspended IS NULL
+			AND (
+				NOT $2
+				OR up.user_profile_id = NULLIF($3, '')::uuid
+				OR up.user_profile_id IN (SELECT followee_id FROM follow WHERE follower_id = NULLIF($3, '')::uuid)
+			)
+		GROUP BY up.user_profile_id
+		ORDER BY 1, up.username
+		LIMIT $4`
+
+	rows, err := m.DB.Query(context.Background(), stmt, periodStart(period, time.Now()), followingOnly, userID, limit, PartsPerPlay, mode, MaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e LeaderboardEntry
+
+		err := rows.Scan(&e.Rank, &e.UserID, &e.Username, &e.Played, &e.Correct, &e.Perfect, &e.Points)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
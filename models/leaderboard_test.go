@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodStart(t *testing.T) {
+	now := time.Date(2023, 3, 10, 15, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		period string
+		want   time.Time
+	}{
+		"week":    {period: PeriodWeek, want: time.Date(2023, 3, 3, 15, 0, 0, 0, time.UTC)},
+		"month":   {period: PeriodMonth, want: time.Date(2023, 2, 10, 15, 0, 0, 0, time.UTC)},
+		"all":     {period: PeriodAll, want: time.Time{}},
+		"unknown": {period: "year", want: time.Time{}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := periodStart(tc.period, now); !got.Equal(tc.want) {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/gofrs/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+const PartKeycapMaterial = "keycap-material"
+
+// CatalogEntry is a part a hard mode guess can match, by name or alias.
+type CatalogEntry struct {
+	ID      uuid.UUID
+	Name    string
+	Aliases []string
+}
+
+// Catalog is every part that can be guessed in hard mode.
+type Catalog struct {
+	Keyboards       []CatalogEntry
+	Switches        []CatalogEntry
+	PlateMaterials  []CatalogEntry
+	KeycapMaterials []CatalogEntry
+}
+
+// normalizePartName lowercases name and drops everything but letters and
+// digits, along with a trailing plural s, so "Holy Pandas" and "holy-panda"
+// compare equal.
+func normalizePartName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	s := b.String()
+	if len(s) > 3 && strings.HasSuffix(s, "s") && !strings.HasSuffix(s, "ss") {
+		s = strings.TrimSuffix(s, "s")
+	}
+	return s
+}
+
+// levenshtein is the number of single character edits between a and b.
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(br)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// MatchPart finds the entry guess refers to. An exact match on a name or alias,
+// ignoring case, punctuation and plurals, wins. Otherwise the closest name or
+// alias is used if it's within maxTypos of the guess and no other entry is as
+// close.
+func MatchPart(guess string, catalog []CatalogEntry) (CatalogEntry, bool) {
+	g := normalizePartName(guess)
+	if g == "" {
+		return CatalogEntry{}, false
+	}
+
+	best, bestDistance, tied := -1, 0, false
+
+	for i, e := range catalog {
+		distance := -1
+		for _, name := range append([]string{e.Name}, e.Aliases...) {
+			n := normalizePartName(name)
+			if n == g {
+				return e, true
+			}
+
+			d := levenshtein(g, n)
+			if distance < 0 || d < distance {
+				distance = d
+			}
+		}
+
+		switch {
+		case distance < 0:
+		case best < 0 || distance < bestDistance:
+			best, bestDistance, tied = i, distance, false
+		case distance == bestDistance:
+			tied = true
+		}
+	}
+
+	if best < 0 || tied || bestDistance > maxTypos(g) {
+		return CatalogEntry{}, false
+	}
+
+	return catalog[best], true
+}
+
+// maxTypos is how many edits away from a name guess may be. Guesses too short
+// to tell a typo from another part, like "pc", have to match exactly.
+func maxTypos(guess string) int {
+	n := len([]rune(guess))
+	if n < 4 {
+		return 0
+	}
+	if n < 10 {
+		return 1
+	}
+	return n / 5
+}
+
+// GetCatalog returns every part with its aliases, for matching hard mode
+// guesses and suggesting names while typing.
+func (m *PartsModel) GetCatalog() (Catalog, error) {
+	var c Catalog
+	g, _ := errgroup.WithContext(context.Background())
+
+	parts := []struct {
+		part    string
+		table   string
+		entries *[]CatalogEntry
+	}{
+		{PartKeyboard, "keyboard", &c.Keyboards},
+		{PartKeyswitch, "keyswitch", &c.Switches},
+		{PartPlateMaterial, "plate_material", &c.PlateMaterials},
+		{PartKeycapMaterial, "keycap_material", &c.KeycapMaterials},
+	}
+
+	for _, p := range parts {
+		p := p
+		g.Go(func() error {
+			entries, err := m.queryCatalog(p.part, p.table)
+			if err == nil {
+				*p.entries = entries
+			}
+			return err
+		})
+	}
+
+	err := g.Wait()
+	return c, err
+}
+
+func (m *PartsModel) queryCatalog(part, table string) ([]CatalogEntry, error) {
+	var entries []CatalogEntry
+
+	stmt := `SELECT t.` + table + `_id, t.name, COALESCE(array_agg(a.alias ORDER BY a.alias) FILTER (WHERE a.alias IS NOT NULL), '{}')
+		FROM ` + table + ` t
+		LEFT JOIN part_alias a ON a.part = $1 AND a.part_id = t.` + table + `_id
+		GROUP BY t.` + table + `_id, t.name
+		ORDER BY t.name`
+
+	rows, err := m.DB.Query(context.Background(), stmt, part)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e CatalogEntry
+
+		err := rows.Scan(&e.ID, &e.Name, &e.Aliases)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestMatchPart(t *testing.T) {
+	catalog := []CatalogEntry{
+		{ID: uuid.Must(uuid.NewV4()), Name: "Holy Panda", Aliases: []string{"hp"}},
+		{ID: uuid.Must(uuid.NewV4()), Name: "Gateron Yellow"},
+		{ID: uuid.Must(uuid.NewV4()), Name: "Gateron Black"},
+		{ID: uuid.Must(uuid.NewV4()), Name: "Brass"},
+		{ID: uuid.Must(uuid.NewV4()), Name: "Polycarbonate", Aliases: []string{"PC"}},
+	}
+
+	tests := map[string]struct {
+		guess string
+		want  string
+		ok    bool
+	}{
+		"exact":           {guess: "Holy Panda", want: "Holy Panda", ok: true},
+		"plural":          {guess: "holy pandas", want: "Holy Panda", ok: true},
+		"punctuation":     {guess: "holy-panda!", want: "Holy Panda", ok: true},
+		"alias":           {guess: "HP", want: "Holy Panda", ok: true},
+		"alias case":      {guess: "pc", want: "Polycarbonate", ok: true},
+		"typo":            {guess: "gateron yelow", want: "Gateron Yellow", ok: true},
+		"double s kept":   {guess: "brass", want: "Brass", ok: true},
+		"too far":         {guess: "cherry mx red", ok: false},
+		"ambiguous":       {guess: "gateron", ok: false},
+		"blank":           {guess: "  ", ok: false},
+		"short with typo": {guess: "pd", ok: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := MatchPart(tc.guess, catalog)
+			if ok != tc.ok {
+				t.Fatalf("got ok: %v, want: %v (matched %q)", ok, tc.ok, got.Name)
+			}
+			if got.Name != tc.want {
+				t.Errorf("got: %q, want: %q", got.Name, tc.want)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"panda", "panda", 0},
+	}
+
+	for _, tc := range tests {
+		if got := levenshtein(tc.a, tc.b); got != tc.want {
+			t.Errorf("levenshtein(%q, %q) got: %d, want: %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
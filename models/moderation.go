@@ -0,0 +1,382 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	SubjectSoundTest = "soundtest"
+	SubjectComment   = "comment"
+	SubjectUser      = "user"
+)
+
+var ReportReasons = []string{"offensive", "mislabeled", "spam", "other"}
+
+const (
+	ActionHide    = "hide"
+	ActionDelete  = "delete"
+	ActionCorrect = "correct"
+	ActionWarn    = "warn"
+	ActionSuspend = "suspend"
+	ActionDismiss = "dismiss"
+)
+
+// Actions lists the moderation actions that can be taken on each kind of
+// reported subject. Warnings and suspensions apply to whoever is responsible
+// for the subject.
+var Actions = map[string][]string{
+	SubjectSoundTest: {ActionHide, ActionDelete, ActionCorrect, ActionWarn, ActionSuspend, ActionDismiss},
+	SubjectComment:   {ActionDelete, ActionWarn, ActionSuspend, ActionDismiss},
+	SubjectUser:      {ActionWarn, ActionSuspend, ActionDismiss},
+}
+
+func CanModerate(subjectType, action string) bool {
+	for _, a := range Actions[subjectType] {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+type Report struct {
+	ID          uuid.UUID
+	SubjectType string
+	SubjectID   uuid.UUID
+	Reason      string
+	Details     string
+	Created     time.Time
+	CreatedBy   string
+	// Subject describes what was reported and is empty once it's deleted.
+	Subject       string
+	SubjectHidden bool
+	// SoundTestID is the reported soundtest or the one a reported comment
+	// was left on.
+	SoundTestID *uuid.UUID
+	// OwnerID is the uploader, comment author or reported user.
+	OwnerID     *uuid.UUID
+	Owner       string
+	OpenReports int
+}
+
+type ModerationModel struct {
+	DB *pgxpool.Pool
+}
+
+var subjectExists = map[string]string{
+	SubjectSoundTest: "SELECT EXISTS(SELECT true FROM sound_test WHERE sound_test_id = $1)",
+	SubjectComment:   "SELECT EXISTS(SELECT true FROM sound_test_comment WHERE sound_test_comment_id = $1 AND NOT deleted)",
+	SubjectUser:      "SELECT EXISTS(SELECT true FROM user_profile WHERE user_profile_id = $1)",
+}
+
+// Report flags a subject for moderators. Reporting something the user already
+// has an open report on is a no-op.
+func (m *ModerationModel) Report(subjectType, subjectID, reason, details, userID string) error {
+	query, ok := subjectExists[subjectType]
+	if !ok {
+		return ErrNoRecord
+	}
+
+	var exists bool
+	err := m.DB.QueryRow(context.Background(), query, subjectID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNoRecord
+	}
+
+	stmt := `INSERT INTO report (subject_type, subject_id, reason, details, created_by)
+		SELECT $1, $2, $3, $4, $5
+		WHERE NOT EXISTS (
+			SELECT true
+			FROM report
+			WHERE subject_type = $1 AND subject_id = $2 AND created_by = $5 AND resolved IS NULL
+		)`
+
+	_, err = m.DB.Exec(context.Background(), stmt, subjectType, subjectID, reason, details, userID)
+	return err
+}
+
+const reportSelect = `SELECT
+		r.report_id,
+		r.subject_type,
+		r.subject_id,
+		r.reason,
+		r.details,
+		r.created,
+		COALESCE(reporter.username, 'anonymous'),
+		COALESCE(CASE r.subject_type
+			WHEN 'soundtest' THEN k.name || ' · ' || ks.name
+			WHEN 'comment' THEN NULLIF(c.body, '')
+			WHEN 'user' THEN COALESCE(owner.username, owner.email)
+		END, ''),
+		COALESCE(st.hidden, false),
+		COALESCE(st.sound_test_id, c.sound_test_id),
+		owner.user_profile_id,
+		COALESCE(owner.username, 'anonymous'),
+		(SELECT count(*)
+		FROM report other
+		WHERE
+			other.subject_type = r.subject_type
+			AND other.subject_id = r.subject_id
+			AND other.resolved IS NULL)
+	FROM report r
+	JOIN user_profile reporter ON reporter.user_profile_id = r.created_by
+	LEFT JOIN sound_test st ON r.subject_type = 'soundtest' AND st.sound_test_id = r.subject_id
+	LEFT JOIN keyboard k ON k.keyboard_id = st.keyboard_id
+	LEFT JOIN keyswitch ks ON ks.keyswitch_id = st.keyswitch_id
+	LEFT JOIN sound_test_comment c ON r.subject_type = 'comment' AND c.sound_test_comment_id = r.subject_id AND NOT c.deleted
+	LEFT JOIN user_profile owner ON owner.user_profile_id = CASE r.subject_type
+		WHEN 'soundtest' THEN st.created_by
+		WHEN 'comment' THEN c.created_by
+		ELSE r.subject_id
+	END`
+
+func scanReport(row pgx.Row) (Report, error) {
+	var r Report
+
+	err := row.Scan(&r.ID, &r.SubjectType, &r.SubjectID, &r.Reason, &r.Details, &r.Created, &r.CreatedBy, &r.Subject, &r.SubjectHidden, &r.SoundTestID, &r.OwnerID, &r.Owner, &r.OpenReports)
+
+	return r, err
+}
+
+// GetOpen lists unresolved reports, oldest first.
+func (m *ModerationModel) GetOpen() ([]Report, error) {
+	var reports []Report
+
+	stmt := reportSelect + `
+		WHERE r.resolved IS NULL
+		ORDER BY r.created`
+
+	rows, err := m.DB.Query(context.Background(), stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		reports = append(reports, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// GetOpenReport returns an unresolved report.
+func (m *ModerationModel) GetOpenReport(reportID string) (Report, error) {
+	stmt := reportSelect + `
+		WHERE r.report_id = $1 AND r.resolved IS NULL`
+
+	r, err := scanReport(m.DB.QueryRow(context.Background(), stmt, reportID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return r, ErrNoRecord
+		}
+		return r, err
+	}
+
+	return r, nil
+}
+
+// Moderate takes action on the subject of an open report, records it in the
+// moderation log and resolves every open report on the same subject. Deleting
+// a soundtest returns the storage key of its recording for the caller to
+// remove. Featured soundtests are part of play history and can only be hidden.
+func (m *ModerationModel) Moderate(reportID, action, moderatorID, note string) (objKey string, err error) {
+	err = m.act(reportID, action, moderatorID, note, func(tx pgx.Tx, r Report) error {
+		var stmt string
+
+		switch {
+		case action == ActionDismiss:
+			return nil
+		case action == ActionHide:
+			stmt = "UPDATE sound_test SET hidden = true WHERE sound_test_id = $1"
+		case action == ActionDelete && r.SubjectType == SubjectComment:
+			stmt = "UPDATE sound_test_comment SET deleted = true, last_updated = now() WHERE sound_test_comment_id = $1"
+		case action == ActionDelete && r.SubjectType == SubjectSoundTest:
+			return deleteSoundTest(tx, r.SubjectID, &objKey)
+		case action == ActionWarn:
+			if r.OwnerID == nil || note == "" {
+				return ErrNoRecord
+			}
+			_, err := tx.Exec(context.Background(), "INSERT INTO user_warning (user_profile_id, message) VALUES ($1, $2)", r.OwnerID, note)
+			return err
+		case action == ActionSuspend:
+			if r.OwnerID == nil {
+				return ErrNoRecord
+			}
+			_, err := tx.Exec(context.Background(), "UPDATE user_profile SET suspended = now() WHERE user_profile_id = $1 AND suspended IS NULL", r.OwnerID)
+			return err
+		default:
+			return ErrNoRecord
+		}
+
+		tag, err := tx.Exec(context.Background(), stmt, r.SubjectID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNoRecord
+		}
+
+		return nil
+	})
+
+	return objKey, err
+}
+
+func deleteSoundTest(tx pgx.Tx, soundtestID uuid.UUID, objKey *string) error {
+	var featured bool
+
+	err := tx.QueryRow(context.Background(), "SELECT featured_on IS NOT NULL FROM sound_test WHERE sound_test_id = $1 FOR UPDATE", soundtestID).Scan(&featured)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+	if featured {
+		return ErrFeatured
+	}
+
+	_, err = tx.Exec(context.Background(), "DELETE FROM vote WHERE sound_test_id = $1", soundtestID)
+	if err != nil {
+		return err
+	}
+
+	return tx.QueryRow(context.Background(), "DELETE FROM sound_test WHERE sound_test_id = $1 RETURNING url", soundtestID).Scan(objKey)
+}
+
+// CorrectParts fixes the parts of a reported soundtest that was mislabeled.
+func (m *ModerationModel) CorrectParts(reportID, moderatorID, note, keyboard, plateMaterial, keycapMaterial, keyswitch string) error {
+	return m.act(reportID, ActionCorrect, moderatorID, note, func(tx pgx.Tx, r Report) error {
+		stmt := `UPDATE sound_test
+			SET keyboard_id = $2, plate_material_id = $3, keycap_material_id = $4, keyswitch_id = $5, last_updated = now()
+			WHERE sound_test_id = $1`
+
+		tag, err := tx.Exec(context.Background(), stmt, r.SubjectID, keyboard, plateMaterial, keycapMaterial, keyswitch)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNoRecord
+		}
+
+		return nil
+	})
+}
+
+// act runs apply against the report's subject inside a transaction, then logs
+// the action and resolves the subject's open reports.
+func (m *ModerationModel) act(reportID, action, moderatorID, note string, apply func(tx pgx.Tx, r Report) error) error {
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	r, err := scanReport(tx.QueryRow(context.Background(), reportSelect+`
+		WHERE r.report_id = $1 AND r.resolved IS NULL
+		FOR UPDATE OF r`, reportID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if !CanModerate(r.SubjectType, action) {
+		return ErrNoRecord
+	}
+
+	err = apply(tx, r)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO moderation_log (action, subject_type, subject_id, report_id, note, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err = tx.Exec(context.Background(), stmt, action, r.SubjectType, r.SubjectID, r.ID, note, moderatorID)
+	if err != nil {
+		return err
+	}
+
+	stmt = `UPDATE report
+		SET resolved = now(), resolved_by = $3
+		WHERE subject_type = $1 AND subject_id = $2 AND resolved IS NULL`
+
+	_, err = tx.Exec(context.Background(), stmt, r.SubjectType, r.SubjectID, moderatorID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+type LogEntry struct {
+	ID          uuid.UUID
+	Action      string
+	SubjectType string
+	SubjectID   uuid.UUID
+	ReportID    *uuid.UUID
+	Note        string
+	Created     time.Time
+	CreatedBy   string
+}
+
+func (m *ModerationModel) GetLog(limit int) ([]LogEntry, error) {
+	var entries []LogEntry
+
+	stmt := `SELECT
+			ml.moderation_log_id,
+			ml.action,
+			ml.subject_type,
+			ml.subject_id,
+			ml.report_id,
+			ml.note,
+			ml.created,
+			CASE WHEN ml.created_by IS NULL THEN 'system' ELSE COALESCE(up.username, up.email, 'deleted user') END
+		FROM moderation_log ml
+		LEFT JOIN user_profile up ON up.user_profile_id = ml.created_by
+		ORDER BY ml.created DESC
+		LIMIT $1`
+
+	rows, err := m.DB.Query(context.Background(), stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e LogEntry
+
+		err := rows.Scan(&e.ID, &e.Action, &e.SubjectType, &e.SubjectID, &e.ReportID, &e.Note, &e.Created, &e.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import "testing"
+
+func TestCanModerate(t *testing.T) {
+	tests := map[string]struct {
+		subjectType string
+		action      string
+		want        bool
+	}{
+		"hide soundtest": {
+			subjectType: SubjectSoundTest,
+			action:      ActionHide,
+			want:        true,
+		},
+		"correct soundtest": {
+			subjectType: SubjectSoundTest,
+			action:      ActionCorrect,
+			want:        true,
+		},
+		"delete comment": {
+			subjectType: SubjectComment,
+			action:      ActionDelete,
+			want:        true,
+		},
+		"hide comment": {
+			subjectType: SubjectComment,
+			action:      ActionHide,
+			want:        false,
+		},
+		"delete user": {
+			subjectType: SubjectUser,
+			action:      ActionDelete,
+			want:        false,
+		},
+		"suspend user": {
+			subjectType: SubjectUser,
+			action:      ActionSuspend,
+			want:        true,
+		},
+		"unknown subject": {
+			subjectType: "keyboard",
+			action:      ActionDismiss,
+			want:        false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := CanModerate(tc.subjectType, tc.action)
+			if tc.want != got {
+				t.Errorf("want: %t, got: %t", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	NotifyFeatured = "featured"
+	NotifyComment  = "comment"
+	NotifyReply    = "reply"
+	NotifyVotes    = "votes"
+	NotifyFollower = "follower"
+)
+
+// NotificationKinds are every kind of notification, in the order their email
+// preferences are listed.
+var NotificationKinds = []string{NotifyFeatured, NotifyComment, NotifyReply, NotifyVotes, NotifyFollower}
+
+// NotificationLabels describe each kind on the preferences form.
+var NotificationLabels = map[string]string{
+	NotifyFeatured: "One of my soundtests becomes the sound of the day",
+	NotifyComment:  "Someone comments on one of my soundtests",
+	NotifyReply:    "Someone replies to my comment",
+	NotifyVotes:    "One of my soundtests reaches an upvote milestone",
+	NotifyFollower: "Someone follows me",
+}
+
+// DefaultEmailDigest is whether a kind is in the email digest for users who
+// haven't changed their preferences.
+var DefaultEmailDigest = map[string]bool{
+	NotifyFeatured: true,
+	NotifyComment:  true,
+	NotifyReply:    true,
+	NotifyVotes:    false,
+	NotifyFollower: false,
+}
+
+// VoteMilestones are the upvote counts that notify the uploader.
+var VoteMilestones = []int{10, 25, 50, 100, 250, 500, 1000}
+
+type Notification struct {
+	ID          uuid.UUID
+	Kind        string
+	SoundTestID *uuid.UUID
+	CommentID   *uuid.UUID
+	Actor       string
+	Milestone   int
+	Created     time.Time
+	Read        *time.Time
+}
+
+func (n Notification) Message() string {
+	switch n.Kind {
+	case NotifyFeatured:
+		return "Your soundtest is the sound of the day"
+	case NotifyComment:
+		return fmt.Sprintf("@%s commented on your soundtest", n.Actor)
+	case NotifyReply:
+		return fmt.Sprintf("@%s replied to your comment", n.Actor)
+	case NotifyVotes:
+		return fmt.Sprintf("Your soundtest reached %d upvotes", n.Milestone)
+	case NotifyFollower:
+		return fmt.Sprintf("@%s started following you", n.Actor)
+	default:
+		return ""
+	}
+}
+
+// Path is where on the site the notification leads.
+func (n Notification) Path() string {
+	switch {
+	case n.Kind == NotifyFollower:
+		return "/u/" + url.PathEscape(n.Actor)
+	case n.CommentID != nil && n.SoundTestID != nil:
+		return fmt.Sprintf("/soundtest/%s#comment-%s", n.SoundTestID, n.CommentID)
+	case n.SoundTestID != nil:
+		return fmt.Sprintf("/soundtest/%s", n.SoundTestID)
+	default:
+		return "/notifications"
+	}
+}
+
+type NotificationModel struct {
+	DB *pgxpool.Pool
+}
+
+func (m *NotificationModel) NotifyFeatured(soundtestID uuid.UUID) error {
+	stmt := `INSERT INTO notification (user_profile_id, kind, sound_test_id)
+		SELECT created_by, 'featured', sound_test_id
+		FROM sound_test
+		WHERE sound_test_id = $1
+		ON CONFLICT DO NOTHING`
+
+	_, err := m.DB.Exec(context.Background(), stmt, soundtestID)
+	return err
+}
+
+// NotifyComment tells the uploader about a new comment and, for replies, the
+// author of the parent comment. Nobody is notified about their own comment and
+// an uploader replied to on their own soundtest only gets the reply.
+func (m *NotificationModel) NotifyComment(commentID uuid.UUID) error {
+	stmt := `WITH c AS (
+			SELECT
+				c.sound_test_comment_id,
+				c.sound_test_id,
+				c.created_by AS actor,
+				st.created_by AS owner,
+				p.created_by AS parent_author
+			FROM sound_test_comment c
+			JOIN sound_test st ON st.sound_test_id = c.sound_test_id
+			LEFT JOIN sound_test_comment p ON p.sound_test_comment_id = c.parent_id AND NOT p.deleted
+			WHERE c.sound_test_comment_id = $1
+		)
+		INSERT INTO notification (user_profile_id, kind, sound_test_id, comment_id, actor_id)
+		SELECT parent_author, 'reply', sound_test_id, sound_test_comment_id, actor
+		FROM c
+		WHERE parent_author IS NOT NULL AND parent_author <> actor
+		UNION ALL
+		SELECT owner, 'comment', sound_test_id, sound_test_comment_id, actor
+		FROM c
+		WHERE owner <> actor AND owner IS DISTINCT FROM parent_author`
+
+	_, err := m.DB.Exec(context.Background(), stmt, commentID)
+	return err
+}
+
+// NotifyVoteMilestones tells the uploader about every milestone the soundtest
+// has reached that they haven't been told about yet.
+func (m *NotificationModel) NotifyVoteMilestones(soundtestID string) error {
+	stmt := `INSERT INTO notification (user_profile_id, kind, sound_test_id, milestone)
+		SELECT st.created_by, 'votes', st.sound_test_id, milestone
+		FROM sound_test st
+		JOIN sound_test_tally t ON t.sound_test_id = st.sound_test_id
+		CROSS JOIN unnest($2::int[]) milestone
+		WHERE st.sound_test_id = $1 AND t.upvotes >= milestone
+		ON CONFLICT DO NOTHING`
+
+	_, err := m.DB.Exec(context.Background(), stmt, soundtestID, VoteMilestones)
+	return err
+}
+
+func (m *NotificationModel) NotifyFollower(followeeID, followerID string) error {
+	stmt := `INSERT INTO notification (user_profile_id, kind, actor_id)
+		VALUES ($1, 'follower', $2)
+		ON CONFLICT DO NOTHING`
+
+	_, err := m.DB.Exec(context.Background(), stmt, followeeID, followerID)
+	return err
+}
+
+func (m *NotificationModel) GetRecent(userID string, limit int) ([]Notification, error) {
+	stmt := `SELECT
+			n.notification_id,
+			n.kind,
+			n.sound_test_id,
+			n.comment_id,
+			COALESCE(a.username, 'anonymous'),
+			COALESCE(n.milestone, 0),
+			n.created,
+			n.read
+		FROM notification n
+		LEFT JOIN user_profile a ON a.user_profile_id = n.actor_id
+		WHERE n.user_profile_id = $1
+		ORDER BY n.created DESC
+		LIMIT $2`
+
+	return m.query(stmt, userID, limit)
+}
+
+func (m *NotificationModel) query(stmt string, args ...any) ([]Notification, error) {
+	var notifications []Notification
+
+	rows, err := m.DB.Query(context.Background(), stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n Notification
+
+		err := rows.Scan(&n.ID, &n.Kind, &n.SoundTestID, &n.CommentID, &n.Actor, &n.Milestone, &n.Created, &n.Read)
+		if err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// MarkAllRead marks every notification created up to before as read.
+func (m *NotificationModel) MarkAllRead(userID string, before time.Time) error {
+	stmt := `UPDATE notification
+		SET read = now()
+		WHERE user_profile_id = $1 AND read IS NULL AND created <= $2`
+
+	_, err := m.DB.Exec(context.Background(), stmt, userID, before)
+	return err
+}
+
+// GetEmailPreferences returns whether each of NotificationKinds is in the
+// user's email digest.
+func (m *NotificationModel) GetEmailPreferences(userID string) (map[string]bool, error) {
+	prefs := make(map[string]bool, len(DefaultEmailDigest))
+	for kind, email := range DefaultEmailDigest {
+		prefs[kind] = email
+	}
+
+	rows, err := m.DB.Query(context.Background(), "SELECT kind, email FROM notification_preference WHERE user_profile_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var email bool
+
+		err := rows.Scan(&kind, &email)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := prefs[kind]; ok {
+			prefs[kind] = email
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+func (m *NotificationModel) SetEmailPreferences(userID string, prefs map[string]bool) error {
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	stmt := `INSERT INTO notification_preference (user_profile_id, kind, email)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_profile_id, kind) DO UPDATE SET email = EXCLUDED.email`
+
+	for _, kind := range NotificationKinds {
+		_, err = tx.Exec(context.Background(), stmt, userID, kind, prefs[kind])
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Digest is the unread notifications waiting to be emailed to one user.
+type Digest struct {
+	UserID        uuid.UUID
+	Email         string
+	Notifications []Notification
+}
+
+// GetDigests collects every unread, unemailed notification of a kind the
+// user wants emailed, grouped by user.
+func (m *NotificationModel) GetDigests() ([]Digest, error) {
+	var digests []Digest
+
+	stmt := `SELECT
+			n.user_profile_id,
+			up.email,
+			n.notification_id,
+			n.kind,
+			n.sound_test_id,
+			n.comment_id,
+			COALESCE(a.username, 'anonymous'),
+			COALESCE(n.milestone, 0),
+			n.created,
+			n.read
+		FROM notification n
+		JOIN user_profile up ON up.user_profile_id = n.user_profile_id
+		LEFT JOIN user_profile a ON a.user_profile_id = n.actor_id
+		LEFT JOIN notification_preference np ON np.user_profile_id = n.user_profile_id AND np.kind = n.kind
+		WHERE
+			n.emailed IS NULL
+			AND n.read IS NULL
+			AND up.suspended IS NULL
+			AND COALESCE(np.email, n.kind = ANY($1::text[]))
+		ORDER BY n.user_profile_id, n.created`
+
+	rows, err := m.DB.Query(context.Background(), stmt, defaultEmailKinds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID uuid.UUID
+		var email string
+		var n Notification
+
+		err := rows.Scan(&userID, &email, &n.ID, &n.Kind, &n.SoundTestID, &n.CommentID, &n.Actor, &n.Milestone, &n.Created, &n.Read)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(digests) == 0 || digests[len(digests)-1].UserID != userID {
+			digests = append(digests, Digest{UserID: userID, Email: email})
+		}
+		d := &digests[len(digests)-1]
+		d.Notifications = append(d.Notifications, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return digests, nil
+}
+
+func defaultEmailKinds() []string {
+	var kinds []string
+	for _, kind := range NotificationKinds {
+		if DefaultEmailDigest[kind] {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+func (m *NotificationModel) MarkEmailed(ids []uuid.UUID) error {
+	_, err := m.DB.Exec(context.Background(), "UPDATE notification SET emailed = now() WHERE notification_id = ANY($1)", ids)
+	return err
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestNotification(t *testing.T) {
+	soundtestID := uuid.Must(uuid.FromString("05ff139b-8b9a-4341-a161-8628c3e038e7"))
+	commentID := uuid.Must(uuid.FromString("2a0f3ad4-216d-43db-a731-fdab599e2d45"))
+
+	tests := map[string]struct {
+		notification Notification
+		wantMessage  string
+		wantPath     string
+	}{
+		"featured": {
+			notification: Notification{Kind: NotifyFeatured, SoundTestID: &soundtestID},
+			wantMessage:  "Your soundtest is the sound of the day",
+			wantPath:     "/soundtest/05ff139b-8b9a-4341-a161-8628c3e038e7",
+		},
+		"comment": {
+			notification: Notification{Kind: NotifyComment, SoundTestID: &soundtestID, CommentID: &commentID, Actor: "bob"},
+			wantMessage:  "@bob commented on your soundtest",
+			wantPath:     "/soundtest/05ff139b-8b9a-4341-a161-8628c3e038e7#comment-2a0f3ad4-216d-43db-a731-fdab599e2d45",
+		},
+		"reply": {
+			notification: Notification{Kind: NotifyReply, SoundTestID: &soundtestID, CommentID: &commentID, Actor: "bob"},
+			wantMessage:  "@bob replied to your comment",
+			wantPath:     "/soundtest/05ff139b-8b9a-4341-a161-8628c3e038e7#comment-2a0f3ad4-216d-43db-a731-fdab599e2d45",
+		},
+		"votes": {
+			notification: Notification{Kind: NotifyVotes, SoundTestID: &soundtestID, Milestone: 25},
+			wantMessage:  "Your soundtest reached 25 upvotes",
+			wantPath:     "/soundtest/05ff139b-8b9a-4341-a161-8628c3e038e7",
+		},
+		"follower": {
+			notification: Notification{Kind: NotifyFollower, Actor: "bob smith"},
+			wantMessage:  "@bob smith started following you",
+			wantPath:     "/u/bob%20smith",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.notification.Message(); got != tc.wantMessage {
+				t.Errorf("wrong message, got: %q, want: %q", got, tc.wantMessage)
+			}
+			if got := tc.notification.Path(); got != tc.wantPath {
+				t.Errorf("wrong path, got: %q, want: %q", got, tc.wantPath)
+			}
+		})
+	}
+}
+
+func TestDefaultEmailDigest(t *testing.T) {
+	for _, kind := range NotificationKinds {
+		if _, ok := DefaultEmailDigest[kind]; !ok {
+			t.Errorf("no default email digest setting for %s", kind)
+		}
+		if NotificationLabels[kind] == "" {
+			t.Errorf("no label for %s", kind)
+		}
+	}
+}
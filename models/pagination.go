@@ -0,0 +1,146 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+var ErrInvalidCursor = errors.New("models: invalid cursor")
+
+// Cursor marks a position in a listing ordered by (sort key, uploaded, id),
+// all descending. Listings that are only ordered by upload date leave SortKey
+// at zero.
+type Cursor struct {
+	SortKey  float64
+	Uploaded time.Time
+	ID       uuid.UUID
+}
+
+func (c Cursor) Encode() string {
+	raw := strconv.FormatFloat(c.SortKey, 'g', -1, 64) + "|" + c.Uploaded.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return c, ErrInvalidCursor
+	}
+
+	c.SortKey, err = strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	c.Uploaded, err = time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	c.ID, err = uuid.FromString(parts[2])
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// PageRequest asks for Limit rows after or before a cursor. With neither
+// cursor set it asks for the first page.
+type PageRequest struct {
+	After  *Cursor
+	Before *Cursor
+	Limit  int
+}
+
+type PageInfo struct {
+	HasNext    bool
+	HasPrev    bool
+	NextCursor string
+	PrevCursor string
+}
+
+// keyset returns the condition, ordering and limit that select the requested
+// page from a query exposing sort_key, uploaded and sound_test_id columns.
+// Listings that aren't ranked leave sort_key out so they can use the
+// (uploaded, sound_test_id) index. One extra row is fetched so the caller can
+// tell whether more pages follow.
+func (p PageRequest) keyset(ranked bool, args []any) (cond, orderBy, limit string, _ []any) {
+	columns := []string{"uploaded", "sound_test_id"}
+	if ranked {
+		columns = append([]string{"sort_key"}, columns...)
+	}
+
+	order := " DESC"
+	cursor, op := p.After, "<"
+	if p.Before != nil {
+		cursor, op, order = p.Before, ">", ""
+	}
+
+	orderBy = "ORDER BY " + strings.Join(columns, order+", ") + order
+	cond = "true"
+
+	if cursor != nil {
+		if ranked {
+			args = append(args, cursor.SortKey)
+		}
+		args = append(args, cursor.Uploaded, cursor.ID)
+
+		placeholders := make([]string, len(columns))
+		for i := range columns {
+			placeholders[i] = fmt.Sprintf("$%d", len(args)-len(columns)+i+1)
+		}
+		cond = fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), op, strings.Join(placeholders, ", "))
+	}
+
+	args = append(args, p.Limit+1)
+	limit = fmt.Sprintf("LIMIT $%d", len(args))
+
+	return cond, orderBy, limit, args
+}
+
+// trimPage drops the lookahead row fetched by keyset, restores descending
+// order for backwards pages and works out the links to neighbouring pages.
+func trimPage[T any](items []T, p PageRequest, cursor func(T) Cursor) ([]T, PageInfo) {
+	var info PageInfo
+
+	hasMore := len(items) > p.Limit
+	if hasMore {
+		items = items[:p.Limit]
+	}
+
+	if p.Before != nil {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+		info.HasPrev = hasMore
+		info.HasNext = true
+	} else {
+		info.HasNext = hasMore
+		info.HasPrev = p.After != nil
+	}
+
+	// An empty page past either end leaves the cursors blank, which links
+	// back to the first page.
+	if len(items) == 0 {
+		return items, info
+	}
+
+	info.PrevCursor = cursor(items[0]).Encode()
+	info.NextCursor = cursor(items[len(items)-1]).Encode()
+
+	return items, info
+}
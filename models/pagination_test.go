@@ -0,0 +1,194 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := map[string]Cursor{
+		"upload date only": {
+			Uploaded: time.Date(2022, time.August, 20, 13, 4, 5, 123456000, time.UTC),
+			ID:       uuid.Must(uuid.FromString("05ff139b-8b9a-4341-a161-8628c3e038e7")),
+		},
+		"with sort key": {
+			SortKey:  -12.5,
+			Uploaded: time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC),
+			ID:       uuid.Must(uuid.FromString("2a0f3ad4-216d-43db-a731-fdab599e2d45")),
+		},
+	}
+
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := DecodeCursor(want.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.SortKey != want.SortKey || !got.Uploaded.Equal(want.Uploaded) || got.ID != want.ID {
+				t.Errorf("want: %+v, got: %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := map[string]string{
+		"not base64":   "%%%",
+		"missing part": Cursor{}.Encode()[:10],
+		"bad uuid":     "MHwyMDIyLTAxLTAxVDAwOjAwOjAwWnxub3Bl",
+	}
+
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeCursor(s)
+			if err != ErrInvalidCursor {
+				t.Errorf("want: %v, got: %v", ErrInvalidCursor, err)
+			}
+		})
+	}
+}
+
+func TestPageRequestKeyset(t *testing.T) {
+	cursor := &Cursor{SortKey: 3, Uploaded: time.Date(2022, time.August, 20, 0, 0, 0, 0, time.UTC)}
+
+	tests := map[string]struct {
+		page        PageRequest
+		unranked    bool
+		wantCond    string
+		wantOrderBy string
+		wantLimit   string
+		wantArgs    []any
+	}{
+		"first page": {
+			page:        PageRequest{Limit: 10},
+			wantCond:    "true",
+			wantOrderBy: "ORDER BY sort_key DESC, uploaded DESC, sound_test_id DESC",
+			wantLimit:   "LIMIT $2",
+			wantArgs:    []any{"user", 11},
+		},
+		"after cursor": {
+			page:        PageRequest{After: cursor, Limit: 10},
+			wantCond:    "(sort_key, uploaded, sound_test_id) < ($2, $3, $4)",
+			wantOrderBy: "ORDER BY sort_key DESC, uploaded DESC, sound_test_id DESC",
+			wantLimit:   "LIMIT $5",
+			wantArgs:    []any{"user", cursor.SortKey, cursor.Uploaded, cursor.ID, 11},
+		},
+		"before cursor": {
+			page:        PageRequest{Before: cursor, Limit: 5},
+			wantCond:    "(sort_key, uploaded, sound_test_id) > ($2, $3, $4)",
+			wantOrderBy: "ORDER BY sort_key, uploaded, sound_test_id",
+			wantLimit:   "LIMIT $5",
+			wantArgs:    []any{"user", cursor.SortKey, cursor.Uploaded, cursor.ID, 6},
+		},
+		"unranked first page": {
+			page:        PageRequest{Limit: 10},
+			unranked:    true,
+			wantCond:    "true",
+			wantOrderBy: "ORDER BY uploaded DESC, sound_test_id DESC",
+			wantLimit:   "LIMIT $2",
+			wantArgs:    []any{"user", 11},
+		},
+		"unranked after cursor": {
+			page:        PageRequest{After: cursor, Limit: 10},
+			unranked:    true,
+			wantCond:    "(uploaded, sound_test_id) < ($2, $3)",
+			wantOrderBy: "ORDER BY uploaded DESC, sound_test_id DESC",
+			wantLimit:   "LIMIT $4",
+			wantArgs:    []any{"user", cursor.Uploaded, cursor.ID, 11},
+		},
+		"unranked before cursor": {
+			page:        PageRequest{Before: cursor, Limit: 5},
+			unranked:    true,
+			wantCond:    "(uploaded, sound_test_id) > ($2, $3)",
+			wantOrderBy: "ORDER BY uploaded, sound_test_id",
+			wantLimit:   "LIMIT $4",
+			wantArgs:    []any{"user", cursor.Uploaded, cursor.ID, 6},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cond, orderBy, limit, args := tc.page.keyset(!tc.unranked, []any{"user"})
+			if cond != tc.wantCond {
+				t.Errorf("want cond: %q, got: %q", tc.wantCond, cond)
+			}
+			if orderBy != tc.wantOrderBy {
+				t.Errorf("want orderBy: %q, got: %q", tc.wantOrderBy, orderBy)
+			}
+			if limit != tc.wantLimit {
+				t.Errorf("want limit: %q, got: %q", tc.wantLimit, limit)
+			}
+			if !reflect.DeepEqual(args, tc.wantArgs) {
+				t.Errorf("want args: %v, got: %v", tc.wantArgs, args)
+			}
+		})
+	}
+}
+
+func TestTrimPage(t *testing.T) {
+	cursor := func(i int) Cursor {
+		return Cursor{SortKey: float64(i)}
+	}
+	key := func(i int) string {
+		return cursor(i).Encode()
+	}
+
+	tests := map[string]struct {
+		items     []int
+		page      PageRequest
+		wantItems []int
+		wantInfo  PageInfo
+	}{
+		"first page with more": {
+			items:     []int{9, 8, 7},
+			page:      PageRequest{Limit: 2},
+			wantItems: []int{9, 8},
+			wantInfo:  PageInfo{HasNext: true, PrevCursor: key(9), NextCursor: key(8)},
+		},
+		"only page": {
+			items:     []int{9, 8},
+			page:      PageRequest{Limit: 2},
+			wantItems: []int{9, 8},
+			wantInfo:  PageInfo{PrevCursor: key(9), NextCursor: key(8)},
+		},
+		"last page after cursor": {
+			items:     []int{7},
+			page:      PageRequest{After: &Cursor{}, Limit: 2},
+			wantItems: []int{7},
+			wantInfo:  PageInfo{HasPrev: true, PrevCursor: key(7), NextCursor: key(7)},
+		},
+		"before cursor with more": {
+			items:     []int{5, 6, 7},
+			page:      PageRequest{Before: &Cursor{}, Limit: 2},
+			wantItems: []int{6, 5},
+			wantInfo:  PageInfo{HasNext: true, HasPrev: true, PrevCursor: key(6), NextCursor: key(5)},
+		},
+		"before cursor reaching start": {
+			items:     []int{8, 9},
+			page:      PageRequest{Before: &Cursor{}, Limit: 2},
+			wantItems: []int{9, 8},
+			wantInfo:  PageInfo{HasNext: true, PrevCursor: key(9), NextCursor: key(8)},
+		},
+		"empty": {
+			items:     []int{},
+			page:      PageRequest{Limit: 2},
+			wantItems: []int{},
+			wantInfo:  PageInfo{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			items, info := trimPage(tc.items, tc.page, cursor)
+			if !reflect.DeepEqual(items, tc.wantItems) {
+				t.Errorf("want items: %v, got: %v", tc.wantItems, items)
+			}
+			if info != tc.wantInfo {
+				t.Errorf("want info: %+v, got: %+v", tc.wantInfo, info)
+			}
+		})
+	}
+}
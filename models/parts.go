@@ -2,7 +2,6 @@ package models
 
 import (
 	"context"
-	"math/rand"
 
 	"github.com/gofrs/uuid"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -21,6 +20,11 @@ type Keyswitch struct {
 	KeyswitchTypeName string
 }
 
+type KeyswitchType struct {
+	ID   uuid.UUID
+	Name string
+}
+
 type PlateMaterial struct {
 	ID   uuid.UUID
 	Name string
@@ -33,13 +37,18 @@ type KeycapMaterial struct {
 
 type PartsModel struct {
 	DB *pgxpool.Pool
+	// Difficulty is how close the daily play's distractors are to the
+	// correct answer, one of Difficulties. Medium when unset.
+	Difficulty string
 }
 
 type AllParts struct {
 	Keyboards       []Keyboard
 	Switches        []Keyswitch
+	SwitchTypes     []KeyswitchType
 	PlateMaterials  []PlateMaterial
 	KeycapMaterials []KeycapMaterial
+	Attributes      []BuildAttribute
 }
 
 func (m *PartsModel) GetAll() (AllParts, error) {
@@ -62,6 +71,14 @@ func (m *PartsModel) GetAll() (AllParts, error) {
 		return err
 	})
 
+	g.Go(func() error {
+		switchTypes, err := m.GetKeyswitchTypes()
+		if err == nil {
+			ap.SwitchTypes = switchTypes
+		}
+		return err
+	})
+
 	g.Go(func() error {
 		plateMaterials, err := m.GetPlateMaterials()
 		if err == nil {
@@ -78,6 +95,14 @@ func (m *PartsModel) GetAll() (AllParts, error) {
 		return err
 	})
 
+	g.Go(func() error {
+		attributes, err := m.GetBuildAttributes()
+		if err == nil {
+			ap.Attributes = attributes
+		}
+		return err
+	})
+
 	err := g.Wait()
 	if err != nil {
 		return ap, nil
@@ -145,6 +170,37 @@ func (m *PartsModel) GetSwitches() ([]Keyswitch, error) {
 	return switches, nil
 }
 
+func (m *PartsModel) GetKeyswitchTypes() ([]KeyswitchType, error) {
+	var switchTypes []KeyswitchType
+
+	stmt := `SELECT keyswitch_type_id, name
+		FROM keyswitch_type
+		ORDER BY name`
+
+	rows, err := m.DB.Query(context.Background(), stmt)
+	if err != nil {
+		return switchTypes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k KeyswitchType
+
+		err := rows.Scan(&k.ID, &k.Name)
+		if err != nil {
+			return switchTypes, err
+		}
+
+		switchTypes = append(switchTypes, k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return switchTypes, err
+	}
+
+	return switchTypes, nil
+}
+
 func (m *PartsModel) GetPlateMaterials() ([]PlateMaterial, error) {
 	var plateMaterials []PlateMaterial
 
@@ -199,22 +255,96 @@ func (m *PartsModel) GetKeycapMaterials() ([]KeycapMaterial, error) {
 	return keycapMaterials, nil
 }
 
-func (m *PartsModel) GetKeyboardOpts(correctKeyboard uuid.UUID) ([]Keyboard, error) {
-	var keyboardOpts []Keyboard
+type BuildAttributeOption struct {
+	ID   uuid.UUID
+	Name string
+}
 
-	stmt := `SELECT keyboard_id, name
-		FROM keyboard
+type BuildAttribute struct {
+	ID         uuid.UUID
+	Name       string
+	BonusRound bool
+	Options    []BuildAttributeOption
+}
+
+func (m *PartsModel) GetBuildAttributes() ([]BuildAttribute, error) {
+	stmt := `SELECT
+			ba.build_attribute_id,
+			ba.name,
+			ba.bonus_round,
+			bao.build_attribute_option_id,
+			bao.name
+		FROM build_attribute ba
+		JOIN build_attribute_option bao USING (build_attribute_id)
+		ORDER BY ba.sort_order, ba.name, bao.name`
+
+	return m.queryBuildAttributes(stmt)
+}
+
+func (m *PartsModel) GetBonusRounds(soundtestID uuid.UUID) ([]BuildAttribute, error) {
+	stmt := `SELECT
+			ba.build_attribute_id,
+			ba.name,
+			ba.bonus_round,
+			bao.build_attribute_option_id,
+			bao.name
+		FROM build_attribute ba
+		JOIN build_attribute_option bao USING (build_attribute_id)
 		WHERE
-			keyboard_id = $1 OR
-			keyboard_id IN (
-				SELECT keyboard_id
-				FROM keyboard
-				WHERE keyboard_id != $1
-				ORDER BY random()
-				LIMIT 3
-			)`
-
-	rows, err := m.DB.Query(context.Background(), stmt, correctKeyboard)
+			ba.bonus_round
+			AND EXISTS (
+				SELECT true
+				FROM sound_test_attribute sta
+				WHERE sta.sound_test_id = $1 AND sta.build_attribute_id = ba.build_attribute_id
+			)
+		ORDER BY ba.sort_order, ba.name, bao.name`
+
+	return m.queryBuildAttributes(stmt, soundtestID)
+}
+
+func (m *PartsModel) queryBuildAttributes(stmt string, args ...any) ([]BuildAttribute, error) {
+	var attributes []BuildAttribute
+
+	rows, err := m.DB.Query(context.Background(), stmt, args...)
+	if err != nil {
+		return attributes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a BuildAttribute
+		var o BuildAttributeOption
+
+		err := rows.Scan(&a.ID, &a.Name, &a.BonusRound, &o.ID, &o.Name)
+		if err != nil {
+			return attributes, err
+		}
+
+		if n := len(attributes); n == 0 || attributes[n-1].ID != a.ID {
+			attributes = append(attributes, a)
+		}
+
+		last := &attributes[len(attributes)-1]
+		last.Options = append(last.Options, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return attributes, err
+	}
+
+	return attributes, nil
+}
+
+func (m *PartsModel) GetKeyboardOpts(soundtestID uuid.UUID) ([]Keyboard, error) {
+	var keyboardOpts []Keyboard
+
+	stmt := `SELECT k.keyboard_id, k.name
+		FROM daily_option o
+		JOIN keyboard k ON k.keyboard_id = o.part_id
+		WHERE o.sound_test_id = $1 AND o.part = 'keyboard'
+		ORDER BY o.position`
+
+	rows, err := m.DB.Query(context.Background(), stmt, soundtestID)
 	if err != nil {
 		return keyboardOpts, err
 	}
@@ -231,14 +361,10 @@ func (m *PartsModel) GetKeyboardOpts(correctKeyboard uuid.UUID) ([]Keyboard, err
 		keyboardOpts = append(keyboardOpts, k)
 	}
 
-	rand.Shuffle(len(keyboardOpts), func(i, j int) {
-		keyboardOpts[i], keyboardOpts[j] = keyboardOpts[j], keyboardOpts[i]
-	})
-
 	return keyboardOpts, nil
 }
 
-func (m *PartsModel) GetSwitchOpts(correctSwitch uuid.UUID) ([]Keyswitch, error) {
+func (m *PartsModel) GetSwitchOpts(soundtestID uuid.UUID) ([]Keyswitch, error) {
 	var switchOpts []Keyswitch
 
 	stmt := `SELECT
@@ -246,19 +372,13 @@ func (m *PartsModel) GetSwitchOpts(correctSwitch uuid.UUID) ([]Keyswitch, error)
 			k.name,
 			kt.keyswitch_type_id,
 			kt.name as keyswitch_type_name
-		FROM keyswitch k
+		FROM daily_option o
+		JOIN keyswitch k ON k.keyswitch_id = o.part_id
 		JOIN keyswitch_type kt using (keyswitch_type_id)
-		WHERE
-			k.keyswitch_id = $1 OR
-			k.keyswitch_id IN (
-				SELECT keyswitch_id
-				FROM keyswitch
-				WHERE keyswitch_id != $1
-				ORDER BY random()
-				LIMIT 3
-			)`
-
-	rows, err := m.DB.Query(context.Background(), stmt, correctSwitch)
+		WHERE o.sound_test_id = $1 AND o.part = 'keyswitch'
+		ORDER BY o.position`
+
+	rows, err := m.DB.Query(context.Background(), stmt, soundtestID)
 	if err != nil {
 		return switchOpts, err
 	}
@@ -275,29 +395,19 @@ func (m *PartsModel) GetSwitchOpts(correctSwitch uuid.UUID) ([]Keyswitch, error)
 		switchOpts = append(switchOpts, k)
 	}
 
-	rand.Shuffle(len(switchOpts), func(i, j int) {
-		switchOpts[i], switchOpts[j] = switchOpts[j], switchOpts[i]
-	})
-
 	return switchOpts, nil
 }
 
-func (m *PartsModel) GetPlateOpts(correctPlate uuid.UUID) ([]PlateMaterial, error) {
+func (m *PartsModel) GetPlateOpts(soundtestID uuid.UUID) ([]PlateMaterial, error) {
 	var plateOpts []PlateMaterial
 
-	stmt := `SELECT plate_material_id, name
-		FROM plate_material
-		WHERE
-			plate_material_id = $1 OR
-			plate_material_id IN (
-				SELECT plate_material_id
-				FROM plate_material
-				WHERE plate_material_id != $1
-				ORDER BY random()
-				LIMIT 3
-			)`
-
-	rows, err := m.DB.Query(context.Background(), stmt, correctPlate)
+	stmt := `SELECT pm.plate_material_id, pm.name
+		FROM daily_option o
+		JOIN plate_material pm ON pm.plate_material_id = o.part_id
+		WHERE o.sound_test_id = $1 AND o.part = 'plate-material'
+		ORDER BY o.position`
+
+	rows, err := m.DB.Query(context.Background(), stmt, soundtestID)
 	if err != nil {
 		return plateOpts, err
 	}
@@ -314,19 +424,23 @@ func (m *PartsModel) GetPlateOpts(correctPlate uuid.UUID) ([]PlateMaterial, erro
 		plateOpts = append(plateOpts, p)
 	}
 
-	rand.Shuffle(len(plateOpts), func(i, j int) {
-		plateOpts[i], plateOpts[j] = plateOpts[j], plateOpts[i]
-	})
-
 	return plateOpts, nil
 }
 
-func (m *PartsModel) GetDaily(correctKeyboard, correctSwitch, correctPlate uuid.UUID) (AllParts, error) {
+// GetDaily returns the options offered when playing st, the same for every
+// player. Every keycap material is offered.
+func (m *PartsModel) GetDaily(st SoundTest) (AllParts, error) {
 	var parts AllParts
+
+	err := m.ensureDailyOpts(st)
+	if err != nil {
+		return parts, err
+	}
+
 	g, _ := errgroup.WithContext(context.Background())
 
 	g.Go(func() error {
-		keyboardOpts, err := m.GetKeyboardOpts(correctKeyboard)
+		keyboardOpts, err := m.GetKeyboardOpts(st.ID)
 		if err == nil {
 			parts.Keyboards = keyboardOpts
 		}
@@ -334,7 +448,7 @@ func (m *PartsModel) GetDaily(correctKeyboard, correctSwitch, correctPlate uuid.
 	})
 
 	g.Go(func() error {
-		switchOpts, err := m.GetSwitchOpts(correctSwitch)
+		switchOpts, err := m.GetSwitchOpts(st.ID)
 		if err == nil {
 			parts.Switches = switchOpts
 		}
@@ -342,7 +456,7 @@ func (m *PartsModel) GetDaily(correctKeyboard, correctSwitch, correctPlate uuid.
 	})
 
 	g.Go(func() error {
-		plateOpts, err := m.GetPlateOpts(correctPlate)
+		plateOpts, err := m.GetPlateOpts(st.ID)
 		if err == nil {
 			parts.PlateMaterials = plateOpts
 		}
@@ -357,10 +471,48 @@ func (m *PartsModel) GetDaily(correctKeyboard, correctSwitch, correctPlate uuid.
 		return err
 	})
 
-	err := g.Wait()
+	err = g.Wait()
 	if err != nil {
-		return parts, nil
+		return parts, err
 	}
 
 	return parts, nil
 }
+
+// The Has methods report whether a submitted part was one of the options.
+
+func (ap AllParts) HasKeyboard(id string) bool {
+	for _, k := range ap.Keyboards {
+		if k.ID.String() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (ap AllParts) HasSwitch(id string) bool {
+	for _, k := range ap.Switches {
+		if k.ID.String() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (ap AllParts) HasPlateMaterial(id string) bool {
+	for _, p := range ap.PlateMaterials {
+		if p.ID.String() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (ap AllParts) HasKeycapMaterial(id string) bool {
+	for _, k := range ap.KeycapMaterials {
+		if k.ID.String() == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+)
+
+// practiceable is the condition on sound_test st for the soundtests user $1
+// can practice with: never featured, not hidden, uploaded by someone else and
+// not practiced or answered in a challenge yet.
+const practiceable = `st.featured_on IS NULL
+	AND NOT st.hidden
+	AND st.created_by <> $1
+	AND NOT EXISTS (
+		SELECT true
+		FROM practice_play pp
+		WHERE pp.sound_test_id = st.sound_test_id AND pp.created_by = $1
+	)
+	AND NOT EXISTS (
+		SELECT true
+		FROM challenge_play cp
+		WHERE cp.sound_test_id = st.sound_test_id AND cp.created_by = $1
+	)`
+
+// NextPracticeSound picks a random soundtest for userID to practice with. It
+// returns ErrNoRecord once they've practiced with every one they can.
+func (m *SoundTestModel) NextPracticeSound(userID string) (SoundTest, error) {
+	stmt := `SELECT
+		  st.sound_test_id,
+		  st.url,
+		  st.uploaded,
+		  st.last_updated,
+		  st.keyboard_id,
+		  st.plate_material_id,
+		  st.keycap_material_id,
+		  st.keyswitch_id,
+		  st.created_by
+		FROM sound_test st
+		WHERE ` + practiceable + `
+		ORDER BY random()
+		LIMIT 1`
+
+	return m.scanPracticeSound(stmt, userID)
+}
+
+// GetPracticeSound gets soundtestID if userID can still practice with it,
+// otherwise ErrNoRecord is returned.
+func (m *SoundTestModel) GetPracticeSound(soundtestID, userID string) (SoundTest, error) {
+	stmt := `SELECT
+		  st.sound_test_id,
+		  st.url,
+		  st.uploaded,
+		  st.last_updated,
+		  st.keyboard_id,
+		  st.plate_material_id,
+		  st.keycap_material_id,
+		  st.keyswitch_id,
+		  st.created_by
+		FROM sound_test st
+		WHERE st.sound_test_id = $2 AND ` + practiceable
+
+	return m.scanPracticeSound(stmt, userID, soundtestID)
+}
+
+func (m *SoundTestModel) scanPracticeSound(stmt string, args ...any) (SoundTest, error) {
+	var st SoundTest
+
+	err := m.DB.QueryRow(context.Background(), stmt, args...).Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.KeyboardID, &st.PlateMaterialID, &st.KeycapMaterialID, &st.KeyswitchID, &st.CreatedBy)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return st, ErrNoRecord
+		}
+		return st, err
+	}
+
+	return st, nil
+}
+
+// AddPracticePlay stores userID's guesses for a soundtest played in practice
+// mode and returns them graded. ErrPlayOver is returned if they've already
+// practiced with it.
+func (m *SoundTestModel) AddPracticePlay(soundtest uuid.UUID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch string) (SoundTestPlay, error) {
+	p := SoundTestPlay{Mode: PlayModeClassic, Attempts: 1}
+
+	stmt := `WITH play AS (
+			INSERT INTO practice_play (sound_test_id, created_by, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING *
+		)
+		SELECT
+			pp.sound_test_id,
+			st.url,
+			pp.submitted,
+			COALESCE(up.username, 'anonymous'),
+			k.name,
+			ck.name,
+			pm.name,
+			cpm.name,
+			km.name,
+			ckm.name,
+			ks.name,
+			cks.name
+		FROM play pp
+		JOIN sound_test st USING (sound_test_id)
+		JOIN user_profile up ON st.created_by = up.user_profile_id
+		JOIN keyboard k ON pp.keyboard_id = k.keyboard_id
+		JOIN keyboard ck ON st.keyboard_id = ck.keyboard_id
+		JOIN plate_material pm ON pp.plate_material_id = pm.plate_material_id
+		JOIN plate_material cpm ON st.plate_material_id = cpm.plate_material_id
+		JOIN keycap_material km ON pp.keycap_material_id = km.keycap_material_id
+		JOIN keycap_material ckm ON st.keycap_material_id = ckm.keycap_material_id
+		JOIN keyswitch ks ON pp.keyswitch_id = ks.keyswitch_id
+		JOIN keyswitch cks ON st.keyswitch_id = cks.keyswitch_id`
+
+	err := m.DB.QueryRow(context.Background(), stmt, soundtest, userID, keyboard, plateMaterial, keycapMaterial, keyswitch).Scan(&p.SoundTestID, &p.URL, &p.Submitted, &p.CreatedBy, &p.Keyboard, &p.CorrectKeyboard, &p.PlateMaterial, &p.CorrectPlateMaterial, &p.KeycapMaterial, &p.CorrectKeycapMaterial, &p.Keyswitch, &p.CorrectKeyswitch)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			return p, ErrPlayOver
+		}
+		return p, err
+	}
+
+	return p, nil
+}
+
+// GetPartySounds picks up to n random soundtests that have never been the
+// sound of the day, for playing in a party room.
+func (m *SoundTestModel) GetPartySounds(n int) ([]SoundTest, error) {
+	var soundtests []SoundTest
+
+	stmt := `SELECT
+		  sound_test_id,
+		  url,
+		  uploaded,
+		  last_updated,
+		  keyboard_id,
+		  plate_material_id,
+		  keycap_material_id,
+		  keyswitch_id,
+		  created_by
+		FROM sound_test
+		WHERE featured_on IS NULL AND NOT hidden
+		ORDER BY random()
+		LIMIT $1`
+
+	rows, err := m.DB.Query(context.Background(), stmt, n)
+	if err != nil {
+		return soundtests, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var st SoundTest
+
+		err := rows.Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.KeyboardID, &st.PlateMaterialID, &st.KeycapMaterialID, &st.KeyswitchID, &st.CreatedBy)
+		if err != nil {
+			return soundtests, err
+		}
+
+		soundtests = append(soundtests, st)
+	}
+
+	return soundtests, rows.Err()
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+type PublicProfile struct {
+	ID              uuid.UUID
+	Username        string
+	Name            string
+	Bio             string
+	Avatar          string
+	Joined          time.Time
+	ShowPlayHistory bool
+}
+
+// GetPublicProfile looks a user up by username. Suspended users don't have a
+// public profile.
+func (m *UserModel) GetPublicProfile(username string) (PublicProfile, error) {
+	var p PublicProfile
+
+	stmt := `SELECT
+			user_profile_id,
+			username,
+			COALESCE(name, ''),
+			bio,
+			COALESCE(avatar, ''),
+			created,
+			show_play_history
+		FROM user_profile
+		WHERE username = $1 AND suspended IS NULL`
+
+	err := m.DB.QueryRow(context.Background(), stmt, username).Scan(&p.ID, &p.Username, &p.Name, &p.Bio, &p.Avatar, &p.Joined, &p.ShowPlayHistory)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return p, ErrNoRecord
+		}
+		return p, err
+	}
+
+	return p, nil
+}
+
+// SetAvatar stores the object key of a user's new avatar and returns the key
+// of the one it replaced, if any, so it can be removed from storage.
+func (m *UserModel) SetAvatar(userID, objKey string) (string, error) {
+	var previous string
+
+	stmt := `UPDATE user_profile up
+		SET avatar = NULLIF($2, ''), last_updated = now()
+		FROM (SELECT avatar FROM user_profile WHERE user_profile_id = $1 FOR UPDATE) prev
+		WHERE up.user_profile_id = $1
+		RETURNING COALESCE(prev.avatar, '')`
+
+	err := m.DB.QueryRow(context.Background(), stmt, userID, objKey).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+
+	return previous, nil
+}
+
+// PlayDay is one sound of the day and how a user did on it.
+type PlayDay struct {
+	Day         time.Time
+	SoundTestID uuid.UUID
+	Played      bool
+	Correct     int
+}
+
+// PartsPerPlay is how many parts a daily play guesses, a play with every one
+// correct is perfect.
+const PartsPerPlay = 4
+
+// recentPlayDays is how many days of history a profile shows.
+const recentPlayDays = 14
+
+type PlayRecord struct {
+	Played        int
+	Perfect       int
+	CurrentStreak int
+	LongestStreak int
+	Recent        []PlayDay
+}
+
+// newPlayRecord summarizes days, newest first. A streak counts consecutive
+// sounds of the day played. Today's sound, on the date it is at now, doesn't
+// break the current streak until the day is over.
+func newPlayRecord(days []PlayDay, now time.Time) PlayRecord {
+	var record PlayRecord
+
+	today := CalendarDate(now)
+	run := 0
+	current := true
+
+	for i, d := range days {
+		if d.Played {
+			record.Played++
+			if d.Correct == PartsPerPlay {
+				record.Perfect++
+			}
+
+			run++
+			if run > record.LongestStreak {
+				record.LongestStreak = run
+			}
+			if current {
+				record.CurrentStreak = run
+			}
+			continue
+		}
+
+		if i == 0 && d.Day.Equal(today) {
+			continue
+		}
+
+		run = 0
+		current = false
+	}
+
+	if len(days) > recentPlayDays {
+		days = days[:recentPlayDays]
+	}
+	record.Recent = days
+
+	return record
+}
+
+// GetPlayRecord summarizes userID's plays of the sounds of the day up to the
+// date it is at now, see GetDaily.
+func (m *SoundTestModel) GetPlayRecord(userID string, now time.Time) (PlayRecord, error) {
+	var days []PlayDay
+
+	stmt := `SELECT
+			st.daily_date,
+			st.sound_test_id,
+			stp.sound_test_id IS NOT NULL,
+			COALESCE(` + playCorrectParts + `, 0)
+		FROM sound_test st
+		LEFT JOIN sound_test_play stp ON stp.sound_test_id = st.sound_test_id AND stp.created_by = $1
+		WHERE
+			st.daily_date >= (SELECT created::date FROM user_profile WHERE user_profile_id = $1)
+			AND st.daily_date <= $2
+		ORDER BY st.daily_date DESC`
+
+	rows, err := m.DB.Query(context.Background(), stmt, userID, CalendarDate(now))
+	if err != nil {
+		return PlayRecord{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d PlayDay
+
+		err := rows.Scan(&d.Day, &d.SoundTestID, &d.Played, &d.Correct)
+		if err != nil {
+			return PlayRecord{}, err
+		}
+
+		days = append(days, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return PlayRecord{}, err
+	}
+
+	return newPlayRecord(days, now), nil
+}
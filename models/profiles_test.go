@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewPlayRecord(t *testing.T) {
+	now := time.Date(2023, 3, 10, 15, 0, 0, 0, time.UTC)
+	day := func(daysAgo int) time.Time {
+		return time.Date(2023, 3, 10-daysAgo, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := map[string]struct {
+		days []PlayDay
+		want PlayRecord
+	}{
+		"no days": {
+			want: PlayRecord{},
+		},
+		"played every day": {
+			days: []PlayDay{
+				{Day: day(0), Played: true, Correct: 4},
+				{Day: day(1), Played: true, Correct: 2},
+				{Day: day(2), Played: true, Correct: 4},
+			},
+			want: PlayRecord{Played: 3, Perfect: 2, CurrentStreak: 3, LongestStreak: 3},
+		},
+		"today not played yet": {
+			days: []PlayDay{
+				{Day: day(0)},
+				{Day: day(1), Played: true, Correct: 1},
+				{Day: day(2), Played: true, Correct: 1},
+			},
+			want: PlayRecord{Played: 2, CurrentStreak: 2, LongestStreak: 2},
+		},
+		"missed yesterday": {
+			days: []PlayDay{
+				{Day: day(1)},
+				{Day: day(2), Played: true, Correct: 4},
+			},
+			want: PlayRecord{Played: 1, Perfect: 1, CurrentStreak: 0, LongestStreak: 1},
+		},
+		"older streak is longest": {
+			days: []PlayDay{
+				{Day: day(0), Played: true, Correct: 3},
+				{Day: day(1)},
+				{Day: day(2), Played: true, Correct: 3},
+				{Day: day(3), Played: true, Correct: 3},
+				{Day: day(4), Played: true, Correct: 3},
+				{Day: day(5)},
+			},
+			want: PlayRecord{Played: 4, CurrentStreak: 1, LongestStreak: 3},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := newPlayRecord(tc.days, now)
+
+			if got.Played != tc.want.Played || got.Perfect != tc.want.Perfect {
+				t.Errorf("wrong totals, got: %d played %d perfect, want: %d played %d perfect", got.Played, got.Perfect, tc.want.Played, tc.want.Perfect)
+			}
+			if got.CurrentStreak != tc.want.CurrentStreak || got.LongestStreak != tc.want.LongestStreak {
+				t.Errorf("wrong streaks, got: %d current %d longest, want: %d current %d longest", got.CurrentStreak, got.LongestStreak, tc.want.CurrentStreak, tc.want.LongestStreak)
+			}
+			if len(got.Recent) != len(tc.days) {
+				t.Errorf("wrong recent days, got: %d, want: %d", len(got.Recent), len(tc.days))
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"math"
+	"sort"
+
+	"github.com/gofrs/uuid"
+)
+
+// What two soundtests can be compared on. Thock is a single scale, the
+// thockier sound wins and the clackier one loses.
+const (
+	CriterionBetter = "better"
+	CriterionThock  = "thock"
+)
+
+var Criteria = []string{CriterionBetter, CriterionThock}
+
+// Parts that are rated through the soundtests they're in, as well as
+// SubjectSoundTest.
+const (
+	SubjectKeyswitch = "keyswitch"
+	SubjectKeyboard  = "keyboard"
+)
+
+var RatingSubjects = []string{SubjectKeyswitch, SubjectKeyboard, SubjectSoundTest}
+
+const (
+	// A subject that wins as often as it loses is rated ratingBase, and one
+	// rated ratingScale points higher than another is expected to win ten
+	// times as often, the same scale as Elo.
+	ratingBase  = 1500
+	ratingScale = 400
+
+	// ratingPrior is the weight of the one win and one loss every subject is
+	// given against an opponent rated ratingBase, so a subject that has only
+	// won or only lost still gets a finite rating.
+	ratingPrior = 1
+
+	ratingIterations = 1000
+	ratingTolerance  = 1e-9
+)
+
+// Matchup is one comparison between two subjects, Weight is how much it
+// counts.
+type Matchup struct {
+	Winner uuid.UUID
+	Loser  uuid.UUID
+	Weight float64
+}
+
+// BradleyTerry fits a Bradley-Terry model to matchups and returns each
+// subject's rating on the Elo scale. Unlike Elo the ratings don't depend on
+// the order of the matchups.
+func BradleyTerry(matchups []Matchup) map[uuid.UUID]float64 {
+	wins := map[uuid.UUID]float64{}
+	games := map[uuid.UUID]map[uuid.UUID]float64{}
+
+	play := func(a, b uuid.UUID, weight float64) {
+		if games[a] == nil {
+			games[a] = map[uuid.UUID]float64{}
+		}
+		games[a][b] += weight
+	}
+
+	for _, m := range matchups {
+		wins[m.Winner] += m.Weight
+		play(m.Winner, m.Loser, m.Weight)
+		play(m.Loser, m.Winner, m.Weight)
+	}
+
+	strength := make(map[uuid.UUID]float64, len(games))
+	for id := range games {
+		strength[id] = 1
+	}
+
+	// Hunter's MM algorithm, each strength is its wins over the games it
+	// played weighted by how likely it was to win them.
+	for i := 0; i < ratingIterations; i++ {
+		next := make(map[uuid.UUID]float64, len(strength))
+		change := 0.0
+
+		for id, opponents := range games {
+			played := 2 * ratingPrior / (strength[id] + 1)
+			for opponent, n := range opponents {
+				played += n / (strength[id] + strength[opponent])
+			}
+
+			next[id] = (wins[id] + ratingPrior) / played
+			change = math.Max(change, math.Abs(next[id]-strength[id])/strength[id])
+		}
+
+		strength = next
+		if change < ratingTolerance {
+			break
+		}
+	}
+
+	ratings := make(map[uuid.UUID]float64, len(strength))
+	for id, s := range strength {
+		ratings[id] = ratingBase + ratingScale*math.Log10(s)
+	}
+
+	return ratings
+}
+
+// RatedSubject is a soundtest, switch or keyboard with its rating. Name is
+// the build for soundtests.
+type RatedSubject struct {
+	ID          uuid.UUID
+	Name        string
+	Rating      float64
+	Comparisons int
+}
+
+type Tier struct {
+	Name     string
+	Subjects []RatedSubject
+}
+
+// tierNames name the tiers from the top for each criterion.
+var tierNames = map[string][]string{
+	CriterionBetter: {"S", "A", "B", "C", "D"},
+	CriterionThock:  {"Deep thock", "Thocky", "In between", "Clacky", "Sharp clack"},
+}
+
+// tierShares is the share of subjects in each tier from the top.
+var tierShares = []float64{0.1, 0.2, 0.4, 0.2, 0.1}
+
+// TierList sorts subjects into tiers by rating, the top tenth in the first
+// tier down to the bottom tenth in the last.
+func TierList(criterion string, subjects []RatedSubject) []Tier {
+	sorted := make([]RatedSubject, len(subjects))
+	copy(sorted, subjects)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Rating > sorted[j].Rating
+	})
+
+	tiers := make([]Tier, len(tierShares))
+	start, share := 0, 0.0
+
+	for i, name := range tierNames[criterion] {
+		share += tierShares[i]
+		end := int(math.Round(share * float64(len(sorted))))
+
+		tiers[i] = Tier{Name: name, Subjects: sorted[start:end]}
+		start = end
+	}
+
+	return tiers
+}
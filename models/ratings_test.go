@@ -0,0 +1,131 @@
+package models
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestBradleyTerry(t *testing.T) {
+	a, b, c := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+
+	t.Run("order", func(t *testing.T) {
+		ratings := BradleyTerry([]Matchup{
+			{Winner: a, Loser: b, Weight: 1},
+			{Winner: a, Loser: b, Weight: 1},
+			{Winner: b, Loser: a, Weight: 1},
+			{Winner: b, Loser: c, Weight: 1},
+			{Winner: b, Loser: c, Weight: 1},
+			{Winner: a, Loser: c, Weight: 1},
+		})
+
+		if !(ratings[a] > ratings[b] && ratings[b] > ratings[c]) {
+			t.Errorf("want a > b > c, got: %v, %v, %v", ratings[a], ratings[b], ratings[c])
+		}
+	})
+
+	t.Run("even", func(t *testing.T) {
+		ratings := BradleyTerry([]Matchup{
+			{Winner: a, Loser: b, Weight: 1},
+			{Winner: b, Loser: a, Weight: 1},
+		})
+
+		for id, rating := range ratings {
+			if math.Abs(rating-ratingBase) > 1e-6 {
+				t.Errorf("%v want: %v, got: %v", id, ratingBase, rating)
+			}
+		}
+	})
+
+	t.Run("symmetric", func(t *testing.T) {
+		ratings := BradleyTerry([]Matchup{{Winner: a, Loser: b, Weight: 1}})
+
+		if math.IsInf(ratings[a], 0) || math.IsInf(ratings[b], 0) {
+			t.Fatalf("want finite ratings, got: %v, %v", ratings[a], ratings[b])
+		}
+		if math.Abs(ratings[a]-ratingBase-(ratingBase-ratings[b])) > 1e-6 {
+			t.Errorf("want ratings either side of %v, got: %v, %v", ratingBase, ratings[a], ratings[b])
+		}
+	})
+
+	t.Run("weight", func(t *testing.T) {
+		light := BradleyTerry([]Matchup{{Winner: a, Loser: b, Weight: 0.5}})
+		heavy := BradleyTerry([]Matchup{{Winner: a, Loser: b, Weight: 2}})
+
+		if !(heavy[a] > light[a]) {
+			t.Errorf("want heavier win rated higher, got: %v, %v", heavy[a], light[a])
+		}
+	})
+}
+
+func TestTierList(t *testing.T) {
+	var subjects []RatedSubject
+	for i := 0; i < 10; i++ {
+		subjects = append(subjects, RatedSubject{ID: uuid.Must(uuid.NewV4()), Rating: float64(i)})
+	}
+
+	tiers := TierList(CriterionThock, subjects)
+
+	want := []int{1, 2, 4, 2, 1}
+	if len(tiers) != len(want) {
+		t.Fatalf("want: %d tiers, got: %d", len(want), len(tiers))
+	}
+
+	for i, tier := range tiers {
+		if tier.Name != tierNames[CriterionThock][i] {
+			t.Errorf("tier %d want: %q, got: %q", i, tierNames[CriterionThock][i], tier.Name)
+		}
+		if len(tier.Subjects) != want[i] {
+			t.Errorf("tier %q want: %d subjects, got: %d", tier.Name, want[i], len(tier.Subjects))
+		}
+	}
+
+	if tiers[0].Subjects[0].Rating != 9 || tiers[4].Subjects[0].Rating != 0 {
+		t.Errorf("want best first, got: %v", tiers)
+	}
+
+	if subjects[0].Rating != 0 {
+		t.Errorf("want subjects left unsorted")
+	}
+}
+
+func TestGroupMatchups(t *testing.T) {
+	sw1, sw2, kb := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	st1, st2 := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+
+	groups := groupMatchups([]comparedPair{{
+		criterion:       CriterionBetter,
+		winner:          st1,
+		loser:           st2,
+		winnerKeyswitch: sw1,
+		loserKeyswitch:  sw2,
+		winnerKeyboard:  kb,
+		loserKeyboard:   kb,
+		weight:          1,
+	}})
+
+	tests := map[string]struct {
+		key  ratingKey
+		want []Matchup
+	}{
+		"soundtest":       {key: ratingKey{SubjectSoundTest, CriterionBetter}, want: []Matchup{{Winner: st1, Loser: st2, Weight: 1}}},
+		"keyswitch":       {key: ratingKey{SubjectKeyswitch, CriterionBetter}, want: []Matchup{{Winner: sw1, Loser: sw2, Weight: 1}}},
+		"same keyboard":   {key: ratingKey{SubjectKeyboard, CriterionBetter}, want: nil},
+		"other criterion": {key: ratingKey{SubjectSoundTest, CriterionThock}, want: nil},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := groups[tc.key]
+			if len(got) != len(tc.want) {
+				t.Fatalf("want: %v, got: %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("want: %v, got: %v", tc.want[i], got[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles are ordered from least to most privileged.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// Permissions are granted to roles in the role_permission table.
+const (
+	PermModerateReports = "reports:moderate"
+	PermReviewVotes     = "votes:review"
+	PermViewModeration  = "moderation-log:view"
+	PermViewHidden      = "soundtests:view-hidden"
+	PermAssignRoles     = "roles:assign"
+	PermManageWebhooks  = "webhooks:manage"
+)
+
+// Access is what a signed in user is allowed to do. The zero value is an
+// anonymous visitor with no permissions.
+type Access struct {
+	Role        string
+	Permissions []string
+}
+
+func (a Access) Can(permission string) bool {
+	for _, p := range a.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AtLeast reports whether the user's role is role or a more privileged one.
+func (a Access) AtLeast(role string) bool {
+	return roleRank(a.Role) >= roleRank(role) && roleRank(role) >= 0
+}
+
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+type StaffMember struct {
+	ID       uuid.UUID
+	Email    string
+	Username string
+	Role     string
+	Created  time.Time
+}
+
+// GetStaff lists users with a role above user, most privileged first.
+func (m *UserModel) GetStaff() ([]StaffMember, error) {
+	stmt := `SELECT up.user_profile_id, up.email, COALESCE(up.username, ''), up.role_id, up.created
+		FROM user_profile up
+		JOIN role r USING (role_id)
+		WHERE up.role_id <> 'user'
+		ORDER BY r.rank DESC, up.created`
+
+	return m.queryStaff(stmt)
+}
+
+// FindByHandle looks users up by exact email or username for role assignment.
+func (m *UserModel) FindByHandle(handle string) ([]StaffMember, error) {
+	stmt := `SELECT user_profile_id, email, COALESCE(username, ''), role_id, created
+		FROM user_profile
+		WHERE lower(email) = lower($1) OR lower(username) = lower($1)
+		ORDER BY created`
+
+	return m.queryStaff(stmt, handle)
+}
+
+func (m *UserModel) queryStaff(stmt string, args ...any) ([]StaffMember, error) {
+	var staff []StaffMember
+
+	rows, err := m.DB.Query(context.Background(), stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s StaffMember
+
+		err := rows.Scan(&s.ID, &s.Email, &s.Username, &s.Role, &s.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		staff = append(staff, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return staff, nil
+}
+
+// SetRole changes a user's role and records the change in the moderation log.
+// byID is the admin making the change, or empty when run from the command
+// line.
+func (m *UserModel) SetRole(userID, role, byID string) error {
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var subjectID uuid.UUID
+
+	stmt := `UPDATE user_profile
+		SET role_id = $2, last_updated = now()
+		WHERE user_profile_id = $1
+		RETURNING user_profile_id`
+
+	err = tx.QueryRow(context.Background(), stmt, userID, role).Scan(&subjectID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	stmt = `INSERT INTO moderation_log (action, subject_type, subject_id, created_by)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid)`
+
+	_, err = tx.Exec(context.Background(), stmt, "role:"+role, SubjectUser, subjectID, byID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func ValidRole(role string) bool {
+	return roleRank(role) >= 0
+}
+
+func (m *UserModel) GetIDByEmail(email string) (uuid.UUID, error) {
+	var id uuid.UUID
+
+	err := m.DB.QueryRow(context.Background(), "SELECT user_profile_id FROM user_profile WHERE lower(email) = lower($1)", email).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return id, ErrNoRecord
+		}
+		return id, err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import "testing"
+
+func TestAccessAtLeast(t *testing.T) {
+	tests := map[string]struct {
+		access Access
+		role   string
+		want   bool
+	}{
+		"same role": {
+			access: Access{Role: RoleModerator},
+			role:   RoleModerator,
+			want:   true,
+		},
+		"higher role": {
+			access: Access{Role: RoleAdmin},
+			role:   RoleUser,
+			want:   true,
+		},
+		"lower role": {
+			access: Access{Role: RoleUser},
+			role:   RoleModerator,
+			want:   false,
+		},
+		"anonymous": {
+			access: Access{},
+			role:   RoleUser,
+			want:   false,
+		},
+		"unknown role": {
+			access: Access{Role: RoleAdmin},
+			role:   "owner",
+			want:   false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.access.AtLeast(tc.role); got != tc.want {
+				t.Errorf("got: %t, want: %t", got, tc.want)
+			}
+		})
+	}
+}
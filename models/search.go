@@ -0,0 +1,140 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	SortNewest        = "newest"
+	SortHot           = "hot"
+	SortTop           = "top"
+	SortRising        = "rising"
+	SortControversial = "controversial"
+
+	// FeedFollowing is the vote feed limited to uploaders the user follows,
+	// newest first.
+	FeedFollowing = "following"
+)
+
+// Rankings are the orders the vote feed can be sorted by.
+var Rankings = []string{SortHot, SortNewest, SortTop, SortRising, FeedFollowing}
+
+// sortKey returns the sort_key expression for a listing joined to
+// sound_test_score as s and sound_test_rank as r. Ranked listings sort by the
+// snapshot in sound_test_rank so cursors keep their place between pages,
+// soundtests uploaded since it was last refreshed by their live score.
+func sortKey(sort string) string {
+	switch sort {
+	case SortHot:
+		return "COALESCE(r.hot, s.hot)"
+	case SortTop:
+		return "COALESCE(r.top, s.top)"
+	case SortRising:
+		return "COALESCE(r.rising, s.rising)"
+	case SortControversial:
+		return "COALESCE(r.controversial, (s.upvotes + s.downvotes)::float8 / GREATEST(abs(s.upvotes - s.downvotes), 1))"
+	default:
+		return unranked
+	}
+}
+
+// unranked is the sort_key of listings only ordered by upload date.
+const unranked = "0::float8"
+
+// ranked reports whether sort orders by a score before upload date.
+func ranked(sort string) bool {
+	return sortKey(sort) != unranked
+}
+
+type SoundTestFilter struct {
+	Keyboard       string
+	Keyswitch      string
+	KeyswitchType  string
+	PlateMaterial  string
+	KeycapMaterial string
+	Uploader       string
+	Query          string
+	Sort           string
+}
+
+// where builds the WHERE clause for f, numbering placeholders after the
+// arguments already in args. Soundtests hidden by moderators never match.
+func (f SoundTestFilter) where(args []any) (string, []any) {
+	conds := []string{"NOT st.hidden"}
+
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Keyboard != "" {
+		add("st.keyboard_id = $%d", f.Keyboard)
+	}
+	if f.Keyswitch != "" {
+		add("st.keyswitch_id = $%d", f.Keyswitch)
+	}
+	if f.KeyswitchType != "" {
+		add("ks.keyswitch_type_id = $%d", f.KeyswitchType)
+	}
+	if f.PlateMaterial != "" {
+		add("st.plate_material_id = $%d", f.PlateMaterial)
+	}
+	if f.KeycapMaterial != "" {
+		add("st.keycap_material_id = $%d", f.KeycapMaterial)
+	}
+	if f.Uploader != "" {
+		add("lower(up.username) = lower($%d)", f.Uploader)
+	}
+
+	for _, term := range strings.Fields(f.Query) {
+		add("(k.name ILIKE $%[1]d OR ks.name ILIKE $%[1]d OR kt.name ILIKE $%[1]d OR pm.name ILIKE $%[1]d OR km.name ILIKE $%[1]d)", "%"+escapeLike(term)+"%")
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (m *SoundTestModel) Search(filter SoundTestFilter, page PageRequest, userID string) ([]SoundTestVote, PageInfo, error) {
+	where, args := filter.where([]any{userID})
+	cond, orderBy, limit, args := page.keyset(ranked(filter.Sort), args)
+
+	stmt := `SELECT *
+		FROM (
+		  SELECT
+		    st.sound_test_id,
+		    st.url,
+		    st.uploaded,
+		    st.last_updated,
+		    COALESCE(up.username, 'anonymous'),
+		    COALESCE(
+		      (SELECT vote_type
+		      FROM vote
+		      WHERE
+		        vote.sound_test_id = st.sound_test_id
+		        AND vote.created_by = NULLIF($1, '')::uuid
+		      ), 0) as user_vote,
+		    s.upvotes,
+		    s.downvotes,
+		    s.upvotes - s.downvotes as total_votes,
+		    ` + sortKey(filter.Sort) + ` as sort_key
+		  FROM sound_test st
+		  JOIN user_profile up ON up.user_profile_id = st.created_by
+		  JOIN keyboard k ON k.keyboard_id = st.keyboard_id
+		  JOIN keyswitch ks ON ks.keyswitch_id = st.keyswitch_id
+		  JOIN keyswitch_type kt ON kt.keyswitch_type_id = ks.keyswitch_type_id
+		  JOIN plate_material pm ON pm.plate_material_id = st.plate_material_id
+		  JOIN keycap_material km ON km.keycap_material_id = st.keycap_material_id
+		  JOIN sound_test_score s ON s.sound_test_id = st.sound_test_id
+		  LEFT JOIN sound_test_rank r ON r.sound_test_id = st.sound_test_id
+		  ` + where + `
+		) results
+		WHERE ` + cond + `
+		` + orderBy + `
+		` + limit
+
+	return m.queryFeed(page, stmt, args...)
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSoundTestFilterWhere(t *testing.T) {
+	tests := map[string]struct {
+		filter    SoundTestFilter
+		wantWhere string
+		wantArgs  []any
+	}{
+		"no filters": {
+			filter:    SoundTestFilter{},
+			wantWhere: "WHERE NOT st.hidden",
+			wantArgs:  []any{0, 10},
+		},
+		"part filters": {
+			filter:    SoundTestFilter{Keyboard: "kb", KeyswitchType: "linear"},
+			wantWhere: "WHERE NOT st.hidden AND st.keyboard_id = $3 AND ks.keyswitch_type_id = $4",
+			wantArgs:  []any{0, 10, "kb", "linear"},
+		},
+		"uploader": {
+			filter:    SoundTestFilter{Uploader: "hunter"},
+			wantWhere: "WHERE NOT st.hidden AND lower(up.username) = lower($3)",
+			wantArgs:  []any{0, 10, "hunter"},
+		},
+		"search terms": {
+			filter:    SoundTestFilter{Query: " ink  50%_off "},
+			wantWhere: "WHERE NOT st.hidden AND (k.name ILIKE $3 OR ks.name ILIKE $3 OR kt.name ILIKE $3 OR pm.name ILIKE $3 OR km.name ILIKE $3) AND (k.name ILIKE $4 OR ks.name ILIKE $4 OR kt.name ILIKE $4 OR pm.name ILIKE $4 OR km.name ILIKE $4)",
+			wantArgs:  []any{0, 10, "%ink%", `%50\%\_off%`},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			where, args := tc.filter.where([]any{0, 10})
+			if where != tc.wantWhere {
+				t.Errorf("want where: %q, got: %q", tc.wantWhere, where)
+			}
+			if !reflect.DeepEqual(args, tc.wantArgs) {
+				t.Errorf("want args: %v, got: %v", tc.wantArgs, args)
+			}
+		})
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	tests := map[string]struct {
+		sort string
+		want string
+	}{
+		"newest":    {sort: SortNewest, want: "0::float8"},
+		"default":   {sort: "", want: "0::float8"},
+		"unknown":   {sort: "best", want: "0::float8"},
+		"hot":       {sort: SortHot, want: "COALESCE(r.hot, s.hot)"},
+		"top":       {sort: SortTop, want: "COALESCE(r.top, s.top)"},
+		"rising":    {sort: SortRising, want: "COALESCE(r.rising, s.rising)"},
+		"following": {sort: FeedFollowing, want: "0::float8"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := sortKey(tc.sort)
+			if tc.want != got {
+				t.Errorf("want: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -2,9 +2,11 @@ package models
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -18,25 +20,124 @@ type SoundTest struct {
 	KeycapMaterialID uuid.UUID
 	KeyswitchID      uuid.UUID
 	CreatedBy        uuid.UUID
-	FeaturedOn       time.Time
+	FeaturedOn       *time.Time
+	DailyDate        *time.Time
 }
 
 type SoundTestModel struct {
 	DB *pgxpool.Pool
 }
 
-func (m *SoundTestModel) Insert(fileURL, keyboard, plateMaterial, keycapMaterial, keyswitch, userID string) error {
+func (m *SoundTestModel) Insert(fileURL, keyboard, plateMaterial, keycapMaterial, keyswitch, userID string, attributes map[string]string) (uuid.UUID, error) {
+	var soundtestID uuid.UUID
+
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return soundtestID, err
+	}
+	defer tx.Rollback(context.Background())
+
 	stmt := `INSERT INTO sound_test (url, uploaded, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id, created_by)
-		VALUES ($1, now(), $2, $3, $4, $5, $6)`
+		VALUES ($1, now(), $2, $3, $4, $5, $6)
+		RETURNING sound_test_id`
 
-	_, err := m.DB.Exec(context.Background(), stmt, fileURL, keyboard, plateMaterial, keycapMaterial, keyswitch, userID)
+	err = tx.QueryRow(context.Background(), stmt, fileURL, keyboard, plateMaterial, keycapMaterial, keyswitch, userID).Scan(&soundtestID)
 	if err != nil {
-		return err
+		return soundtestID, err
+	}
+
+	err = insertAttributes(tx, soundtestID.String(), attributes)
+	if err != nil {
+		return soundtestID, err
+	}
+
+	return soundtestID, tx.Commit(context.Background())
+}
+
+func insertAttributes(tx pgx.Tx, soundtestID string, attributes map[string]string) error {
+	stmt := `INSERT INTO sound_test_attribute (sound_test_id, build_attribute_id, build_attribute_option_id)
+		VALUES ($1, $2, $3)`
+
+	for attributeID, optionID := range attributes {
+		_, err := tx.Exec(context.Background(), stmt, soundtestID, attributeID, optionID)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+type SoundTestAttribute struct {
+	Attribute string
+	Option    string
+}
+
+func (m *SoundTestModel) GetAttributes(soundtestID string) ([]SoundTestAttribute, error) {
+	var attributes []SoundTestAttribute
+
+	stmt := `SELECT ba.name, bao.name
+		FROM sound_test_attribute sta
+		JOIN build_attribute ba USING (build_attribute_id)
+		JOIN build_attribute_option bao USING (build_attribute_option_id)
+		WHERE sta.sound_test_id = $1
+		ORDER BY ba.sort_order, ba.name`
+
+	rows, err := m.DB.Query(context.Background(), stmt, soundtestID)
+	if err != nil {
+		return attributes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a SoundTestAttribute
+
+		err := rows.Scan(&a.Attribute, &a.Option)
+		if err != nil {
+			return attributes, err
+		}
+
+		attributes = append(attributes, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return attributes, err
+	}
+
+	return attributes, nil
+}
+
+func (m *SoundTestModel) GetAttributeIDs(soundtestID string) (map[string]string, error) {
+	attributes := make(map[string]string)
+
+	stmt := `SELECT build_attribute_id, build_attribute_option_id
+		FROM sound_test_attribute
+		WHERE sound_test_id = $1`
+
+	rows, err := m.DB.Query(context.Background(), stmt, soundtestID)
+	if err != nil {
+		return attributes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attributeID, optionID uuid.UUID
+
+		err := rows.Scan(&attributeID, &optionID)
+		if err != nil {
+			return attributes, err
+		}
+
+		attributes[attributeID.String()] = optionID.String()
+	}
+
+	if err = rows.Err(); err != nil {
+		return attributes, err
+	}
+
+	return attributes, nil
+}
+
 type SoundTestVote struct {
 	ID          uuid.UUID
 	URL         string
@@ -44,46 +145,240 @@ type SoundTestVote struct {
 	LastUpdated time.Time
 	CreatedBy   string
 	UserVote    int
+	Upvotes     int
+	Downvotes   int
 	TotalVotes  int
-	TotalTests  int
+	SortKey     float64
+}
+
+func (st SoundTestVote) Cursor() Cursor {
+	return Cursor{SortKey: st.SortKey, Uploaded: st.Uploaded, ID: st.ID}
 }
 
-func (m *SoundTestModel) GetLatest(page int, perPage int, userID string) ([]SoundTestVote, error) {
+// GetFeed lists every soundtest ordered by ranking, one of Rankings. The
+// following ranking only lists soundtests from uploaders userID follows.
+func (m *SoundTestModel) GetFeed(ranking string, page PageRequest, userID string) ([]SoundTestVote, PageInfo, error) {
+	cond, orderBy, limit, args := page.keyset(ranked(ranking), []any{userID})
+
+	var following string
+	if ranking == FeedFollowing {
+		following = "AND st.created_by IN (SELECT followee_id FROM follow WHERE follower_id = $1)"
+	}
+
+	stmt := `SELECT *
+		FROM (
+		  SELECT
+		    st.sound_test_id,
+		    st.url,
+		    st.uploaded,
+		    st.last_updated,
+		    COALESCE(up.username, 'anonymous'),
+		    COALESCE(
+		      (SELECT vote_type
+		      FROM vote
+		      WHERE
+		        vote.sound_test_id = st.sound_test_id
+		        AND vote.created_by = $1
+		      ), 0) as user_vote,
+		    s.upvotes,
+		    s.downvotes,
+		    s.upvotes - s.downvotes as total_votes,
+		    ` + sortKey(ranking) + ` as sort_key
+		  FROM sound_test st
+		  JOIN user_profile up ON up.user_profile_id = st.created_by
+		  JOIN sound_test_score s ON s.sound_test_id = st.sound_test_id
+		  LEFT JOIN sound_test_rank r ON r.sound_test_id = st.sound_test_id
+		  WHERE NOT st.hidden ` + following + `
+		) feed
+		WHERE ` + cond + `
+		` + orderBy + `
+		` + limit
+
+	return m.queryFeed(page, stmt, args...)
+}
+
+func (m *SoundTestModel) GetVote(soundtestID, userID string) (SoundTestVote, error) {
+	var st SoundTestVote
+
+	stmt := `SELECT
+		  st.sound_test_id,
+		  st.url,
+		  st.uploaded,
+		  st.last_updated,
+		  COALESCE(up.username, 'anonymous'),
+		  COALESCE(
+		    (SELECT vote_type
+		    FROM vote
+		    WHERE
+		      vote.sound_test_id = st.sound_test_id
+		      AND vote.created_by = $2
+		    ), 0) as user_vote,
+		  COALESCE(t.upvotes, 0),
+		  COALESCE(t.downvotes, 0),
+		  COALESCE(t.upvotes - t.downvotes, 0) as total_votes
+		FROM sound_test st
+		JOIN user_profile up ON up.user_profile_id = st.created_by
+		LEFT JOIN sound_test_tally t ON t.sound_test_id = st.sound_test_id
+		WHERE st.sound_test_id = $1`
+
+	err := m.DB.QueryRow(context.Background(), stmt, soundtestID, userID).Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.CreatedBy, &st.UserVote, &st.Upvotes, &st.Downvotes, &st.TotalVotes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return st, ErrNoRecord
+		}
+		return st, err
+	}
+
+	return st, nil
+}
+
+func (m *SoundTestModel) queryFeed(page PageRequest, stmt string, args ...any) ([]SoundTestVote, PageInfo, error) {
 	var soundtests []SoundTestVote
 
+	rows, err := m.DB.Query(context.Background(), stmt, args...)
+	if err != nil {
+		return soundtests, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var st SoundTestVote
+
+		err := rows.Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.CreatedBy, &st.UserVote, &st.Upvotes, &st.Downvotes, &st.TotalVotes, &st.SortKey)
+		if err != nil {
+			return soundtests, PageInfo{}, err
+		}
+
+		soundtests = append(soundtests, st)
+	}
+
+	if err = rows.Err(); err != nil {
+		return soundtests, PageInfo{}, err
+	}
+
+	soundtests, info := trimPage(soundtests, page, SoundTestVote.Cursor)
+
+	return soundtests, info, nil
+}
+
+type SoundTestDetail struct {
+	ID             uuid.UUID
+	URL            string
+	Uploaded       time.Time
+	LastUpdated    time.Time
+	CreatedByID    uuid.UUID
+	CreatedBy      string
+	FeaturedOn     *time.Time
+	DailyDate      *time.Time
+	Hidden         bool
+	Keyboard       string
+	Keyswitch      string
+	KeyswitchType  string
+	PlateMaterial  string
+	KeycapMaterial string
+	UserVote       int
+	Upvotes        int
+	Downvotes      int
+	TotalVotes     int
+}
+
+func (m *SoundTestModel) Get(soundtestID, userID string) (SoundTestDetail, error) {
+	var st SoundTestDetail
+
 	stmt := `SELECT
 		  st.sound_test_id,
 		  st.url,
 		  st.uploaded,
 		  st.last_updated,
+		  st.created_by,
 		  COALESCE(up.username, 'anonymous'),
+		  st.featured_on,
+		  st.daily_date,
+		  st.hidden,
+		  k.name,
+		  ks.name,
+		  kt.name,
+		  pm.name,
+		  km.name,
 		  COALESCE(
 		    (SELECT vote_type
 		    FROM vote
 		    WHERE
 		      vote.sound_test_id = st.sound_test_id
-		      AND vote.created_by = $3
+		      AND vote.created_by = NULLIF($2, '')::uuid
 		    ), 0) as user_vote,
-		  (SELECT COALESCE(SUM(vote_type), 0)
-		  FROM vote
-		  WHERE vote.sound_test_id = st.sound_test_id) as total_votes,
-		  count(*) over() as total_tests
+		  COALESCE(t.upvotes, 0),
+		  COALESCE(t.downvotes, 0),
+		  COALESCE(t.upvotes - t.downvotes, 0) as total_votes
 		FROM sound_test st
 		JOIN user_profile up ON up.user_profile_id = st.created_by
-		ORDER BY st.uploaded DESC
-		OFFSET $1 * 10
-		FETCH NEXT $2 ROWS ONLY`
+		JOIN keyboard k ON k.keyboard_id = st.keyboard_id
+		JOIN keyswitch ks ON ks.keyswitch_id = st.keyswitch_id
+		JOIN keyswitch_type kt ON kt.keyswitch_type_id = ks.keyswitch_type_id
+		JOIN plate_material pm ON pm.plate_material_id = st.plate_material_id
+		JOIN keycap_material km ON km.keycap_material_id = st.keycap_material_id
+		LEFT JOIN sound_test_tally t ON t.sound_test_id = st.sound_test_id
+		WHERE st.sound_test_id = $1`
 
-	rows, err := m.DB.Query(context.Background(), stmt, page, perPage, userID)
+	err := m.DB.QueryRow(context.Background(), stmt, soundtestID, userID).Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.CreatedByID, &st.CreatedBy, &st.FeaturedOn, &st.DailyDate, &st.Hidden, &st.Keyboard, &st.Keyswitch, &st.KeyswitchType, &st.PlateMaterial, &st.KeycapMaterial, &st.UserVote, &st.Upvotes, &st.Downvotes, &st.TotalVotes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return st, ErrNoRecord
+		}
+		return st, err
+	}
+
+	return st, nil
+}
+
+type UserSoundTest struct {
+	ID          uuid.UUID
+	URL         string
+	Uploaded    time.Time
+	LastUpdated time.Time
+	FeaturedOn  *time.Time
+	DailyDate   *time.Time
+	Hidden      bool
+	Keyboard    string
+	Keyswitch   string
+	Upvotes     int
+	Downvotes   int
+	TotalVotes  int
+}
+
+func (m *SoundTestModel) GetByUser(userID string) ([]UserSoundTest, error) {
+	var soundtests []UserSoundTest
+
+	stmt := `SELECT
+		  st.sound_test_id,
+		  st.url,
+		  st.uploaded,
+		  st.last_updated,
+		  st.featured_on,
+		  st.daily_date,
+		  st.hidden,
+		  k.name,
+		  ks.name,
+		  COALESCE(t.upvotes, 0),
+		  COALESCE(t.downvotes, 0),
+		  COALESCE(t.upvotes - t.downvotes, 0) as total_votes
+		FROM sound_test st
+		JOIN keyboard k ON k.keyboard_id = st.keyboard_id
+		JOIN keyswitch ks ON ks.keyswitch_id = st.keyswitch_id
+		LEFT JOIN sound_test_tally t ON t.sound_test_id = st.sound_test_id
+		WHERE st.created_by = $1
+		ORDER BY st.uploaded DESC`
+
+	rows, err := m.DB.Query(context.Background(), stmt, userID)
 	if err != nil {
 		return soundtests, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var st SoundTestVote
+		var st UserSoundTest
 
-		err := rows.Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.CreatedBy, &st.UserVote, &st.TotalVotes, &st.TotalTests)
+		err := rows.Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.FeaturedOn, &st.DailyDate, &st.Hidden, &st.Keyboard, &st.Keyswitch, &st.Upvotes, &st.Downvotes, &st.TotalVotes)
 		if err != nil {
 			return soundtests, err
 		}
@@ -91,10 +386,122 @@ func (m *SoundTestModel) GetLatest(page int, perPage int, userID string) ([]Soun
 		soundtests = append(soundtests, st)
 	}
 
+	if err = rows.Err(); err != nil {
+		return soundtests, err
+	}
+
 	return soundtests, nil
 }
 
-func (m *SoundTestModel) GetDaily() (SoundTest, error) {
+func (m *SoundTestModel) GetOwned(soundtestID, userID string) (SoundTest, error) {
+	var st SoundTest
+
+	stmt := `SELECT
+		  sound_test_id,
+		  url,
+		  uploaded,
+		  last_updated,
+		  keyboard_id,
+		  plate_material_id,
+		  keycap_material_id,
+		  keyswitch_id,
+		  created_by,
+		  featured_on,
+		  daily_date
+		FROM sound_test
+		WHERE sound_test_id = $1 AND created_by = $2`
+
+	err := m.DB.QueryRow(context.Background(), stmt, soundtestID, userID).Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.KeyboardID, &st.PlateMaterialID, &st.KeycapMaterialID, &st.KeyswitchID, &st.CreatedBy, &st.FeaturedOn, &st.DailyDate)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return st, ErrNoRecord
+		}
+		return st, err
+	}
+
+	return st, nil
+}
+
+func (m *SoundTestModel) Update(soundtestID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch string, attributes map[string]string) error {
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	stmt := `UPDATE sound_test
+		SET keyboard_id = $3, plate_material_id = $4, keycap_material_id = $5, keyswitch_id = $6, last_updated = now()
+		WHERE sound_test_id = $1 AND created_by = $2 AND featured_on IS NULL`
+
+	tag, err := tx.Exec(context.Background(), stmt, soundtestID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	_, err = tx.Exec(context.Background(), "DELETE FROM sound_test_attribute WHERE sound_test_id = $1", soundtestID)
+	if err != nil {
+		return err
+	}
+
+	err = insertAttributes(tx, soundtestID, attributes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Delete removes a soundtest that has never been featured along with its
+// votes, returning the object key so the caller can clean up storage.
+func (m *SoundTestModel) Delete(soundtestID, userID string) (string, error) {
+	var objKey string
+
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return objKey, err
+	}
+	defer tx.Rollback(context.Background())
+
+	stmt := `DELETE FROM vote
+		WHERE sound_test_id = (
+			SELECT sound_test_id
+			FROM sound_test
+			WHERE sound_test_id = $1 AND created_by = $2 AND featured_on IS NULL
+		)`
+
+	_, err = tx.Exec(context.Background(), stmt, soundtestID, userID)
+	if err != nil {
+		return objKey, err
+	}
+
+	stmt = `DELETE FROM sound_test
+		WHERE sound_test_id = $1 AND created_by = $2 AND featured_on IS NULL
+		RETURNING url`
+
+	err = tx.QueryRow(context.Background(), stmt, soundtestID, userID).Scan(&objKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return objKey, ErrNoRecord
+		}
+		return objKey, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return objKey, err
+	}
+
+	return objKey, nil
+}
+
+// GetDaily returns the sound of the day for date, a calendar date in the
+// player's timezone. If none has been featured for date yet it falls back to
+// the latest one before it.
+func (m *SoundTestModel) GetDaily(date time.Time) (SoundTest, error) {
 	var st SoundTest
 
 	stmt := `SELECT
@@ -107,13 +514,14 @@ func (m *SoundTestModel) GetDaily() (SoundTest, error) {
 		  keycap_material_id,
 		  keyswitch_id,
 		  created_by,
-		  featured_on
+		  featured_on,
+		  daily_date
 		FROM sound_test
-		WHERE featured_on IS NOT NULL
-		ORDER BY featured_on DESC
+		WHERE daily_date <= $1
+		ORDER BY daily_date DESC
 		LIMIT 1`
 
-	err := m.DB.QueryRow(context.Background(), stmt).Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.KeyboardID, &st.PlateMaterialID, &st.KeycapMaterialID, &st.KeyswitchID, &st.CreatedBy, &st.FeaturedOn)
+	err := m.DB.QueryRow(context.Background(), stmt, CalendarDate(date)).Scan(&st.ID, &st.URL, &st.Uploaded, &st.LastUpdated, &st.KeyboardID, &st.PlateMaterialID, &st.KeycapMaterialID, &st.KeyswitchID, &st.CreatedBy, &st.FeaturedOn, &st.DailyDate)
 	if err != nil {
 		return st, err
 	}
@@ -121,18 +529,133 @@ func (m *SoundTestModel) GetDaily() (SoundTest, error) {
 	return st, nil
 }
 
-func (m *SoundTestModel) AddPlay(soundtest uuid.UUID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch string) error {
-	stmt := `INSERT INTO sound_test_play (sound_test_id, created_by, submitted, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id)
-		VALUES($1, $2, now(), $3, $4, $5, $6)`
+// RefreshRanks retakes the snapshot of scores ranked listings sort by.
+func (m *SoundTestModel) RefreshRanks() error {
+	_, err := m.DB.Exec(context.Background(), "REFRESH MATERIALIZED VIEW CONCURRENTLY sound_test_rank")
+	return err
+}
+
+// FeatureDaily makes the unfeatured soundtest with the best top score, the
+// same score behind the top ranking, the sound of the day for date. It does
+// nothing if date already has a sound of the day or no soundtest has more
+// weighted upvotes than downvotes, in which case ErrNoRecord is returned.
+func (m *SoundTestModel) FeatureDaily(date time.Time) (uuid.UUID, error) {
+	var soundtestID uuid.UUID
+
+	stmt := `UPDATE sound_test
+		SET featured_on = now(), daily_date = $1
+		WHERE
+			sound_test_id = (
+				SELECT st.sound_test_id
+				FROM sound_test st
+				JOIN sound_test_score s ON s.sound_test_id = st.sound_test_id
+				WHERE st.featured_on IS NULL AND NOT st.hidden AND s.weighted_upvotes > s.weighted_downvotes
+				ORDER BY s.top DESC, st.uploaded
+				LIMIT 1
+			)
+			AND NOT EXISTS (
+				SELECT true
+				FROM sound_test
+				WHERE daily_date = $1
+			)
+		RETURNING sound_test_id`
+
+	err := m.DB.QueryRow(context.Background(), stmt, CalendarDate(date)).Scan(&soundtestID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return soundtestID, ErrNoRecord
+		}
+		return soundtestID, err
+	}
+
+	return soundtestID, nil
+}
 
-	_, err := m.DB.Exec(context.Background(), stmt, soundtest, userID, keyboard, plateMaterial, keycapMaterial, keyswitch)
+func (m *SoundTestModel) AddPlay(soundtest uuid.UUID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch, mode string, attributes map[string]string) error {
+	tx, err := m.DB.Begin(context.Background())
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(context.Background())
+
+	err = addPlay(tx, soundtest, userID, keyboard, plateMaterial, keycapMaterial, keyswitch, mode, 1, attributes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+func addPlay(tx pgx.Tx, soundtest uuid.UUID, userID, keyboard, plateMaterial, keycapMaterial, keyswitch, mode string, attempts int, attributes map[string]string) error {
+	stmt := `INSERT INTO sound_test_play (sound_test_id, created_by, submitted, keyboard_id, plate_material_id, keycap_material_id, keyswitch_id, mode, attempts)
+		VALUES($1, $2, now(), $3, $4, $5, $6, $7, $8)`
+
+	_, err := tx.Exec(context.Background(), stmt, soundtest, userID, keyboard, plateMaterial, keycapMaterial, keyswitch, mode, attempts)
+	if err != nil {
+		return err
+	}
+
+	stmt = `INSERT INTO sound_test_play_attribute (sound_test_id, created_by, build_attribute_id, build_attribute_option_id)
+		VALUES ($1, $2, $3, $4)`
+
+	for attributeID, optionID := range attributes {
+		_, err = tx.Exec(context.Background(), stmt, soundtest, userID, attributeID, optionID)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
+type PlayAttribute struct {
+	Attribute string
+	Guess     string
+	Correct   string
+}
+
+func (m *SoundTestModel) GetPlayAttributes(soundtestID uuid.UUID, userID string) ([]PlayAttribute, error) {
+	var attributes []PlayAttribute
+
+	stmt := `SELECT
+			ba.name,
+			COALESCE(guess.name, ''),
+			correct.name
+		FROM sound_test_attribute sta
+		JOIN build_attribute ba USING (build_attribute_id)
+		JOIN build_attribute_option correct ON correct.build_attribute_option_id = sta.build_attribute_option_id
+		LEFT JOIN sound_test_play_attribute stpa ON
+			stpa.sound_test_id = sta.sound_test_id
+			AND stpa.build_attribute_id = sta.build_attribute_id
+			AND stpa.created_by = $2
+		LEFT JOIN build_attribute_option guess ON guess.build_attribute_option_id = stpa.build_attribute_option_id
+		WHERE sta.sound_test_id = $1 AND ba.bonus_round
+		ORDER BY ba.sort_order, ba.name`
+
+	rows, err := m.DB.Query(context.Background(), stmt, soundtestID, userID)
+	if err != nil {
+		return attributes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a PlayAttribute
+
+		err := rows.Scan(&a.Attribute, &a.Guess, &a.Correct)
+		if err != nil {
+			return attributes, err
+		}
+
+		attributes = append(attributes, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return attributes, err
+	}
+
+	return attributes, nil
+}
+
 type SoundTestPlay struct {
 	SoundTestID           uuid.UUID
 	URL                   string
@@ -146,9 +669,45 @@ type SoundTestPlay struct {
 	CorrectKeycapMaterial string
 	Keyswitch             string
 	CorrectKeyswitch      string
+	Mode                  string
+	Attempts              int
+	History               []Attempt
+	BonusRounds           []PlayAttribute
+}
+
+// Correct counts the parts the play got right.
+func (p SoundTestPlay) Correct() int {
+	correct := 0
+	for _, guess := range [][2]string{
+		{p.Keyboard, p.CorrectKeyboard},
+		{p.PlateMaterial, p.CorrectPlateMaterial},
+		{p.KeycapMaterial, p.CorrectKeycapMaterial},
+		{p.Keyswitch, p.CorrectKeyswitch},
+	} {
+		if guess[0] == guess[1] {
+			correct++
+		}
+	}
+	return correct
+}
+
+func (p SoundTestPlay) Points() int {
+	return PlayPoints(p.Mode, p.Correct(), p.Attempts)
+}
+
+// GetPlay gets userID's play of the sound of the day for date, see GetDaily.
+func (m *SoundTestModel) GetPlay(userID string, date time.Time) (SoundTestPlay, error) {
+	return m.getPlay("sound_test_play", "created_by", userID, date)
+}
+
+// GetGuestPlay is GetPlay for a visitor playing without an account.
+func (m *SoundTestModel) GetGuestPlay(guestID string, date time.Time) (SoundTestPlay, error) {
+	return m.getPlay("guest_play", "guest_id", guestID, date)
 }
 
-func (m *SoundTestModel) GetPlay(userID string) (SoundTestPlay, error) {
+// getPlay gets the play of the sound of the day for date made by the player
+// whose id is in column of table.
+func (m *SoundTestModel) getPlay(table, column, playerID string, date time.Time) (SoundTestPlay, error) {
 	var p SoundTestPlay
 
 	stmt := `SELECT
@@ -163,8 +722,10 @@ func (m *SoundTestModel) GetPlay(userID string) (SoundTestPlay, error) {
 		km.name keycap_material,
 		ckm.name correct_keycap_material,
 		ks.name keyswitch,
-		cks.name correct_keyswitch
-	FROM sound_test_play stp
+		cks.name correct_keyswitch,
+		stp.mode,
+		stp.attempts
+	FROM ` + table + ` stp
 	JOIN sound_test st USING (sound_test_id)
 	JOIN user_profile up ON st.created_by = up.user_profile_id
 	JOIN keyboard k ON stp.keyboard_id = k.keyboard_id
@@ -179,13 +740,13 @@ func (m *SoundTestModel) GetPlay(userID string) (SoundTestPlay, error) {
 		stp.sound_test_id = (
 			SELECT sound_test_id
 			FROM sound_test
-			WHERE featured_on IS NOT NULL
-			ORDER BY featured_on DESC
+			WHERE daily_date <= $2
+			ORDER BY daily_date DESC
 			LIMIT 1
 		)
-		AND stp.created_by = $1`
+		AND stp.` + column + ` = $1`
 
-	err := m.DB.QueryRow(context.Background(), stmt, userID).Scan(&p.SoundTestID, &p.URL, &p.Submitted, &p.CreatedBy, &p.Keyboard, &p.CorrectKeyboard, &p.PlateMaterial, &p.CorrectPlateMaterial, &p.KeycapMaterial, &p.CorrectKeycapMaterial, &p.Keyswitch, &p.CorrectKeyswitch)
+	err := m.DB.QueryRow(context.Background(), stmt, playerID, CalendarDate(date)).Scan(&p.SoundTestID, &p.URL, &p.Submitted, &p.CreatedBy, &p.Keyboard, &p.CorrectKeyboard, &p.PlateMaterial, &p.CorrectPlateMaterial, &p.KeycapMaterial, &p.CorrectKeycapMaterial, &p.Keyswitch, &p.CorrectKeyswitch, &p.Mode, &p.Attempts)
 	if err != nil {
 		return p, err
 	}
@@ -0,0 +1,252 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+const (
+	// trustMaturity is the account age at which age stops adding trust.
+	trustMaturity = 30 * 24 * time.Hour
+	// trustPlays is the number of daily plays after which play history stops
+	// adding trust.
+	trustPlays = 10
+)
+
+// TrustSignals are what we know about an account when deciding how much its
+// votes count towards picking the sound of the day.
+type TrustSignals struct {
+	Created  time.Time
+	Verified bool
+	Plays    int
+}
+
+// Weight scores the account between 0.1 and 1. A brand new, unverified account
+// that has never played counts for a tenth of an established player.
+func (t TrustSignals) Weight(now time.Time) float64 {
+	weight := 0.1
+
+	age := now.Sub(t.Created)
+	if age > 0 {
+		weight += 0.4 * math.Min(float64(age)/float64(trustMaturity), 1)
+	}
+
+	if t.Verified {
+		weight += 0.2
+	}
+
+	weight += 0.3 * math.Min(float64(t.Plays)/trustPlays, 1)
+
+	return math.Round(weight*100) / 100
+}
+
+func (m *UserModel) GetTrust(userID string) (TrustSignals, error) {
+	var t TrustSignals
+
+	stmt := `SELECT
+			up.created,
+			up.email_verified IS NOT NULL,
+			(SELECT count(*) FROM sound_test_play WHERE created_by = up.user_profile_id)
+		FROM user_profile up
+		WHERE up.user_profile_id = $1`
+
+	err := m.DB.QueryRow(context.Background(), stmt, userID).Scan(&t.Created, &t.Verified, &t.Plays)
+	if err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+// AccountVote is a single vote cast by a recently created account.
+type AccountVote struct {
+	UserID      uuid.UUID
+	Username    string
+	Created     time.Time
+	SoundTestID uuid.UUID
+	VoteType    int
+}
+
+func (m *VoteModel) GetNewAccountVotes(since time.Time) ([]AccountVote, error) {
+	var votes []AccountVote
+
+	stmt := `SELECT
+			up.user_profile_id,
+			COALESCE(up.username, 'anonymous'),
+			up.created,
+			v.sound_test_id,
+			v.vote_type
+		FROM vote v
+		JOIN user_profile up ON up.user_profile_id = v.created_by
+		WHERE up.created >= $1 AND v.vote_type <> 0
+		ORDER BY up.created, up.user_profile_id`
+
+	rows, err := m.DB.Query(context.Background(), stmt, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v AccountVote
+
+		err := rows.Scan(&v.UserID, &v.Username, &v.Created, &v.SoundTestID, &v.VoteType)
+		if err != nil {
+			return nil, err
+		}
+
+		votes = append(votes, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return votes, nil
+}
+
+type RingMember struct {
+	UserID   uuid.UUID
+	Username string
+	Created  time.Time
+}
+
+type RingVote struct {
+	SoundTestID uuid.UUID
+	VoteType    int
+}
+
+// VoteRing is a group of accounts that cast exactly the same votes.
+type VoteRing struct {
+	Members []RingMember
+	Votes   []RingVote
+}
+
+// DetectVoteRings groups accounts by the full set of votes they cast and
+// returns every group of at least minMembers accounts, largest first. Voting
+// identically on a single soundtest is common, so only accounts that agree on
+// at least minVotes soundtests are considered.
+func DetectVoteRings(votes []AccountVote, minMembers, minVotes int) []VoteRing {
+	type account struct {
+		member RingMember
+		votes  []RingVote
+	}
+
+	var order []uuid.UUID
+	accounts := make(map[uuid.UUID]*account)
+	for _, v := range votes {
+		a, ok := accounts[v.UserID]
+		if !ok {
+			a = &account{member: RingMember{UserID: v.UserID, Username: v.Username, Created: v.Created}}
+			accounts[v.UserID] = a
+			order = append(order, v.UserID)
+		}
+		a.votes = append(a.votes, RingVote{SoundTestID: v.SoundTestID, VoteType: v.VoteType})
+	}
+
+	var keys []string
+	rings := make(map[string]*VoteRing)
+	for _, id := range order {
+		a := accounts[id]
+		if len(a.votes) < minVotes {
+			continue
+		}
+
+		sort.Slice(a.votes, func(i, j int) bool {
+			return a.votes[i].SoundTestID.String() < a.votes[j].SoundTestID.String()
+		})
+
+		var b strings.Builder
+		for _, v := range a.votes {
+			b.WriteString(v.SoundTestID.String())
+			b.WriteString(strconv.Itoa(v.VoteType))
+		}
+		key := b.String()
+
+		ring, ok := rings[key]
+		if !ok {
+			ring = &VoteRing{Votes: a.votes}
+			rings[key] = ring
+			keys = append(keys, key)
+		}
+		ring.Members = append(ring.Members, a.member)
+	}
+
+	var found []VoteRing
+	for _, key := range keys {
+		if len(rings[key].Members) >= minMembers {
+			found = append(found, *rings[key])
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return len(found[i].Members) > len(found[j].Members)
+	})
+
+	return found
+}
+
+// SuspiciousSoundTest is a soundtest where new accounts cast at least half of
+// the votes.
+type SuspiciousSoundTest struct {
+	ID            uuid.UUID
+	Keyboard      string
+	Keyswitch     string
+	FeaturedOn    *time.Time
+	Votes         int
+	NewVotes      int
+	TotalVotes    int
+	WeightedVotes float64
+}
+
+func (m *VoteModel) GetSuspicious(since time.Time, minVotes int) ([]SuspiciousSoundTest, error) {
+	var soundtests []SuspiciousSoundTest
+
+	stmt := `SELECT
+			st.sound_test_id,
+			k.name,
+			ks.name,
+			st.featured_on,
+			count(*),
+			count(*) FILTER (WHERE up.created >= $1),
+			SUM(v.vote_type),
+			SUM(v.vote_type * v.weight)::float8
+		FROM vote v
+		JOIN sound_test st USING (sound_test_id)
+		JOIN keyboard k ON k.keyboard_id = st.keyboard_id
+		JOIN keyswitch ks ON ks.keyswitch_id = st.keyswitch_id
+		JOIN user_profile up ON up.user_profile_id = v.created_by
+		WHERE v.vote_type <> 0
+		GROUP BY st.sound_test_id, k.name, ks.name
+		HAVING count(*) >= $2 AND count(*) FILTER (WHERE up.created >= $1) * 2 >= count(*)
+		ORDER BY count(*) FILTER (WHERE up.created >= $1) DESC, st.uploaded DESC`
+
+	rows, err := m.DB.Query(context.Background(), stmt, since, minVotes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s SuspiciousSoundTest
+
+		err := rows.Scan(&s.ID, &s.Keyboard, &s.Keyswitch, &s.FeaturedOn, &s.Votes, &s.NewVotes, &s.TotalVotes, &s.WeightedVotes)
+		if err != nil {
+			return nil, err
+		}
+
+		soundtests = append(soundtests, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return soundtests, nil
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestTrustSignalsWeight(t *testing.T) {
+	now := time.Date(2022, time.December, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		signals TrustSignals
+		want    float64
+	}{
+		"brand new account": {
+			signals: TrustSignals{Created: now},
+			want:    0.1,
+		},
+		"half matured": {
+			signals: TrustSignals{Created: now.Add(-15 * 24 * time.Hour)},
+			want:    0.3,
+		},
+		"verified regular player": {
+			signals: TrustSignals{Created: now.Add(-90 * 24 * time.Hour), Verified: true, Plays: 40},
+			want:    1,
+		},
+		"new verified account with some plays": {
+			signals: TrustSignals{Created: now, Verified: true, Plays: 5},
+			want:    0.45,
+		},
+		"created in the future": {
+			signals: TrustSignals{Created: now.Add(time.Hour)},
+			want:    0.1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.signals.Weight(now)
+			if tc.want != got {
+				t.Errorf("want: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDetectVoteRings(t *testing.T) {
+	a := uuid.Must(uuid.FromString("05ff139b-8b9a-4341-a161-8628c3e038e7"))
+	b := uuid.Must(uuid.FromString("2a0f3ad4-216d-43db-a731-fdab599e2d45"))
+	c := uuid.Must(uuid.FromString("9b1e7c2e-5f0d-4b8e-9a47-3f6c2d1e0a55"))
+
+	vote := func(user string, soundtest uuid.UUID, voteType int) AccountVote {
+		return AccountVote{UserID: uuid.NewV5(uuid.Nil, user), Username: user, SoundTestID: soundtest, VoteType: voteType}
+	}
+
+	votes := []AccountVote{
+		vote("sock1", a, 1), vote("sock1", b, -1),
+		vote("sock2", b, -1), vote("sock2", a, 1),
+		vote("sock3", a, 1), vote("sock3", b, -1),
+		vote("honest", a, 1), vote("honest", b, 1),
+		vote("lurker", a, 1),
+		vote("pair1", a, 1), vote("pair1", c, 1),
+		vote("pair2", a, 1), vote("pair2", c, 1),
+	}
+
+	tests := map[string]struct {
+		minMembers  int
+		minVotes    int
+		wantMembers [][]string
+	}{
+		"rings of three": {
+			minMembers:  3,
+			minVotes:    2,
+			wantMembers: [][]string{{"sock1", "sock2", "sock3"}},
+		},
+		"rings of two, largest first": {
+			minMembers:  2,
+			minVotes:    2,
+			wantMembers: [][]string{{"sock1", "sock2", "sock3"}, {"pair1", "pair2"}},
+		},
+		"no ring large enough": {
+			minMembers:  6,
+			minVotes:    1,
+			wantMembers: nil,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rings := DetectVoteRings(votes, tc.minMembers, tc.minVotes)
+
+			if len(rings) != len(tc.wantMembers) {
+				t.Fatalf("want %d rings, got: %d", len(tc.wantMembers), len(rings))
+			}
+
+			for i, ring := range rings {
+				if len(ring.Members) != len(tc.wantMembers[i]) {
+					t.Fatalf("ring %d: want members %v, got: %v", i, tc.wantMembers[i], ring.Members)
+				}
+				for j, member := range ring.Members {
+					if member.Username != tc.wantMembers[i][j] {
+						t.Errorf("ring %d: want member %s, got: %s", i, tc.wantMembers[i][j], member.Username)
+					}
+				}
+				if len(ring.Votes) < tc.minVotes {
+					t.Errorf("ring %d: want at least %d votes, got: %d", i, tc.minVotes, len(ring.Votes))
+				}
+			}
+		})
+	}
+}
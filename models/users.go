@@ -27,39 +27,43 @@ type UserModel struct {
 	DB *pgxpool.Pool
 }
 
-func (m *UserModel) Insert(email, password string) error {
+func (m *UserModel) Insert(email, password string) (uuid.UUID, error) {
+	var userID uuid.UUID
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
-		return err
+		return userID, err
 	}
 
 	stmt := `INSERT INTO user_profile (email, hashed_password, created)
-		VALUES ($1, $2, now())`
+		VALUES ($1, $2, now())
+		RETURNING user_profile_id`
 
-	_, err = m.DB.Exec(context.Background(), stmt, email, hashedPassword)
+	err = m.DB.QueryRow(context.Background(), stmt, email, hashedPassword).Scan(&userID)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			switch pgErr.Code {
 			case pgerrcode.UniqueViolation:
-				return ErrDuplicateEmail
+				return userID, ErrDuplicateEmail
 			}
 		}
-		return err
+		return userID, err
 	}
 
-	return nil
+	return userID, nil
 }
 
 func (m *UserModel) Authenticate(email, password string) (uuid.UUID, error) {
 	var userID uuid.UUID
 	var hashedPassword []byte
+	var suspended bool
 
-	stmt := `SELECT user_profile_id, hashed_password
+	stmt := `SELECT user_profile_id, hashed_password, suspended IS NOT NULL
 		FROM user_profile
 		WHERE email = $1`
 
-	err := m.DB.QueryRow(context.Background(), stmt, email).Scan(&userID, &hashedPassword)
+	err := m.DB.QueryRow(context.Background(), stmt, email).Scan(&userID, &hashedPassword, &suspended)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return userID, ErrInvalidCredentials
@@ -75,25 +79,101 @@ func (m *UserModel) Authenticate(email, password string) (uuid.UUID, error) {
 		return userID, err
 	}
 
+	// Only tell people their account is suspended once they've proven it's
+	// theirs.
+	if suspended {
+		return userID, ErrSuspended
+	}
+
 	return userID, nil
 }
 
-func (m *UserModel) Exists(id string) (bool, error) {
-	var exists bool
+type UserStatus struct {
+	Exists    bool
+	Suspended bool
+	Access    Access
+	Unread    int
+	Timezone  string
+}
+
+func (m *UserModel) Status(id string) (UserStatus, error) {
+	var s UserStatus
+
+	stmt := `SELECT true, up.suspended IS NOT NULL, up.role_id,
+			array_remove(array_agg(rp.permission_id), NULL),
+			(SELECT count(*) FROM notification n WHERE n.user_profile_id = up.user_profile_id AND n.read IS NULL),
+			COALESCE(up.timezone, '')
+		FROM user_profile up
+		LEFT JOIN role_permission rp USING (role_id)
+		WHERE up.user_profile_id = $1
+		GROUP BY up.user_profile_id`
+
+	err := m.DB.QueryRow(context.Background(), stmt, id).Scan(&s.Exists, &s.Suspended, &s.Access.Role, &s.Access.Permissions, &s.Unread, &s.Timezone)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// SetDefaultTimezone sets userID's timezone to the one their browser reported
+// unless they already have one.
+func (m *UserModel) SetDefaultTimezone(userID, timezone string) error {
+	stmt := `UPDATE user_profile SET timezone = $2 WHERE user_profile_id = $1 AND timezone IS NULL`
+
+	_, err := m.DB.Exec(context.Background(), stmt, userID, timezone)
+	return err
+}
+
+type Warning struct {
+	Message string
+	Created time.Time
+}
+
+// GetWarnings lists the moderator warnings a user has received, newest first.
+func (m *UserModel) GetWarnings(userID string) ([]Warning, error) {
+	var warnings []Warning
 
-	stmt := "SELECT EXISTS(SELECT true FROM user_profile WHERE user_profile_id = $1)"
+	stmt := `SELECT message, created
+		FROM user_warning
+		WHERE user_profile_id = $1
+		ORDER BY created DESC`
 
-	err := m.DB.QueryRow(context.Background(), stmt, id).Scan(&exists)
+	rows, err := m.DB.Query(context.Background(), stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w Warning
+
+		err := rows.Scan(&w.Message, &w.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		warnings = append(warnings, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return exists, err
+	return warnings, nil
 }
 
 type ProfileInfo struct {
-	ID          uuid.UUID
-	Email       string
-	LastUpdated time.Time
-	Name        string
-	Username    string
+	ID              uuid.UUID
+	Email           string
+	LastUpdated     time.Time
+	Name            string
+	Username        string
+	Bio             string
+	Avatar          string
+	ShowPlayHistory bool
+	Timezone        string
+	EmailVerified   bool
 }
 
 func (m *UserModel) GetProfileInfo(userID string) (ProfileInfo, error) {
@@ -104,11 +184,16 @@ func (m *UserModel) GetProfileInfo(userID string) (ProfileInfo, error) {
 				email,
 				last_updated,
 				COALESCE(name, ''),
-				COALESCE(username, '')
+				COALESCE(username, ''),
+				bio,
+				COALESCE(avatar, ''),
+				show_play_history,
+				COALESCE(timezone, ''),
+				email_verified IS NOT NULL
 			FROM user_profile
 			WHERE user_profile_id = $1`
 
-	err := m.DB.QueryRow(context.Background(), stmt, userID).Scan(&p.ID, &p.Email, &p.LastUpdated, &p.Name, &p.Username)
+	err := m.DB.QueryRow(context.Background(), stmt, userID).Scan(&p.ID, &p.Email, &p.LastUpdated, &p.Name, &p.Username, &p.Bio, &p.Avatar, &p.ShowPlayHistory, &p.Timezone, &p.EmailVerified)
 	if err != nil {
 		return p, err
 	}
@@ -116,12 +201,14 @@ func (m *UserModel) GetProfileInfo(userID string) (ProfileInfo, error) {
 	return p, nil
 }
 
-func (m *UserModel) UpdateProfile(userID, email, name, username string) error {
+// UpdateProfile saves userID's profile. Changing their email address means
+// it has to be verified again.
+func (m *UserModel) UpdateProfile(userID, email, name, username, bio string, showPlayHistory bool, timezone string) error {
 	stmt := `UPDATE user_profile
-		SET email = $2, name = $3, username = NULLIF($4, ''), last_updated = now()
+		SET email = $2, email_verified = CASE WHEN email = $2 THEN email_verified END, name = $3, username = NULLIF($4, ''), bio = $5, show_play_history = $6, timezone = NULLIF($7, ''), last_updated = now()
 		WHERE user_profile_id = $1`
 
-	_, err := m.DB.Exec(context.Background(), stmt, userID, email, name, username)
+	_, err := m.DB.Exec(context.Background(), stmt, userID, email, name, username, bio, showPlayHistory, timezone)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
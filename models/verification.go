@@ -0,0 +1,91 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
+)
+
+// emailVerificationTTL is how long an emailed verification link works for.
+const emailVerificationTTL = 48 * time.Hour
+
+func hashVerificationToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// NewEmailVerification makes a token for a link confirming userID's current
+// email address and returns it with the address to send it to. Links sent
+// before it stop working.
+func (m *UserModel) NewEmailVerification(userID string) (string, string, error) {
+	var email string
+
+	raw := make([]byte, 32)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", email, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return "", email, err
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), "DELETE FROM email_verification WHERE user_profile_id = $1", userID)
+	if err != nil {
+		return "", email, err
+	}
+
+	stmt := `INSERT INTO email_verification (token_hash, user_profile_id, email, expires)
+		SELECT $1, user_profile_id, email, $3
+		FROM user_profile
+		WHERE user_profile_id = $2
+		RETURNING email`
+
+	err = tx.QueryRow(context.Background(), stmt, hashVerificationToken(token), userID, time.Now().Add(emailVerificationTTL)).Scan(&email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", email, ErrNoRecord
+		}
+		return "", email, err
+	}
+
+	return token, email, tx.Commit(context.Background())
+}
+
+// VerifyEmail marks the address a verification link was sent to as verified
+// and returns whose it is. The link can't be used again. ErrNoRecord is
+// returned if the token is unknown or expired, or the user has since changed
+// their address.
+func (m *UserModel) VerifyEmail(token string) (uuid.UUID, error) {
+	var userID uuid.UUID
+
+	stmt := `WITH v AS (
+			DELETE FROM email_verification
+			WHERE token_hash = $1
+			RETURNING user_profile_id, email, expires
+		)
+		UPDATE user_profile up
+		SET email_verified = now()
+		FROM v
+		WHERE up.user_profile_id = v.user_profile_id AND up.email = v.email AND v.expires > now()
+		RETURNING up.user_profile_id`
+
+	err := m.DB.QueryRow(context.Background(), stmt, hashVerificationToken(token)).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return userID, ErrNoRecord
+		}
+		return userID, err
+	}
+
+	return userID, nil
+}
@@ -2,9 +2,11 @@ package models
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -19,16 +21,165 @@ type VoteModel struct {
 	DB *pgxpool.Pool
 }
 
-func (m *VoteModel) Upsert(soundtestID string, voteType int, userID string) error {
-	stmt := `INSERT INTO vote (sound_test_id, vote_type, created_by)
-	VALUES ($1, $2, $3)
-	ON CONFLICT (sound_test_id, created_by)
-	DO UPDATE SET vote_type = EXCLUDED.vote_type`
+// Tally holds the vote counts kept in sound_test_tally.
+type Tally struct {
+	Upvotes           int
+	Downvotes         int
+	WeightedUpvotes   float64
+	WeightedDownvotes float64
+}
+
+// Net is the trust weighted upvotes less downvotes.
+func (t Tally) Net() float64 {
+	return t.WeightedUpvotes - t.WeightedDownvotes
+}
+
+// tallyChange is what changing a vote from prevType to voteType does to the
+// soundtest's tally. A vote type of zero is no vote.
+func tallyChange(prevType int, prevWeight float64, voteType int, weight float64) Tally {
+	var t Tally
+
+	switch prevType {
+	case 1:
+		t.Upvotes--
+		t.WeightedUpvotes -= prevWeight
+	case -1:
+		t.Downvotes--
+		t.WeightedDownvotes -= prevWeight
+	}
+
+	switch voteType {
+	case 1:
+		t.Upvotes++
+		t.WeightedUpvotes += weight
+	case -1:
+		t.Downvotes++
+		t.WeightedDownvotes += weight
+	}
+
+	return t
+}
+
+// Upsert records the user's vote along with how much it should count, see
+// TrustSignals.Weight, and updates the soundtest's tally to match. Changing a
+// vote re-weighs it with the account's current trust.
+func (m *VoteModel) Upsert(soundtestID string, voteType int, weight float64, userID string) error {
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	// Locking the tally row first serializes votes on the soundtest, so two
+	// requests can't both count the same previous vote.
+	stmt := `INSERT INTO sound_test_tally (sound_test_id)
+		VALUES ($1)
+		ON CONFLICT (sound_test_id) DO NOTHING`
+
+	_, err = tx.Exec(context.Background(), stmt, soundtestID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(context.Background(), "SELECT true FROM sound_test_tally WHERE sound_test_id = $1 FOR UPDATE", soundtestID)
+	if err != nil {
+		return err
+	}
+
+	var prevType int
+	var prevWeight float64
+
+	stmt = `SELECT vote_type, weight::float8
+		FROM vote
+		WHERE sound_test_id = $1 AND created_by = $2`
 
-	_, err := m.DB.Exec(context.Background(), stmt, soundtestID, voteType, userID)
+	err = tx.QueryRow(context.Background(), stmt, soundtestID, userID).Scan(&prevType, &prevWeight)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	stmt = `INSERT INTO vote (sound_test_id, vote_type, weight, created_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (sound_test_id, created_by)
+		DO UPDATE SET vote_type = EXCLUDED.vote_type, weight = EXCLUDED.weight, last_updated = now()
+		RETURNING weight::float8`
+
+	// The weight column is a real, so count the stored weight rather than
+	// the one passed in to match what ReconcileTallies adds up.
+	err = tx.QueryRow(context.Background(), stmt, soundtestID, voteType, weight, userID).Scan(&weight)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	change := tallyChange(prevType, prevWeight, voteType, weight)
+
+	// The change also counts towards recent votes for the rising ranking,
+	// on top of what's left of the earlier ones.
+	stmt = `UPDATE sound_test_tally
+		SET
+			upvotes = upvotes + $2,
+			downvotes = downvotes + $3,
+			weighted_upvotes = weighted_upvotes + $4,
+			weighted_downvotes = weighted_downvotes + $5,
+			recent = decay_recent(recent, recent_at) + $6,
+			recent_at = now()
+		WHERE sound_test_id = $1`
+
+	_, err = tx.Exec(context.Background(), stmt, soundtestID, change.Upvotes, change.Downvotes, change.WeightedUpvotes, change.WeightedDownvotes, change.Net())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// ReconcileTallies recounts every soundtest's tally from the vote table and
+// returns how many tallies were wrong. Recent votes are left alone, they
+// fade out by themselves.
+func (m *VoteModel) ReconcileTallies() (int64, error) {
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	// Hold off new votes so none are counted twice or missed mid-rebuild.
+	_, err = tx.Exec(context.Background(), "LOCK TABLE vote IN SHARE MODE")
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO sound_test_tally AS t (sound_test_id, upvotes, downvotes, weighted_upvotes, weighted_downvotes)
+		SELECT
+			st.sound_test_id,
+			count(v.*) FILTER (WHERE v.vote_type = 1),
+			count(v.*) FILTER (WHERE v.vote_type = -1),
+			COALESCE(SUM(v.weight::float8) FILTER (WHERE v.vote_type = 1), 0),
+			COALESCE(SUM(v.weight::float8) FILTER (WHERE v.vote_type = -1), 0)
+		FROM sound_test st
+		LEFT JOIN vote v ON v.sound_test_id = st.sound_test_id
+		GROUP BY st.sound_test_id
+		ON CONFLICT (sound_test_id) DO UPDATE
+		SET
+			upvotes = EXCLUDED.upvotes,
+			downvotes = EXCLUDED.downvotes,
+			weighted_upvotes = EXCLUDED.weighted_upvotes,
+			weighted_downvotes = EXCLUDED.weighted_downvotes
+		WHERE
+			t.upvotes <> EXCLUDED.upvotes
+			OR t.downvotes <> EXCLUDED.downvotes
+			OR abs(t.weighted_upvotes - EXCLUDED.weighted_upvotes) > 1e-6
+			OR abs(t.weighted_downvotes - EXCLUDED.weighted_downvotes) > 1e-6`
+
+	tag, err := tx.Exec(context.Background(), stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
 }
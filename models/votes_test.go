@@ -0,0 +1,65 @@
+package models
+
+import "testing"
+
+func TestTallyChange(t *testing.T) {
+	tests := map[string]struct {
+		prevType   int
+		prevWeight float64
+		voteType   int
+		weight     float64
+		want       Tally
+	}{
+		"first upvote": {
+			voteType: 1,
+			weight:   0.5,
+			want:     Tally{Upvotes: 1, WeightedUpvotes: 0.5},
+		},
+		"first downvote": {
+			voteType: -1,
+			weight:   1,
+			want:     Tally{Downvotes: 1, WeightedDownvotes: 1},
+		},
+		"remove upvote": {
+			prevType:   1,
+			prevWeight: 0.25,
+			voteType:   0,
+			weight:     0.5,
+			want:       Tally{Upvotes: -1, WeightedUpvotes: -0.25},
+		},
+		"switch to downvote": {
+			prevType:   1,
+			prevWeight: 0.25,
+			voteType:   -1,
+			weight:     0.5,
+			want:       Tally{Upvotes: -1, Downvotes: 1, WeightedUpvotes: -0.25, WeightedDownvotes: 0.5},
+		},
+		"re-weigh same vote": {
+			prevType:   -1,
+			prevWeight: 0.25,
+			voteType:   -1,
+			weight:     0.75,
+			want:       Tally{WeightedDownvotes: 0.5},
+		},
+		"no vote to no vote": {
+			want: Tally{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tallyChange(tc.prevType, tc.prevWeight, tc.voteType, tc.weight)
+			if tc.want != got {
+				t.Errorf("want: %+v, got: %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTallyNet(t *testing.T) {
+	change := tallyChange(-1, 0.5, 1, 0.75)
+
+	if got, want := change.Net(), 1.25; got != want {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
@@ -0,0 +1,320 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	EventDailyRotated       = "daily.rotated"
+	EventSoundTestUploaded  = "soundtest.uploaded"
+	EventSoundTestFeatured  = "soundtest.featured"
+	DeliveryPending         = "pending"
+	DeliveryDelivered       = "delivered"
+	DeliveryFailed          = "failed"
+	maxDeliveryAttempts     = 6
+	firstDeliveryRetryDelay = 30 * time.Second
+)
+
+// WebhookEvents are the events a webhook can subscribe to.
+var WebhookEvents = []string{EventDailyRotated, EventSoundTestUploaded, EventSoundTestFeatured}
+
+type Webhook struct {
+	ID      uuid.UUID
+	URL     string
+	Secret  string
+	Events  []string
+	Active  bool
+	Created time.Time
+}
+
+type WebhookModel struct {
+	DB *pgxpool.Pool
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Insert adds a webhook with a freshly generated signing secret.
+func (m *WebhookModel) Insert(url string, events []string, userID string) (uuid.UUID, error) {
+	var id uuid.UUID
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return id, err
+	}
+
+	stmt := `INSERT INTO webhook (url, secret, events, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING webhook_id`
+
+	err = m.DB.QueryRow(context.Background(), stmt, url, secret, events, userID).Scan(&id)
+	return id, err
+}
+
+func (m *WebhookModel) GetAll() ([]Webhook, error) {
+	var webhooks []Webhook
+
+	stmt := `SELECT webhook_id, url, secret, events, active, created
+		FROM webhook
+		ORDER BY created`
+
+	rows, err := m.DB.Query(context.Background(), stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wh Webhook
+
+		err := rows.Scan(&wh.ID, &wh.URL, &wh.Secret, &wh.Events, &wh.Active, &wh.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, wh)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (m *WebhookModel) SetActive(webhookID string, active bool) error {
+	tag, err := m.DB.Exec(context.Background(), "UPDATE webhook SET active = $2 WHERE webhook_id = $1", webhookID, active)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+func (m *WebhookModel) Delete(webhookID string) error {
+	tag, err := m.DB.Exec(context.Background(), "DELETE FROM webhook WHERE webhook_id = $1", webhookID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Enqueue queues payload for delivery to every active webhook subscribed to
+// event and returns how many deliveries were queued.
+func (m *WebhookModel) Enqueue(event string, payload []byte) (int64, error) {
+	stmt := `INSERT INTO webhook_delivery (webhook_id, event, payload)
+		SELECT webhook_id, $1, $2
+		FROM webhook
+		WHERE active AND $1 = ANY(events)`
+
+	tag, err := m.DB.Exec(context.Background(), stmt, event, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// Delivery is one event on its way to one webhook.
+type Delivery struct {
+	ID             uuid.UUID
+	WebhookID      uuid.UUID
+	URL            string
+	Secret         string
+	Event          string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	NextAttempt    time.Time
+	LastStatusCode *int
+	LastError      string
+	Created        time.Time
+	Delivered      *time.Time
+}
+
+// ClaimDue takes up to limit deliveries that are due. Claimed deliveries are
+// leased for lease so other workers skip them while they're being sent.
+func (m *WebhookModel) ClaimDue(limit int, lease time.Duration) ([]Delivery, error) {
+	stmt := `UPDATE webhook_delivery wd
+		SET next_attempt = now() + $2::interval
+		FROM webhook w
+		WHERE
+			w.webhook_id = wd.webhook_id
+			AND wd.webhook_delivery_id IN (
+				SELECT webhook_delivery_id
+				FROM webhook_delivery
+				WHERE status = 'pending' AND next_attempt <= now()
+				ORDER BY next_attempt
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+		RETURNING
+			wd.webhook_delivery_id,
+			wd.webhook_id,
+			w.url,
+			w.secret,
+			wd.event,
+			wd.payload::text,
+			wd.status,
+			wd.attempts,
+			wd.next_attempt,
+			wd.last_status_code,
+			wd.last_error,
+			wd.created,
+			wd.delivered`
+
+	return m.queryDeliveries(stmt, limit, lease)
+}
+
+// GetDeliveries lists the most recent deliveries, optionally only those for
+// one webhook.
+func (m *WebhookModel) GetDeliveries(webhookID string, limit int) ([]Delivery, error) {
+	stmt := `SELECT
+			wd.webhook_delivery_id,
+			wd.webhook_id,
+			w.url,
+			'',
+			wd.event,
+			wd.payload::text,
+			wd.status,
+			wd.attempts,
+			wd.next_attempt,
+			wd.last_status_code,
+			wd.last_error,
+			wd.created,
+			wd.delivered
+		FROM webhook_delivery wd
+		JOIN webhook w ON w.webhook_id = wd.webhook_id
+		WHERE NULLIF($1, '') IS NULL OR wd.webhook_id = NULLIF($1, '')::uuid
+		ORDER BY wd.created DESC
+		LIMIT $2`
+
+	return m.queryDeliveries(stmt, webhookID, limit)
+}
+
+func (m *WebhookModel) queryDeliveries(stmt string, args ...any) ([]Delivery, error) {
+	var deliveries []Delivery
+
+	rows, err := m.DB.Query(context.Background(), stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Delivery
+		var payload string
+
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.Event, &payload, &d.Status, &d.Attempts, &d.NextAttempt, &d.LastStatusCode, &d.LastError, &d.Created, &d.Delivered)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Payload = []byte(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RetryDelay is how long to wait after a delivery's attempt'th failed
+// attempt, doubling each time. Zero means give up.
+func RetryDelay(attempt int) time.Duration {
+	if attempt >= maxDeliveryAttempts {
+		return 0
+	}
+	return firstDeliveryRetryDelay << (attempt - 1)
+}
+
+// RecordAttempt stores the outcome of sending a delivery. statusCode is 0 when
+// no response was received. Failed attempts are retried with backoff until
+// they run out of attempts.
+func (m *WebhookModel) RecordAttempt(deliveryID uuid.UUID, statusCode int, sendErr error) error {
+	var attempts int
+
+	tx, err := m.DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	stmt := `UPDATE webhook_delivery
+		SET attempts = attempts + 1, last_status_code = NULLIF($2, 0), last_error = $3
+		WHERE webhook_delivery_id = $1 AND status = 'pending'
+		RETURNING attempts`
+
+	var errMsg string
+	if sendErr != nil {
+		errMsg = sendErr.Error()
+	}
+
+	err = tx.QueryRow(context.Background(), stmt, deliveryID, statusCode, errMsg).Scan(&attempts)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	switch delay := RetryDelay(attempts); {
+	case sendErr == nil:
+		stmt = "UPDATE webhook_delivery SET status = 'delivered', delivered = now() WHERE webhook_delivery_id = $1"
+		_, err = tx.Exec(context.Background(), stmt, deliveryID)
+	case delay == 0:
+		stmt = "UPDATE webhook_delivery SET status = 'failed' WHERE webhook_delivery_id = $1"
+		_, err = tx.Exec(context.Background(), stmt, deliveryID)
+	default:
+		stmt = "UPDATE webhook_delivery SET next_attempt = now() + $2::interval WHERE webhook_delivery_id = $1"
+		_, err = tx.Exec(context.Background(), stmt, deliveryID, delay)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(context.Background())
+}
+
+// Redeliver queues a failed delivery to be sent again with fresh attempts.
+func (m *WebhookModel) Redeliver(deliveryID string) error {
+	stmt := `UPDATE webhook_delivery
+		SET status = 'pending', attempts = 0, next_attempt = now()
+		WHERE webhook_delivery_id = $1 AND status = 'failed'`
+
+	tag, err := m.DB.Exec(context.Background(), stmt, deliveryID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
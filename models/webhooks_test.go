@@ -0,0 +1,26 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := map[string]struct {
+		attempt int
+		want    time.Duration
+	}{
+		"first failure":  {attempt: 1, want: 30 * time.Second},
+		"second failure": {attempt: 2, want: time.Minute},
+		"fifth failure":  {attempt: 5, want: 8 * time.Minute},
+		"out of retries": {attempt: maxDeliveryAttempts, want: 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := RetryDelay(tc.attempt); got != tc.want {
+				t.Errorf("got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
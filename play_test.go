@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/0xhjohnson/clacksy/models"
+)
+
+// testDailyDate makes st the sound of the day for a date far in the future,
+// returning a time on that date.
+func testDailyDate(t *testing.T, app *application, st models.SoundTest) time.Time {
+	t.Helper()
+
+	var day time.Time
+	err := app.soundtests.DB.QueryRow(context.Background(), "UPDATE sound_test SET daily_date = CURRENT_DATE + 36500 + (random() * 36500)::int WHERE sound_test_id = $1 RETURNING daily_date", st.ID).Scan(&day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return day.Add(12 * time.Hour)
+}
+
+func TestDailyModeLock(t *testing.T) {
+	app := newTestApplication(t, newTestDB(t))
+
+	player := testUser(t, app)
+	uploader := testUser(t, app)
+	st := testSoundTest(t, app, uploader)
+
+	now := testDailyDate(t, app, st)
+
+	seen := func(mode string) string {
+		t.Helper()
+
+		daily, err := app.loadDailySound(mode, "", player, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = app.soundtests.SetSeenMode(daily.SoundTest.ID, player, daily.Mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return daily.Mode
+	}
+
+	if got := seen(models.PlayModeHard); got != models.PlayModeHard {
+		t.Fatalf("first view got mode: %q, want: %q", got, models.PlayModeHard)
+	}
+	if got := seen(models.PlayModeClassic); got != models.PlayModeClassic {
+		t.Fatalf("switch got mode: %q, want: %q", got, models.PlayModeClassic)
+	}
+
+	// A new session, like another browser, still has the options shown.
+	if got := seen(models.PlayModeHard); got != models.PlayModeClassic {
+		t.Errorf("new session got mode: %q, want: %q", got, models.PlayModeClassic)
+	}
+
+	// A page loaded before the switch can't lock it back to hard mode.
+	err := app.soundtests.SetSeenMode(st.ID, player, models.PlayModeHard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode, err := app.soundtests.GetSeenMode(st.ID, player)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != models.PlayModeClassic {
+		t.Errorf("stale view got stored mode: %q, want: %q", mode, models.PlayModeClassic)
+	}
+}
+
+func TestDailyModeLockCarriesGuestSession(t *testing.T) {
+	app := newTestApplication(t, newTestDB(t))
+
+	player := testUser(t, app)
+	uploader := testUser(t, app)
+	st := testSoundTest(t, app, uploader)
+
+	daily, err := app.loadDailySound(models.PlayModeHard, st.ID.String()+" "+models.PlayModeClassic, player, testDailyDate(t, app, st))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if daily.Mode != models.PlayModeClassic {
+		t.Errorf("got mode: %q, want the %q mode seen as a guest", daily.Mode, models.PlayModeClassic)
+	}
+}
+
+func TestDailyOptionsPersisted(t *testing.T) {
+	app := newTestApplication(t, newTestDB(t))
+
+	uploader := testUser(t, app)
+	st := testSoundTest(t, app, uploader)
+
+	// Requests racing to choose the options all get the same ones.
+	results := make([]models.AllParts, 4)
+	errs := make(chan error, len(results))
+	for i := range results {
+		go func(i int) {
+			var err error
+			results[i], err = app.parts.GetDaily(st)
+			errs <- err
+		}(i)
+	}
+	for range results {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	again, err := app.parts.GetDaily(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, parts := range results {
+		if !reflect.DeepEqual(parts.Keyboards, again.Keyboards) || !reflect.DeepEqual(parts.Switches, again.Switches) || !reflect.DeepEqual(parts.PlateMaterials, again.PlateMaterials) {
+			t.Errorf("request %d got different options from the stored ones", i)
+		}
+	}
+}
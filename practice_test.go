@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/0xhjohnson/clacksy/models"
+	"github.com/gofrs/uuid"
+)
+
+func practiceGuess(st models.SoundTest) url.Values {
+	return url.Values{
+		"keyboard":        {st.KeyboardID.String()},
+		"keyswitch":       {st.KeyswitchID.String()},
+		"plate-material":  {st.PlateMaterialID.String()},
+		"keycap-material": {st.KeycapMaterialID.String()},
+	}
+}
+
+func TestAddPracticePlayWithoutSound(t *testing.T) {
+	app := newTestApplication(t, nil)
+	s := newTestSession(t, app, uuid.Must(uuid.NewV4()).String())
+
+	res := s.do(app.addPracticePlay, "/practice", url.Values{"keyboard": {uuid.Must(uuid.NewV4()).String()}})
+	assertRedirect(t, res, "/practice")
+}
+
+func TestPracticeExclusions(t *testing.T) {
+	app := newTestApplication(t, newTestDB(t))
+
+	player := testUser(t, app)
+	uploader := testUser(t, app)
+
+	own := testSoundTest(t, app, player)
+	featured := testSoundTest(t, app, uploader)
+	practiced := testSoundTest(t, app, uploader)
+	open := testSoundTest(t, app, uploader)
+
+	_, err := app.soundtests.DB.Exec(context.Background(), "UPDATE sound_test SET featured_on = now() WHERE sound_test_id = $1", featured.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = app.soundtests.AddPracticePlay(practiced.ID, player, practiced.KeyboardID.String(), practiced.PlateMaterialID.String(), practiced.KeycapMaterialID.String(), practiced.KeyswitchID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plays := func(st models.SoundTest) int {
+		var n int
+		err := app.soundtests.DB.QueryRow(context.Background(), "SELECT count(*) FROM practice_play WHERE sound_test_id = $1 AND created_by = $2", st.ID, player).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	tests := map[string]struct {
+		soundtest models.SoundTest
+		wantPlays int
+	}{
+		"own upload":        {soundtest: own, wantPlays: 0},
+		"featured":          {soundtest: featured, wantPlays: 0},
+		"already practiced": {soundtest: practiced, wantPlays: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newTestSession(t, app, player)
+			s.put(practiceSoundTestKey, tc.soundtest.ID.String())
+
+			res := s.do(app.addPracticePlay, "/practice", practiceGuess(tc.soundtest))
+			assertRedirect(t, res, "/practice")
+
+			if got := plays(tc.soundtest); got != tc.wantPlays {
+				t.Errorf("got plays: %d, want: %d", got, tc.wantPlays)
+			}
+		})
+	}
+
+	t.Run("never picked", func(t *testing.T) {
+		s := newTestSession(t, app, player)
+
+		res := s.do(app.getPractice, "/practice", nil)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("got status: %d, want: %d", res.StatusCode, http.StatusOK)
+		}
+
+		picked, _ := s.get(practiceSoundTestKey).(string)
+		for _, st := range []models.SoundTest{own, featured, practiced} {
+			if picked == st.ID.String() {
+				t.Errorf("picked excluded soundtest %s", picked)
+			}
+		}
+	})
+
+	t.Run("resubmitted", func(t *testing.T) {
+		s := newTestSession(t, app, player)
+		s.put(practiceSoundTestKey, open.ID.String())
+
+		res := s.do(app.addPracticePlay, "/practice", practiceGuess(open))
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("got status: %d, want: %d", res.StatusCode, http.StatusOK)
+		}
+		if got := s.get(practiceSoundTestKey); got != nil {
+			t.Errorf("practice soundtest left in session: %v", got)
+		}
+
+		res = s.do(app.addPracticePlay, "/practice", practiceGuess(open))
+		assertRedirect(t, res, "/practice")
+
+		if got := plays(open); got != 1 {
+			t.Errorf("got plays: %d, want: 1", got)
+		}
+		if got := s.get(practiceSoundsKey); got != 1 {
+			t.Errorf("got sounds: %v, want: 1", got)
+		}
+	})
+}
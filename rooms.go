@@ -0,0 +1,646 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xhjohnson/clacksy/models"
+	"github.com/gofrs/uuid"
+)
+
+// Party rooms are kept in memory, so they're lost when the server restarts
+// and players must all be on the same instance.
+
+const (
+	roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	roomCodeLength   = 6
+	roomRounds       = 5
+	roomMaxPlayers   = 50
+	roomMaxName      = 30
+
+	// How long players have to guess each sound and how long its answer is
+	// shown before the next one.
+	roomRoundTime  = 30 * time.Second
+	roomRevealTime = 8 * time.Second
+
+	// Rooms nobody has done anything in for this long are removed, sooner if
+	// the game never started. Idle rooms are looked for every
+	// roomSweepInterval.
+	roomIdleTimeout   = 6 * time.Hour
+	roomLobbyTimeout  = 30 * time.Minute
+	roomSweepInterval = time.Minute
+
+	// Limits on how many rooms can be open, on this server and hosted by
+	// one user.
+	roomMaxRooms  = 500
+	roomMaxHosted = 3
+
+	// Event streams end before the server's write timeout cuts them off,
+	// browsers reconnect straight away and get the room's current state.
+	roomStreamDuration = 8 * time.Second
+)
+
+// The phases a room goes through, guessing and reveal repeat for each round.
+const (
+	roomLobby    = "lobby"
+	roomGuessing = "guessing"
+	roomReveal   = "reveal"
+	roomFinished = "finished"
+)
+
+var (
+	errRoomNotFound    = errors.New("room not found")
+	errRoomFull        = errors.New("room is full")
+	errRoomFinished    = errors.New("game is over")
+	errRoomNotHost     = errors.New("only the host can do that")
+	errRoomStarted     = errors.New("game has already started")
+	errRoomNotGuessing = errors.New("not taking guesses right now")
+	errRoomGuessed     = errors.New("already guessed this round")
+	errRoomBadGuess    = errors.New("guess isn't one of the options")
+	errRoomNameTaken   = errors.New("name is already taken")
+	errRoomTooMany     = errors.New("too many rooms are open")
+	errRoomHostLimit   = errors.New("already hosting too many rooms")
+)
+
+// roomRound is a soundtest played in a room with the options offered for it.
+type roomRound struct {
+	SoundTest models.SoundTest
+	Parts     models.AllParts
+}
+
+type roomGuess struct {
+	Keyboard       string
+	Keyswitch      string
+	PlateMaterial  string
+	KeycapMaterial string
+}
+
+// correct counts the parts guess got right for st.
+func (g roomGuess) correct(st models.SoundTest) int {
+	correct := 0
+	for _, guess := range [][2]string{
+		{g.Keyboard, st.KeyboardID.String()},
+		{g.Keyswitch, st.KeyswitchID.String()},
+		{g.PlateMaterial, st.PlateMaterialID.String()},
+		{g.KeycapMaterial, st.KeycapMaterialID.String()},
+	} {
+		if guess[0] == guess[1] {
+			correct++
+		}
+	}
+	return correct
+}
+
+// offered reports whether every part guessed was one of the options.
+func (g roomGuess) offered(parts models.AllParts) bool {
+	return parts.HasKeyboard(g.Keyboard) && parts.HasSwitch(g.Keyswitch) &&
+		parts.HasPlateMaterial(g.PlateMaterial) && parts.HasKeycapMaterial(g.KeycapMaterial)
+}
+
+type roomPlayer struct {
+	// id is shown to everyone in the room, token only to the player and is
+	// how their event stream is authorized.
+	id    string
+	token string
+	name  string
+	score int
+
+	guess       *roomGuess
+	lastCorrect int
+}
+
+type room struct {
+	mu sync.Mutex
+
+	code       string
+	hostUserID string
+	host       *roomPlayer
+	players    []*roomPlayer
+	rounds     []roomRound
+	round      int
+	phase      string
+	deadline   time.Time
+	lastActive time.Time
+
+	roundTime  time.Duration
+	revealTime time.Duration
+	timer      *time.Timer
+	onFinish   func()
+
+	subscribers map[chan []byte]struct{}
+}
+
+// roomHub holds every room being played on this server.
+type roomHub struct {
+	mu    sync.Mutex
+	rooms map[string]*room
+
+	// How long players have to guess and how long answers are shown for
+	// before the next round.
+	roundTime  time.Duration
+	revealTime time.Duration
+}
+
+func newRoomHub(roundTime, revealTime time.Duration) *roomHub {
+	return &roomHub{
+		rooms:      map[string]*room{},
+		roundTime:  roundTime,
+		revealTime: revealTime,
+	}
+}
+
+// create opens a room to play rounds in, hosted by the user hostUserID as a
+// player called hostName.
+func (h *roomHub) create(hostUserID, hostName string, rounds []roomRound) (*room, *roomPlayer, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sweep(time.Now())
+
+	if len(h.rooms) >= roomMaxRooms {
+		return nil, nil, errRoomTooMany
+	}
+	hosted := 0
+	for _, rm := range h.rooms {
+		if rm.hostUserID == hostUserID {
+			hosted++
+		}
+	}
+	if hosted >= roomMaxHosted {
+		return nil, nil, errRoomHostLimit
+	}
+
+	var code string
+	for {
+		var err error
+		code, err = newRoomCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, taken := h.rooms[code]; !taken {
+			break
+		}
+	}
+
+	rm := &room{
+		code:        code,
+		hostUserID:  hostUserID,
+		rounds:      rounds,
+		phase:       roomLobby,
+		lastActive:  time.Now(),
+		roundTime:   h.roundTime,
+		revealTime:  h.revealTime,
+		subscribers: map[chan []byte]struct{}{},
+	}
+	rm.onFinish = func() {
+		time.AfterFunc(time.Hour, func() { h.remove(code, rm) })
+	}
+
+	host, err := rm.join(hostName)
+	if err != nil {
+		return nil, nil, err
+	}
+	rm.host = host
+
+	h.rooms[code] = rm
+
+	return rm, host, nil
+}
+
+// get finds the room with code, which players may type in any case.
+func (h *roomHub) get(code string) (*room, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rm, ok := h.rooms[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return nil, errRoomNotFound
+	}
+	return rm, nil
+}
+
+// remove closes rm and frees its code, unless the code has since been given
+// to another room.
+func (h *roomHub) remove(code string, rm *room) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rm.close()
+	if h.rooms[code] == rm {
+		delete(h.rooms, code)
+	}
+}
+
+// runSweeper removes idle rooms every roomSweepInterval until stop is closed.
+func (h *roomHub) runSweeper(stop <-chan struct{}) {
+	ticker := time.NewTicker(roomSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			h.mu.Lock()
+			h.sweep(now)
+			h.mu.Unlock()
+		}
+	}
+}
+
+// sweep removes rooms that have been idle since before roomIdleTimeout, or
+// roomLobbyTimeout for games that haven't started. The caller holds h.mu.
+func (h *roomHub) sweep(now time.Time) {
+	for code, rm := range h.rooms {
+		rm.mu.Lock()
+		timeout := roomIdleTimeout
+		if rm.phase == roomLobby {
+			timeout = roomLobbyTimeout
+		}
+		idle := now.Sub(rm.lastActive) > timeout
+		rm.mu.Unlock()
+
+		if idle {
+			rm.close()
+			delete(h.rooms, code)
+		}
+	}
+}
+
+func newRoomCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(roomCodeAlphabet)))
+
+	for i := 0; i < roomCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(roomCodeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// join adds a player called name, who can join until the game is over.
+func (rm *room) join(name string) (*roomPlayer, error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.phase == roomFinished {
+		return nil, errRoomFinished
+	}
+	if len(rm.players) >= roomMaxPlayers {
+		return nil, errRoomFull
+	}
+	for _, p := range rm.players {
+		if strings.EqualFold(p.name, name) {
+			return nil, errRoomNameTaken
+		}
+	}
+
+	token, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &roomPlayer{
+		id:    "p" + strconv.Itoa(len(rm.players)+1),
+		token: token.String(),
+		name:  name,
+	}
+	rm.players = append(rm.players, p)
+	rm.lastActive = time.Now()
+	rm.broadcast()
+
+	return p, nil
+}
+
+// player finds the player with token.
+func (rm *room) player(token string) (*roomPlayer, bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.playerLocked(token)
+}
+
+func (rm *room) playerLocked(token string) (*roomPlayer, bool) {
+	for _, p := range rm.players {
+		if p.token == token {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func (rm *room) isHost(token string) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.host.token == token
+}
+
+// start begins the first round, only the host can start the game.
+func (rm *room) start(token string) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.host.token != token {
+		return errRoomNotHost
+	}
+	if rm.phase != roomLobby {
+		return errRoomStarted
+	}
+
+	rm.startRound(0)
+	return nil
+}
+
+// guess records the player with token's guess for the current round, ending
+// it early once everyone has guessed.
+func (rm *room) guess(token string, g roomGuess) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	p, ok := rm.playerLocked(token)
+	if !ok {
+		return errRoomNotFound
+	}
+	if rm.phase != roomGuessing {
+		return errRoomNotGuessing
+	}
+	if p.guess != nil {
+		return errRoomGuessed
+	}
+	if !g.offered(rm.rounds[rm.round].Parts) {
+		return errRoomBadGuess
+	}
+
+	p.guess = &g
+	rm.lastActive = time.Now()
+
+	for _, p := range rm.players {
+		if p.guess == nil {
+			rm.broadcast()
+			return nil
+		}
+	}
+
+	rm.endRound(rm.round)
+	return nil
+}
+
+// startRound opens round i for guesses until the round time is up. The
+// caller holds rm.mu.
+func (rm *room) startRound(i int) {
+	rm.round = i
+	rm.phase = roomGuessing
+	rm.deadline = time.Now().Add(rm.roundTime)
+	for _, p := range rm.players {
+		p.guess = nil
+		p.lastCorrect = 0
+	}
+
+	rm.schedule(rm.roundTime, func() { rm.endRound(i) })
+	rm.broadcast()
+}
+
+// endRound scores round i and shows its answer. The caller holds rm.mu.
+func (rm *room) endRound(i int) {
+	if rm.phase != roomGuessing || rm.round != i {
+		// Everyone guessed before the timer went off.
+		return
+	}
+
+	st := rm.rounds[i].SoundTest
+	for _, p := range rm.players {
+		if p.guess != nil {
+			p.lastCorrect = p.guess.correct(st)
+			p.score += p.lastCorrect
+		}
+	}
+
+	rm.phase = roomReveal
+	rm.deadline = time.Now().Add(rm.revealTime)
+
+	rm.schedule(rm.revealTime, func() { rm.nextRound(i) })
+	rm.broadcast()
+}
+
+// nextRound moves on from round i once its answer has been shown. The caller
+// holds rm.mu.
+func (rm *room) nextRound(i int) {
+	if rm.phase != roomReveal || rm.round != i {
+		return
+	}
+
+	if i+1 < len(rm.rounds) {
+		rm.startRound(i + 1)
+		return
+	}
+
+	rm.phase = roomFinished
+	rm.deadline = time.Time{}
+	rm.broadcast()
+
+	if rm.onFinish != nil {
+		rm.onFinish()
+	}
+}
+
+// schedule runs fn with rm.mu held after d. The caller holds rm.mu.
+func (rm *room) schedule(d time.Duration, fn func()) {
+	if rm.timer != nil {
+		rm.timer.Stop()
+	}
+	rm.timer = time.AfterFunc(d, func() {
+		rm.mu.Lock()
+		defer rm.mu.Unlock()
+		fn()
+	})
+}
+
+// close stops the room's timer and ends every event stream.
+func (rm *room) close() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if rm.timer != nil {
+		rm.timer.Stop()
+	}
+	for ch := range rm.subscribers {
+		close(ch)
+		delete(rm.subscribers, ch)
+	}
+}
+
+// subscribe returns a channel receiving the room's state as JSON, starting
+// with the current state, and a function to stop receiving it. Only the
+// latest state is kept for slow subscribers.
+func (rm *room) subscribe() (<-chan []byte, func()) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	ch := make(chan []byte, 1)
+	ch <- rm.marshal()
+	rm.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		rm.mu.Lock()
+		defer rm.mu.Unlock()
+
+		if _, ok := rm.subscribers[ch]; ok {
+			delete(rm.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// broadcast sends the room's state to every subscriber. The caller holds
+// rm.mu.
+func (rm *room) broadcast() {
+	state := rm.marshal()
+
+	for ch := range rm.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- state
+	}
+}
+
+type roomOption struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type roomSound struct {
+	URL             string       `json:"url"`
+	Keyboards       []roomOption `json:"keyboards"`
+	Switches        []roomOption `json:"switches"`
+	PlateMaterials  []roomOption `json:"plateMaterials"`
+	KeycapMaterials []roomOption `json:"keycapMaterials"`
+}
+
+type roomAnswer struct {
+	SoundTestID    string `json:"soundtestId"`
+	Keyboard       string `json:"keyboard"`
+	Keyswitch      string `json:"keyswitch"`
+	PlateMaterial  string `json:"plateMaterial"`
+	KeycapMaterial string `json:"keycapMaterial"`
+}
+
+type roomPlayerState struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Host        bool   `json:"host"`
+	Score       int    `json:"score"`
+	Guessed     bool   `json:"guessed"`
+	LastCorrect int    `json:"lastCorrect"`
+}
+
+// roomState is what every player in a room is sent whenever it changes.
+type roomState struct {
+	Code      string            `json:"code"`
+	Phase     string            `json:"phase"`
+	Round     int               `json:"round"`
+	Rounds    int               `json:"rounds"`
+	Remaining int64             `json:"remaining"`
+	Sound     *roomSound        `json:"sound,omitempty"`
+	Answer    *roomAnswer       `json:"answer,omitempty"`
+	Players   []roomPlayerState `json:"players"`
+}
+
+// state is the room as players see it, the scoreboard sorted by score. The
+// caller holds rm.mu.
+func (rm *room) state() roomState {
+	s := roomState{
+		Code:   rm.code,
+		Phase:  rm.phase,
+		Rounds: len(rm.rounds),
+	}
+
+	if rm.phase == roomGuessing || rm.phase == roomReveal {
+		s.Round = rm.round + 1
+		s.Remaining = time.Until(rm.deadline).Milliseconds()
+		if s.Remaining < 0 {
+			s.Remaining = 0
+		}
+
+		round := rm.rounds[rm.round]
+		s.Sound = &roomSound{URL: round.SoundTest.URL}
+		for _, k := range round.Parts.Keyboards {
+			s.Sound.Keyboards = append(s.Sound.Keyboards, roomOption{k.ID.String(), k.Name})
+		}
+		for _, ks := range round.Parts.Switches {
+			s.Sound.Switches = append(s.Sound.Switches, roomOption{ks.ID.String(), ks.Name})
+		}
+		for _, pm := range round.Parts.PlateMaterials {
+			s.Sound.PlateMaterials = append(s.Sound.PlateMaterials, roomOption{pm.ID.String(), pm.Name})
+		}
+		for _, km := range round.Parts.KeycapMaterials {
+			s.Sound.KeycapMaterials = append(s.Sound.KeycapMaterials, roomOption{km.ID.String(), km.Name})
+		}
+
+		if rm.phase == roomReveal {
+			s.Answer = round.answer()
+		}
+	}
+
+	for _, p := range rm.players {
+		s.Players = append(s.Players, roomPlayerState{
+			ID:          p.id,
+			Name:        p.name,
+			Host:        p == rm.host,
+			Score:       p.score,
+			Guessed:     p.guess != nil,
+			LastCorrect: p.lastCorrect,
+		})
+	}
+	sort.SliceStable(s.Players, func(i, j int) bool {
+		return s.Players[i].Score > s.Players[j].Score
+	})
+
+	return s
+}
+
+func (rm *room) marshal() []byte {
+	b, _ := json.Marshal(rm.state())
+	return b
+}
+
+// answer names the round's correct parts, which are always among its options.
+func (r roomRound) answer() *roomAnswer {
+	a := &roomAnswer{SoundTestID: r.SoundTest.ID.String()}
+
+	for _, k := range r.Parts.Keyboards {
+		if k.ID == r.SoundTest.KeyboardID {
+			a.Keyboard = k.Name
+		}
+	}
+	for _, ks := range r.Parts.Switches {
+		if ks.ID == r.SoundTest.KeyswitchID {
+			a.Keyswitch = ks.Name
+		}
+	}
+	for _, pm := range r.Parts.PlateMaterials {
+		if pm.ID == r.SoundTest.PlateMaterialID {
+			a.PlateMaterial = pm.Name
+		}
+	}
+	for _, km := range r.Parts.KeycapMaterials {
+		if km.ID == r.SoundTest.KeycapMaterialID {
+			a.KeycapMaterial = km.Name
+		}
+	}
+
+	return a
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xhjohnson/clacksy/models"
+	"github.com/0xhjohnson/clacksy/ui"
+	"github.com/alexedwards/scs/v2"
+	"github.com/gofrs/uuid"
+)
+
+// testRounds makes n rounds that each offer two of every part, the first
+// being the right one.
+func testRounds(n int) []roomRound {
+	var rounds []roomRound
+
+	for i := 0; i < n; i++ {
+		var parts models.AllParts
+		for j := 0; j < 2; j++ {
+			parts.Keyboards = append(parts.Keyboards, models.Keyboard{ID: uuid.Must(uuid.NewV4()), Name: "keyboard"})
+			parts.Switches = append(parts.Switches, models.Keyswitch{ID: uuid.Must(uuid.NewV4()), Name: "switch"})
+			parts.PlateMaterials = append(parts.PlateMaterials, models.PlateMaterial{ID: uuid.Must(uuid.NewV4()), Name: "plate"})
+			parts.KeycapMaterials = append(parts.KeycapMaterials, models.KeycapMaterial{ID: uuid.Must(uuid.NewV4()), Name: "keycap"})
+		}
+
+		rounds = append(rounds, roomRound{
+			SoundTest: models.SoundTest{
+				ID:               uuid.Must(uuid.NewV4()),
+				URL:              "sound.mp3",
+				KeyboardID:       parts.Keyboards[0].ID,
+				KeyswitchID:      parts.Switches[0].ID,
+				PlateMaterialID:  parts.PlateMaterials[0].ID,
+				KeycapMaterialID: parts.KeycapMaterials[0].ID,
+			},
+			Parts: parts,
+		})
+	}
+
+	return rounds
+}
+
+// testGuess guesses the first right parts in round and the rest wrong.
+func testGuess(round roomRound, right int) roomGuess {
+	pick := func(i int, ids ...uuid.UUID) string {
+		if i < right {
+			return ids[0].String()
+		}
+		return ids[1].String()
+	}
+
+	p := round.Parts
+	return roomGuess{
+		Keyboard:       pick(0, p.Keyboards[0].ID, p.Keyboards[1].ID),
+		Keyswitch:      pick(1, p.Switches[0].ID, p.Switches[1].ID),
+		PlateMaterial:  pick(2, p.PlateMaterials[0].ID, p.PlateMaterials[1].ID),
+		KeycapMaterial: pick(3, p.KeycapMaterials[0].ID, p.KeycapMaterials[1].ID),
+	}
+}
+
+// waitForState reads states until one is in phase for round.
+func waitForState(t *testing.T, states <-chan roomState, phase string, round int) roomState {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case s, ok := <-states:
+			if !ok {
+				t.Fatalf("states closed waiting for %s %d", phase, round)
+			}
+			if s.Phase == phase && s.Round == round {
+				return s
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s %d", phase, round)
+		}
+	}
+}
+
+// subscribeStates decodes a room subscription into states.
+func subscribeStates(rm *room) (<-chan roomState, func()) {
+	raw, unsubscribe := rm.subscribe()
+	states := make(chan roomState, 16)
+
+	go func() {
+		defer close(states)
+		for b := range raw {
+			var s roomState
+			if err := json.Unmarshal(b, &s); err == nil {
+				states <- s
+			}
+		}
+	}()
+
+	return states, unsubscribe
+}
+
+func scores(s roomState) map[string]int {
+	got := map[string]int{}
+	for _, p := range s.Players {
+		got[p.Name] = p.Score
+	}
+	return got
+}
+
+func TestRoomGame(t *testing.T) {
+	hub := newRoomHub(time.Hour, 100*time.Millisecond)
+	rounds := testRounds(2)
+
+	rm, host, err := hub.create("host-user", "host", rounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := rm.join("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := rm.join("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var clients []<-chan roomState
+	for range []*roomPlayer{host, alice, bob} {
+		states, unsubscribe := subscribeStates(rm)
+		defer unsubscribe()
+		clients = append(clients, states)
+	}
+
+	for _, states := range clients {
+		s := waitForState(t, states, roomLobby, 0)
+		if len(s.Players) != 3 || s.Sound != nil {
+			t.Errorf("lobby got: %+v", s)
+		}
+	}
+
+	err = rm.start(host.token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Everyone guessing ends the round without waiting for the timer.
+	for i, right := range map[*roomPlayer]int{host: 1, alice: 4, bob: 2} {
+		err := rm.guess(i.token, testGuess(rounds[0], right))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, states := range clients {
+		s := waitForState(t, states, roomReveal, 1)
+		if s.Answer == nil || s.Answer.SoundTestID != rounds[0].SoundTest.ID.String() {
+			t.Errorf("reveal answer got: %+v", s.Answer)
+		}
+		if got := scores(s); got["alice"] != 4 || got["bob"] != 2 || got["host"] != 1 {
+			t.Errorf("round 1 scores got: %v", got)
+		}
+		if s.Players[0].Name != "alice" || s.Players[2].Name != "host" {
+			t.Errorf("scoreboard not sorted by score: %+v", s.Players)
+		}
+	}
+
+	for _, states := range clients {
+		s := waitForState(t, states, roomGuessing, 2)
+		if s.Answer != nil || len(s.Sound.Keyboards) != 2 {
+			t.Errorf("round 2 got: %+v", s)
+		}
+	}
+
+	for i, right := range map[*roomPlayer]int{host: 4, alice: 0, bob: 4} {
+		err := rm.guess(i.token, testGuess(rounds[1], right))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, states := range clients {
+		s := waitForState(t, states, roomFinished, 0)
+		if got := scores(s); got["alice"] != 4 || got["bob"] != 6 || got["host"] != 5 {
+			t.Errorf("final scores got: %v", got)
+		}
+		if s.Players[0].Name != "bob" {
+			t.Errorf("winner got: %s, want: bob", s.Players[0].Name)
+		}
+	}
+
+	_, err = rm.join("carol")
+	if !errors.Is(err, errRoomFinished) {
+		t.Errorf("join after game got: %v, want: %v", err, errRoomFinished)
+	}
+}
+
+func TestRoomRoundTimeout(t *testing.T) {
+	hub := newRoomHub(20*time.Millisecond, 100*time.Millisecond)
+	rounds := testRounds(1)
+
+	rm, host, err := hub.create("host-user", "host", rounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := rm.join("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, unsubscribe := subscribeStates(rm)
+	defer unsubscribe()
+
+	err = rm.start(host.token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rm.guess(alice.token, testGuess(rounds[0], 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The host never guesses so the round ends when time is up.
+	s := waitForState(t, states, roomReveal, 1)
+	if got := scores(s); got["alice"] != 4 || got["host"] != 0 {
+		t.Errorf("scores got: %v", got)
+	}
+
+	waitForState(t, states, roomFinished, 0)
+}
+
+func TestRoomErrors(t *testing.T) {
+	hub := newRoomHub(time.Hour, time.Hour)
+	rounds := testRounds(1)
+
+	rm, host, err := hub.create("host-user", "host", rounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := rm.join("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = rm.join("ALICE")
+	if !errors.Is(err, errRoomNameTaken) {
+		t.Errorf("join with taken name got: %v, want: %v", err, errRoomNameTaken)
+	}
+
+	err = rm.guess(alice.token, testGuess(rounds[0], 4))
+	if !errors.Is(err, errRoomNotGuessing) {
+		t.Errorf("guess in lobby got: %v, want: %v", err, errRoomNotGuessing)
+	}
+
+	err = rm.start(alice.token)
+	if !errors.Is(err, errRoomNotHost) {
+		t.Errorf("start by player got: %v, want: %v", err, errRoomNotHost)
+	}
+
+	err = rm.start(host.token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rm.start(host.token)
+	if !errors.Is(err, errRoomStarted) {
+		t.Errorf("second start got: %v, want: %v", err, errRoomStarted)
+	}
+
+	guess := testGuess(rounds[0], 4)
+	guess.Keyboard = uuid.Must(uuid.NewV4()).String()
+	err = rm.guess(alice.token, guess)
+	if !errors.Is(err, errRoomBadGuess) {
+		t.Errorf("guess not offered got: %v, want: %v", err, errRoomBadGuess)
+	}
+
+	err = rm.guess("not a player", testGuess(rounds[0], 4))
+	if !errors.Is(err, errRoomNotFound) {
+		t.Errorf("guess by stranger got: %v, want: %v", err, errRoomNotFound)
+	}
+
+	err = rm.guess(alice.token, testGuess(rounds[0], 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rm.guess(alice.token, testGuess(rounds[0], 4))
+	if !errors.Is(err, errRoomGuessed) {
+		t.Errorf("second guess got: %v, want: %v", err, errRoomGuessed)
+	}
+
+	for i := len(rm.players); i < roomMaxPlayers; i++ {
+		_, err := rm.join("player" + uuid.Must(uuid.NewV4()).String())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = rm.join("latecomer")
+	if !errors.Is(err, errRoomFull) {
+		t.Errorf("join full room got: %v, want: %v", err, errRoomFull)
+	}
+}
+
+func TestRoomHub(t *testing.T) {
+	hub := newRoomHub(time.Hour, time.Hour)
+
+	rm, _, err := hub.create("host-user", "host", testRounds(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.code) != roomCodeLength || strings.Trim(rm.code, roomCodeAlphabet) != "" {
+		t.Errorf("room code got: %q", rm.code)
+	}
+
+	got, err := hub.get(" " + strings.ToLower(rm.code) + " ")
+	if err != nil || got != rm {
+		t.Errorf("get typed code got: %v, %v", got, err)
+	}
+
+	_, err = hub.get("nope")
+	if !errors.Is(err, errRoomNotFound) {
+		t.Errorf("get unknown code got: %v, want: %v", err, errRoomNotFound)
+	}
+
+	raw, _ := rm.subscribe()
+	<-raw
+
+	rm.mu.Lock()
+	rm.lastActive = time.Now().Add(-roomIdleTimeout - time.Minute)
+	rm.mu.Unlock()
+
+	hub.mu.Lock()
+	hub.sweep(time.Now())
+	hub.mu.Unlock()
+
+	_, err = hub.get(rm.code)
+	if !errors.Is(err, errRoomNotFound) {
+		t.Errorf("idle room not removed, got: %v", err)
+	}
+	if _, ok := <-raw; ok {
+		t.Error("subscriber not closed when room was removed")
+	}
+
+	// A finished room's delayed removal mustn't take its code from a newer
+	// room that was given it.
+	reused, _, err := hub.create("other-user", "other", testRounds(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.mu.Lock()
+	delete(hub.rooms, reused.code)
+	reused.code = rm.code
+	hub.rooms[rm.code] = reused
+	hub.mu.Unlock()
+
+	hub.remove(rm.code, rm)
+
+	got, err = hub.get(rm.code)
+	if err != nil || got != reused {
+		t.Errorf("reused code got: %v, %v, want the newer room", got, err)
+	}
+}
+
+func TestRoomHubLimits(t *testing.T) {
+	hub := newRoomHub(time.Hour, time.Hour)
+
+	for i := 0; i < roomMaxHosted; i++ {
+		_, _, err := hub.create("busy-host", "host", testRounds(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err := hub.create("busy-host", "host", testRounds(1))
+	if !errors.Is(err, errRoomHostLimit) {
+		t.Errorf("create past host limit got: %v, want: %v", err, errRoomHostLimit)
+	}
+
+	for i := len(hub.rooms); i < roomMaxRooms; i++ {
+		_, _, err := hub.create("host-"+strconv.Itoa(i), "host", testRounds(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err = hub.create("new-host", "host", testRounds(1))
+	if !errors.Is(err, errRoomTooMany) {
+		t.Errorf("create past room limit got: %v, want: %v", err, errRoomTooMany)
+	}
+
+	// Lobbies time out well before games that have started.
+	var started *room
+	hub.mu.Lock()
+	for _, rm := range hub.rooms {
+		started = rm
+		break
+	}
+	hub.mu.Unlock()
+
+	err = started.start(started.host.token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub.mu.Lock()
+	hub.sweep(time.Now().Add(roomLobbyTimeout + time.Minute))
+	left := len(hub.rooms)
+	hub.mu.Unlock()
+
+	if left != 1 {
+		t.Errorf("rooms left after lobby timeout got: %d, want: 1", left)
+	}
+	if _, err := hub.get(started.code); err != nil {
+		t.Errorf("started room removed: %v", err)
+	}
+}
+
+// roomClient is a browser playing in a room over HTTP.
+type roomClient struct {
+	t      *testing.T
+	client *http.Client
+	server string
+	code   string
+}
+
+func newRoomClient(t *testing.T, server, code, name string) *roomClient {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &roomClient{t: t, client: &http.Client{Jar: jar}, server: server}
+
+	// Joining redirects to the room page, which sets the cookie for the
+	// room's event stream.
+	res, err := c.client.PostForm(server+"/rooms/join", url.Values{"code": {strings.ToLower(code)}, "name": {name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Request.URL.Path != "/rooms/"+code {
+		t.Fatalf("join got: %d %s", res.StatusCode, res.Request.URL.Path)
+	}
+
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == roomTokenCookieName && (!cookie.HttpOnly || cookie.Path != "/rooms/"+code+"/events") {
+			t.Errorf("room token cookie not scoped to the event stream: %+v", cookie)
+		}
+		if cookie.Name == roomTokenCookieName && strings.Contains(string(body), cookie.Value) {
+			t.Error("room page shows the player's token")
+		}
+	}
+	c.code = code
+
+	return c
+}
+
+// events follows the room's event stream until it ends.
+func (c *roomClient) events() <-chan roomState {
+	c.t.Helper()
+
+	res, err := c.client.Get(c.server + "/rooms/" + c.code + "/events")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		c.t.Fatalf("events got: %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	c.t.Cleanup(func() { res.Body.Close() })
+
+	states := make(chan roomState, 16)
+	go func() {
+		defer close(states)
+		defer res.Body.Close()
+
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var s roomState
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &s); err == nil {
+				states <- s
+			}
+		}
+	}()
+
+	return states
+}
+
+func (c *roomClient) guess(g roomGuess) int {
+	c.t.Helper()
+
+	res, err := c.client.PostForm(c.server+"/rooms/"+c.code+"/guess", url.Values{
+		"keyboard":        {g.Keyboard},
+		"keyswitch":       {g.Keyswitch},
+		"plate-material":  {g.PlateMaterial},
+		"keycap-material": {g.KeycapMaterial},
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestRoomOverHTTP(t *testing.T) {
+	templateCache, err := newTemplateCache(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		errorLog:       log.New(io.Discard, "", 0),
+		infoLog:        log.New(io.Discard, "", 0),
+		sessionManager: scs.New(),
+		templateCache:  templateCache,
+		rooms:          newRoomHub(time.Hour, 100*time.Millisecond),
+	}
+
+	// Cleanups run in reverse, so event streams are closed before the server.
+	ts := httptest.NewServer(app.routes())
+	t.Cleanup(ts.Close)
+
+	rounds := testRounds(1)
+	rm, host, err := app.rooms.create("host-user", "host", rounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := newRoomClient(t, ts.URL, rm.code, "alice")
+	bob := newRoomClient(t, ts.URL, rm.code, "bob")
+
+	for name, cookie := range map[string]*http.Cookie{
+		"no token":  nil,
+		"bad token": {Name: roomTokenCookieName, Value: host.token + "x"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/rooms/"+rm.code+"/events?token="+host.token, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusForbidden {
+			t.Errorf("events with %s got: %d, want: %d", name, res.StatusCode, http.StatusForbidden)
+		}
+	}
+
+	aliceStates, bobStates := alice.events(), bob.events()
+	for _, states := range []<-chan roomState{aliceStates, bobStates} {
+		if s := waitForState(t, states, roomLobby, 0); len(s.Players) != 3 {
+			t.Errorf("lobby players got: %d, want: 3", len(s.Players))
+		}
+	}
+
+	res, err := alice.client.Post(ts.URL+"/rooms/"+rm.code+"/start", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("start by player got: %d, want: %d", res.StatusCode, http.StatusForbidden)
+	}
+
+	err = rm.start(host.token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, states := range []<-chan roomState{aliceStates, bobStates} {
+		waitForState(t, states, roomGuessing, 1)
+	}
+
+	if status := alice.guess(testGuess(rounds[0], 4)); status != http.StatusNoContent {
+		t.Errorf("guess got: %d, want: %d", status, http.StatusNoContent)
+	}
+	if status := alice.guess(testGuess(rounds[0], 4)); status != http.StatusConflict {
+		t.Errorf("second guess got: %d, want: %d", status, http.StatusConflict)
+	}
+	if status := bob.guess(roomGuess{Keyboard: "nope"}); status != http.StatusBadRequest {
+		t.Errorf("guess not offered got: %d, want: %d", status, http.StatusBadRequest)
+	}
+	if status := bob.guess(testGuess(rounds[0], 3)); status != http.StatusNoContent {
+		t.Errorf("guess got: %d, want: %d", status, http.StatusNoContent)
+	}
+	err = rm.guess(host.token, testGuess(rounds[0], 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, states := range []<-chan roomState{aliceStates, bobStates} {
+		s := waitForState(t, states, roomReveal, 1)
+		if got := scores(s); got["alice"] != 4 || got["bob"] != 3 || got["host"] != 0 {
+			t.Errorf("scores got: %v", got)
+		}
+		waitForState(t, states, roomFinished, 0)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/0xhjohnson/clacksy/models"
 	"github.com/0xhjohnson/clacksy/ui"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -25,6 +26,10 @@ func (app *application) routes() http.Handler {
 
 		r.With(app.requireAuth).Get("/", app.getUserProfile)
 		r.With(app.requireAuth).Post("/", app.updateUserProfile)
+		r.With(app.requireAuth).Post("/avatar", app.updateAvatar)
+		r.With(app.requireAuth).Post("/avatar/delete", app.deleteAvatar)
+		r.With(app.requireAuth).Post("/verify-email", app.resendEmailVerification)
+		r.Get("/verify-email", app.verifyEmail)
 
 		r.Get("/new", app.newUserForm)
 		r.Post("/new", app.addNewUser)
@@ -32,14 +37,59 @@ func (app *application) routes() http.Handler {
 		r.Post("/login", app.loginUser)
 
 		r.With(app.requireAuth).Post("/logout", app.logoutUser)
+
+		r.Route("/soundtests", func(r chi.Router) {
+			r.Use(app.requireAuth)
+
+			r.Get("/", app.getUserSoundtests)
+			r.Get("/{soundtestID}", app.editSoundtestForm)
+			r.Post("/{soundtestID}", app.updateSoundtest)
+			r.Post("/{soundtestID}/delete", app.deleteSoundtest)
+		})
 	})
 
-	r.Route("/soundtest", func(r chi.Router) {
+	r.Route("/u/{username}", func(r chi.Router) {
+		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+
+		r.Get("/", app.getPublicProfile)
+		r.With(app.requireAuth).Post("/follow", app.followUser)
+		r.With(app.requireAuth).Post("/unfollow", app.unfollowUser)
+	})
+
+	r.With(app.sessionManager.LoadAndSave, app.authenticate).Get("/leaderboard", app.getLeaderboard)
+
+	r.Route("/notifications", func(r chi.Router) {
 		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
 		r.Use(app.requireAuth)
 
-		r.Get("/new", app.addSoundtestForm)
-		r.Post("/new", app.addSoundtest)
+		r.Get("/", app.getNotifications)
+		r.Post("/preferences", app.updateNotificationPreferences)
+	})
+
+	r.Route("/soundtest", func(r chi.Router) {
+		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+
+		r.With(app.requireAuth).Get("/new", app.addSoundtestForm)
+		r.With(app.requireAuth).Post("/new", app.addSoundtest)
+
+		r.Route("/{soundtestID}", func(r chi.Router) {
+			r.Get("/", app.getSoundtest)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.requireAuth)
+
+				r.Post("/comment", app.addComment)
+				r.Post("/comment/{commentID}", app.updateComment)
+				r.Post("/comment/{commentID}/delete", app.deleteComment)
+			})
+		})
+	})
+
+	r.Route("/soundtests", func(r chi.Router) {
+		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+		r.Use(app.paginateBy(browsePageSize))
+
+		r.Get("/", app.browseSoundtests)
 	})
 
 	r.Route("/vote", func(r chi.Router) {
@@ -52,18 +102,111 @@ func (app *application) routes() http.Handler {
 		r.Route("/{soundtestID}", func(r chi.Router) {
 			r.Put("/upvote", app.upvote)
 			r.Put("/downvote", app.downvote)
+			r.Post("/upvote", app.upvote)
+			r.Post("/downvote", app.downvote)
 		})
 	})
 
 	r.Route("/play", func(r chi.Router) {
 		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
-		r.Use(app.requireAuth)
+		r.Use(app.requirePlayer)
 
 		r.With(app.userDailyPlay, app.limitPlayOnce).Get("/", app.getDailySound)
 		r.Post("/", app.addPlayResult)
+		r.Get("/clip", app.getDailyClip)
 		r.With(app.userDailyPlay, app.verifyPlayed).Get("/grade", app.getGrade)
 	})
 
+	r.Route("/practice", func(r chi.Router) {
+		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+		r.Use(app.requireAuth)
+
+		r.Get("/", app.getPractice)
+		r.Post("/", app.addPracticePlay)
+	})
+
+	r.Route("/challenge", func(r chi.Router) {
+		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+
+		r.With(app.requireAuth).Post("/", app.createChallenge)
+		r.Get("/{challengeID}", app.getChallenge)
+		r.With(app.requireAuth).Post("/{challengeID}", app.answerChallenge)
+	})
+
+	r.Route("/compare", func(r chi.Router) {
+		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+		r.Use(app.requireAuth)
+
+		r.Get("/", app.getCompare)
+		r.Post("/", app.addComparison)
+	})
+
+	r.Route("/tiers", func(r chi.Router) {
+		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+
+		r.Get("/", app.getTiers)
+	})
+
+	r.Route("/rooms", func(r chi.Router) {
+		// The session middleware buffers whole responses, so the event stream
+		// goes around it.
+		r.Get("/{code}/events", app.roomEvents)
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+
+			r.Get("/", app.getRooms)
+			r.With(app.requireAuth).Post("/", app.createRoom)
+			r.Post("/join", app.joinRoom)
+			r.Get("/{code}", app.getRoom)
+			r.Post("/{code}/start", app.startRoom)
+			r.Post("/{code}/guess", app.guessRoom)
+		})
+	})
+
+	r.Route("/report", func(r chi.Router) {
+		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+		r.Use(app.requireAuth)
+
+		r.Get("/", app.reportSubjectForm)
+		r.Post("/", app.reportSubject)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(app.sessionManager.LoadAndSave, app.authenticate)
+		r.Use(app.requireRole(models.RoleModerator))
+
+		r.With(app.requirePermission(models.PermReviewVotes)).Get("/votes", app.voteReport)
+		r.With(app.requirePermission(models.PermViewModeration)).Get("/log", app.getModerationLog)
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.requirePermission(models.PermModerateReports))
+
+			r.Get("/reports", app.getReports)
+			r.Get("/reports/{reportID}", app.getReport)
+			r.Post("/reports/{reportID}", app.moderateReport)
+			r.Post("/reports/{reportID}/correct", app.correctReportedParts)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.requirePermission(models.PermManageWebhooks))
+
+			r.Get("/webhooks", app.getWebhooks)
+			r.Post("/webhooks", app.addWebhook)
+			r.Get("/webhooks/deliveries", app.getWebhookDeliveries)
+			r.Post("/webhooks/deliveries/{deliveryID}/redeliver", app.redeliverWebhook)
+			r.Post("/webhooks/{webhookID}/active", app.setWebhookActive)
+			r.Post("/webhooks/{webhookID}/delete", app.deleteWebhook)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.requirePermission(models.PermAssignRoles))
+
+			r.Get("/roles", app.getRoles)
+			r.Post("/roles/{userID}", app.setUserRole)
+		})
+	})
+
 	fileServer := http.FileServer(http.FS(ui.Files))
 	r.Handle("/public/*", fileServer)
 
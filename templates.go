@@ -1,15 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/0xhjohnson/clacksy/models"
 	"github.com/gofrs/uuid"
 )
 
@@ -23,6 +26,9 @@ type templateData struct {
 	StaticURL       string
 	AppEnv          string
 	IsAuthenticated bool
+	Access          models.Access
+	Unread          int
+	Location        *time.Location
 	PageData        any
 }
 
@@ -34,6 +40,31 @@ func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 3:04PM")
 }
 
+// humanDay formats a calendar date, which unlike a time doesn't move between
+// timezones.
+func humanDay(t time.Time) string {
+	return t.Format("02 Jan 2006")
+}
+
+// inLocation returns a copy of tmpl whose humanDate shows times in loc, UTC if
+// it's nil.
+func inLocation(tmpl *template.Template, loc *time.Location) (*template.Template, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	return clone.Funcs(template.FuncMap{
+		"humanDate": func(t time.Time) string {
+			return humanDate(t.In(loc))
+		},
+	}), nil
+}
+
 func newTemplateCache(files fs.FS) (map[string]*template.Template, error) {
 	cache := map[string]*template.Template{}
 
@@ -52,9 +83,11 @@ func newTemplateCache(files fs.FS) (map[string]*template.Template, error) {
 		}
 
 		funcMap := template.FuncMap{
-			"uuidEq":    uuidEq,
-			"humanDate": humanDate,
-			"hasPrefix": strings.HasPrefix,
+			"uuidEq":     uuidEq,
+			"humanDate":  humanDate,
+			"humanDay":   humanDay,
+			"hasPrefix":  strings.HasPrefix,
+			"pathEscape": url.PathEscape,
 		}
 
 		ts, err := template.New(name).Funcs(funcMap).ParseFS(files, patterns...)
@@ -85,6 +118,9 @@ func (app *application) newTemplateData(r *http.Request) *templateData {
 		URLPath:         r.URL.Path,
 		AppEnv:          appEnv,
 		IsAuthenticated: app.isAuthenticated(r),
+		Access:          app.access(r),
+		Unread:          app.unreadNotifications(r),
+		Location:        app.location(r),
 	}
 }
 
@@ -96,11 +132,43 @@ func (app *application) renderTemplate(w http.ResponseWriter, statusCode int, pa
 		return
 	}
 
+	tmpl, err := inLocation(tmpl, data.Location)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
 	w.WriteHeader(statusCode)
 
-	err := tmpl.ExecuteTemplate(w, "layout", data)
+	err = tmpl.ExecuteTemplate(w, "layout", data)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+}
+
+func (app *application) renderPartial(w http.ResponseWriter, statusCode int, page, name string, loc *time.Location, data any) {
+	tmpl, ok := app.templateCache[page]
+	if !ok {
+		err := fmt.Errorf("the template %s does not exist", page)
+		app.serverError(w, err)
+		return
+	}
+
+	tmpl, err := inLocation(tmpl, loc)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
+
+	buf := new(bytes.Buffer)
+
+	err = tmpl.ExecuteTemplate(buf, name, data)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.WriteHeader(statusCode)
+	buf.WriteTo(w)
 }
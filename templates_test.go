@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"testing/fstest"
 	"text/template"
 	"time"
 
+	"github.com/0xhjohnson/clacksy/models"
+	"github.com/0xhjohnson/clacksy/ui"
 	"github.com/alexedwards/scs/v2"
 	"github.com/gofrs/uuid"
 )
@@ -255,3 +261,195 @@ func TestRenderTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderPartial(t *testing.T) {
+	files := fstest.MapFS{
+		"html/layout.tmpl": &fstest.MapFile{
+			Data: []byte("{{define \"layout\"}}layout{{end}}"),
+		},
+		"html/partials/greeting.tmpl": &fstest.MapFile{
+			Data: []byte("{{define \"greeting\"}}hello {{.}}{{end}}"),
+		},
+	}
+
+	app := application{
+		templateCache: map[string]*template.Template{
+			"home": template.Must(template.New("home").ParseFS(files, "html/layout.tmpl", "html/partials/greeting.tmpl")),
+		},
+		errorLog: log.New(io.Discard, "", 0),
+	}
+
+	tests := map[string]struct {
+		page           string
+		name           string
+		wantStatusCode int
+		wantBody       string
+	}{
+		"valid partial": {
+			page:           "home",
+			name:           "greeting",
+			wantStatusCode: http.StatusOK,
+			wantBody:       "hello world",
+		},
+		"partial doesn't exist": {
+			page:           "home",
+			name:           "dne",
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		"page doesn't exist": {
+			page:           "dne",
+			name:           "greeting",
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			app.renderPartial(w, http.StatusOK, tc.page, tc.name, time.UTC, "world")
+
+			if w.Code != tc.wantStatusCode {
+				t.Errorf("unexpected statusCode, want: %d, got: %d", tc.wantStatusCode, w.Code)
+			}
+			if tc.wantBody != "" && w.Body.String() != tc.wantBody {
+				t.Errorf("unexpected body, want: %q, got: %q", tc.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCommentEscapesBody(t *testing.T) {
+	cache, err := newTemplateCache(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `<script>alert("hi")</script>`
+	comment := commentView{
+		Comment: &models.Comment{ID: uuid.Must(uuid.NewV4()), Body: body},
+		Replies: []commentView{{Comment: &models.Comment{ID: uuid.Must(uuid.NewV4()), Body: body}}},
+		CanEdit: true,
+	}
+
+	var buf bytes.Buffer
+	err = cache["soundtest-detail.tmpl"].ExecuteTemplate(&buf, "comment", comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	if strings.Contains(got, "<script>") {
+		t.Errorf("comment body not escaped: %s", got)
+	}
+	if want := "&lt;script&gt;"; strings.Count(got, want) != 3 {
+		t.Errorf("want body escaped in the comment, its edit form and the reply, got: %s", got)
+	}
+}
+
+func TestVoteReportEscapesUsernames(t *testing.T) {
+	cache, err := newTemplateCache(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := templateData{
+		PageData: voteReportData{
+			Rings: []models.VoteRing{{
+				Members: []models.RingMember{{Username: `<script>alert("hi")</script>`}},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	err = cache["admin-votes.tmpl"].ExecuteTemplate(&buf, "main", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	if strings.Contains(got, "<script>") {
+		t.Errorf("username not escaped: %s", got)
+	}
+}
+
+func TestBrowseEscapesFilters(t *testing.T) {
+	cache, err := newTemplateCache(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := `"><script>alert("hi")</script>`
+	data := templateData{
+		Form: browseForm{
+			SoundTestFilter: models.SoundTestFilter{Query: payload, Uploader: payload},
+		},
+		PageData: browsePageData{},
+	}
+
+	var buf bytes.Buffer
+	err = cache["browse.tmpl"].ExecuteTemplate(&buf, "main", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	if strings.Contains(got, "<script>") {
+		t.Errorf("browse filters not escaped: %s", got)
+	}
+	if want := "&#34;&gt;&lt;script&gt;"; strings.Count(got, want) != 2 {
+		t.Errorf("want query and uploader escaped, got: %s", got)
+	}
+}
+
+func TestReportEscapesForm(t *testing.T) {
+	app := newTestApplication(t, nil)
+	payload := `"><script>alert("hi")</script>`
+	subjectID := uuid.Must(uuid.NewV4()).String()
+
+	tests := map[string]struct {
+		req      *http.Request
+		handler  http.HandlerFunc
+		wantCode int
+	}{
+		"form from referer": {
+			req: func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/report?type=soundtest&id="+subjectID, nil)
+				r.Header.Set("Referer", "http://example.com/%22%3E%3Cscript%3Ealert(1)%3C/script%3E")
+				return r
+			}(),
+			handler:  app.reportSubjectForm,
+			wantCode: http.StatusOK,
+		},
+		"invalid post": {
+			req: func() *http.Request {
+				form := url.Values{
+					"type":    {models.SubjectSoundTest},
+					"id":      {subjectID},
+					"reason":  {payload},
+					"details": {payload},
+					"return":  {"/" + payload},
+				}
+				r := httptest.NewRequest(http.MethodPost, "/report", strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				return r
+			}(),
+			handler:  app.reportSubject,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.sessionManager.LoadAndSave(tc.handler).ServeHTTP(rr, tc.req)
+
+			if rr.Code != tc.wantCode {
+				t.Fatalf("got status: %d, want: %d", rr.Code, tc.wantCode)
+			}
+			if got := rr.Body.String(); strings.Contains(got, "<script>") {
+				t.Errorf("report form not escaped: %s", got)
+			}
+		})
+	}
+}
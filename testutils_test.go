@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/0xhjohnson/clacksy/models"
+	"github.com/0xhjohnson/clacksy/ui"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// newTestDB connects to the database at TEST_DATABASE_URL, which needs
+// clacksy's schema and some parts to build soundtests from. Tests that use
+// it are skipped without one.
+func newTestDB(t *testing.T) *pgxpool.Pool {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := openDbPool(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	return db
+}
+
+// newTestApplication makes an application for handler tests. db can be nil
+// for handlers that don't get as far as the database.
+func newTestApplication(t *testing.T, db *pgxpool.Pool) *application {
+	templateCache, err := newTemplateCache(ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &application{
+		errorLog:       log.New(io.Discard, "", 0),
+		infoLog:        log.New(io.Discard, "", 0),
+		sessionManager: scs.New(),
+		templateCache:  templateCache,
+		users:          &models.UserModel{DB: db},
+		soundtests:     &models.SoundTestModel{DB: db},
+		parts:          &models.PartsModel{DB: db},
+		challenges:     &models.ChallengeModel{DB: db},
+		mailer:         newMailer(log.New(io.Discard, "", 0)),
+	}
+}
+
+// testUser signs up a user, who is deleted with everything they uploaded
+// after the test.
+func testUser(t *testing.T, app *application) string {
+	t.Helper()
+
+	userID, err := app.users.Insert(uuid.Must(uuid.NewV4()).String()+"@example.com", "password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_, err := app.users.DB.Exec(context.Background(), "DELETE FROM sound_test WHERE created_by = $1", userID)
+		if err != nil {
+			t.Error(err)
+		}
+		_, err = app.users.DB.Exec(context.Background(), "DELETE FROM user_profile WHERE user_profile_id = $1", userID)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	return userID.String()
+}
+
+// testSoundTest uploads a soundtest by userID built from the first of each
+// kind of part.
+func testSoundTest(t *testing.T, app *application, userID string) models.SoundTest {
+	t.Helper()
+
+	var keyboard, plateMaterial, keycapMaterial, keyswitch uuid.UUID
+
+	stmt := `SELECT
+		  (SELECT keyboard_id FROM keyboard ORDER BY name LIMIT 1),
+		  (SELECT plate_material_id FROM plate_material ORDER BY name LIMIT 1),
+		  (SELECT keycap_material_id FROM keycap_material ORDER BY name LIMIT 1),
+		  (SELECT keyswitch_id FROM keyswitch ORDER BY name LIMIT 1)`
+
+	err := app.soundtests.DB.QueryRow(context.Background(), stmt).Scan(&keyboard, &plateMaterial, &keycapMaterial, &keyswitch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := app.soundtests.Insert("soundtests/"+userID+"/test.mp3", keyboard.String(), plateMaterial.String(), keycapMaterial.String(), keyswitch.String(), userID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return models.SoundTest{ID: id, KeyboardID: keyboard, PlateMaterialID: plateMaterial, KeycapMaterialID: keycapMaterial, KeyswitchID: keyswitch}
+}
+
+// testSession makes requests straight to handlers as one browser would,
+// keeping the session cookie between them.
+type testSession struct {
+	t      *testing.T
+	app    *application
+	cookie *http.Cookie
+	values map[string]any
+}
+
+// newTestSession starts a session logged in as userID, or logged out if it's
+// empty.
+func newTestSession(t *testing.T, app *application, userID string) *testSession {
+	s := &testSession{t: t, app: app, values: map[string]any{}}
+	if userID != "" {
+		s.values["authenticatedUserID"] = userID
+	}
+	return s
+}
+
+// put stores value in the session at the start of the next request.
+func (s *testSession) put(key string, value any) {
+	s.values[key] = value
+}
+
+// do serves a request to h, a POST with form when it isn't nil.
+func (s *testSession) do(h http.HandlerFunc, target string, form url.Values) *http.Response {
+	s.t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if form != nil {
+		req = httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if s.cookie != nil {
+		req.AddCookie(s.cookie)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key, value := range s.values {
+			s.app.sessionManager.Put(r.Context(), key, value)
+		}
+		s.values = map[string]any{}
+
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, s.app.sessionManager.Exists(r.Context(), "authenticatedUserID"))
+		h(w, r.WithContext(ctx))
+	})
+
+	rr := httptest.NewRecorder()
+	s.app.sessionManager.LoadAndSave(next).ServeHTTP(rr, req)
+
+	res := rr.Result()
+	for _, c := range res.Cookies() {
+		if c.Name == s.app.sessionManager.Cookie.Name {
+			s.cookie = c
+		}
+	}
+
+	return res
+}
+
+// get reads a value from the session as it was left by the last request.
+func (s *testSession) get(key string) any {
+	s.t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if s.cookie != nil {
+		req.AddCookie(s.cookie)
+	}
+
+	var value any
+	s.app.sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value = s.app.sessionManager.Get(r.Context(), key)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	return value
+}
+
+// assertRedirect checks res is a See Other to want.
+func assertRedirect(t *testing.T, res *http.Response, want string) {
+	t.Helper()
+
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("got status: %d, want: %d", res.StatusCode, http.StatusSeeOther)
+	}
+	if got := res.Header.Get("Location"); got != want {
+		t.Errorf("got redirect: %q, want: %q", got, want)
+	}
+}
+
+// withURLParam sets a chi URL parameter for h, as the router would.
+func withURLParam(h http.HandlerFunc, key, value string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add(key, value)
+		h(w, r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx)))
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// timezoneCookieName is the cookie layout.js sets to the browser's timezone.
+const timezoneCookieName = "tz"
+
+var locations sync.Map
+
+// loadTimezone returns the location of an IANA timezone name like
+// Europe/London. Names are only ever looked up once.
+func loadTimezone(name string) (*time.Location, bool) {
+	// LoadLocation takes these to mean UTC and the server's own zone.
+	if name == "" || name == "Local" {
+		return nil, false
+	}
+
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), true
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, false
+	}
+	locations.Store(name, loc)
+
+	return loc, true
+}
+
+// browserTimezone is the timezone the visitor's browser reported, or empty.
+func browserTimezone(r *http.Request) string {
+	cookie, err := r.Cookie(timezoneCookieName)
+	if err != nil {
+		return ""
+	}
+
+	name, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return ""
+	}
+
+	if _, ok := loadTimezone(name); !ok {
+		return ""
+	}
+
+	return name
+}
+
+// location is the timezone dates are shown and the sound of the day is picked
+// in, the user's own choice, then their browser's and UTC otherwise.
+func (app *application) location(r *http.Request) *time.Location {
+	if name, ok := r.Context().Value(timezoneContextKey).(string); ok {
+		if loc, ok := loadTimezone(name); ok {
+			return loc
+		}
+	}
+
+	if loc, ok := loadTimezone(browserTimezone(r)); ok {
+		return loc
+	}
+
+	return time.UTC
+}
+
+// now is the current time in the request's location, its date is the one
+// whose sound of the day is played.
+func (app *application) now(r *http.Request) time.Time {
+	return time.Now().In(app.location(r))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestLoadTimezone(t *testing.T) {
+	tests := map[string]bool{
+		"Europe/London":    true,
+		"Asia/Tokyo":       true,
+		"UTC":              true,
+		"":                 false,
+		"Local":            false,
+		"Mars/Olympus":     false,
+		"../../etc/passwd": false,
+	}
+
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			loc, ok := loadTimezone(name)
+			if ok != want {
+				t.Fatalf("want ok: %v, got: %v", want, ok)
+			}
+			if ok && loc.String() != name {
+				t.Errorf("want location: %s, got: %s", name, loc)
+			}
+		})
+	}
+}
+
+func TestLocation(t *testing.T) {
+	tests := map[string]struct {
+		saved  string
+		cookie string
+		want   string
+	}{
+		"nothing":            {want: "UTC"},
+		"browser":            {cookie: "Asia%2FTokyo", want: "Asia/Tokyo"},
+		"bad browser":        {cookie: "Nowhere", want: "UTC"},
+		"saved":              {saved: "Europe/London", want: "Europe/London"},
+		"saved over browser": {saved: "Europe/London", cookie: "Asia%2FTokyo", want: "Europe/London"},
+	}
+
+	app := &application{}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: timezoneCookieName, Value: tc.cookie})
+			}
+			if tc.saved != "" {
+				r = r.WithContext(context.WithValue(r.Context(), timezoneContextKey, tc.saved))
+			}
+
+			got := app.location(r)
+			if got.String() != tc.want {
+				t.Errorf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestInLocation(t *testing.T) {
+	tmpl := template.Must(template.New("date").Funcs(template.FuncMap{"humanDate": humanDate}).Parse("{{humanDate .}}"))
+	tokyo, _ := loadTimezone("Asia/Tokyo")
+	at := time.Date(2023, time.March, 10, 20, 30, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		loc  *time.Location
+		want string
+	}{
+		"nil is UTC": {want: "10 Mar 2023 at 8:30PM"},
+		"tokyo":      {loc: tokyo, want: "11 Mar 2023 at 5:30AM"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			local, err := inLocation(tmpl, tc.loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b strings.Builder
+			err = local.Execute(&b, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tc.want {
+				t.Errorf("want: %q, got: %q", tc.want, b.String())
+			}
+		})
+	}
+}
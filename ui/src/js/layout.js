@@ -9,6 +9,13 @@ if (userMenuButton) {
   userMenuButton.addEventListener('click', userMenu.handleClick)
 }
 
+// Tell the server the browser's timezone so dates and the sound of the day
+// follow it for visitors and users who haven't picked one
+const timezone = Intl.DateTimeFormat().resolvedOptions().timeZone
+if (timezone) {
+  document.cookie = `tz=${encodeURIComponent(timezone)}; path=/; max-age=31536000; samesite=lax`
+}
+
 function makeMobileMenu(mobileMenuBtn) {
   let isMobileMenuOpen = false
 
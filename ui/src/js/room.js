@@ -0,0 +1,135 @@
+const roomEl = document.getElementById('room')
+
+if (roomEl) {
+  const { code, player, staticUrl } = roomEl.dataset
+  const statusEl = document.getElementById('room-status')
+  const startBtn = document.getElementById('room-start')
+  const scoreboardEl = document.getElementById('room-scoreboard')
+  const guessForm = document.getElementById('room-guess')
+  const audioEl = document.getElementById('room-audio')
+  const answerEl = document.getElementById('room-answer')
+
+  let state
+  let shownRound = 0
+  let deadline = 0
+
+  // The server ends each stream after a few seconds, EventSource reconnects
+  // and is sent the room's current state again
+  const events = new EventSource(`/rooms/${code}/events`)
+  events.addEventListener('message', function (e) {
+    state = JSON.parse(e.data)
+    deadline = Date.now() + state.remaining
+    render(state)
+
+    if (state.phase === 'finished') {
+      events.close()
+    }
+  })
+
+  if (startBtn) {
+    startBtn.addEventListener('click', function () {
+      startBtn.disabled = true
+      fetch(`/rooms/${code}/start`, { method: 'POST' })
+    })
+  }
+
+  guessForm.addEventListener('submit', function (e) {
+    e.preventDefault()
+    const body = new URLSearchParams(new FormData(guessForm))
+    setGuessing(false)
+    fetch(`/rooms/${code}/guess`, { method: 'POST', body: body })
+  })
+
+  setInterval(function () {
+    if (state) {
+      statusEl.textContent = statusText(state)
+    }
+  }, 250)
+
+  function render(state) {
+    statusEl.textContent = statusText(state)
+    renderScoreboard(state.players, state.phase)
+
+    if (startBtn) {
+      startBtn.classList.toggle('hidden', state.phase !== 'lobby')
+      startBtn.classList.toggle('inline-flex', state.phase === 'lobby')
+    }
+
+    if (state.phase === 'guessing' && state.round !== shownRound) {
+      shownRound = state.round
+      showRound(state.sound)
+    }
+
+    const me = state.players.find((p) => p.id === player)
+    guessForm.classList.toggle('hidden', state.phase !== 'guessing')
+    setGuessing(state.phase === 'guessing' && me && !me.guessed)
+
+    answerEl.classList.toggle('hidden', state.phase !== 'reveal')
+    if (state.answer) {
+      for (const el of answerEl.querySelectorAll('[data-answer]')) {
+        el.textContent = state.answer[el.dataset.answer]
+      }
+    }
+  }
+
+  function showRound(sound) {
+    audioEl.src = `${staticUrl}/${sound.url}`
+    audioEl.play().catch(function () {})
+
+    for (const select of guessForm.querySelectorAll('select')) {
+      select.replaceChildren(new Option('', ''))
+      for (const option of sound[select.dataset.options]) {
+        select.appendChild(new Option(option.name, option.id))
+      }
+    }
+  }
+
+  function setGuessing(enabled) {
+    for (const el of guessForm.elements) {
+      el.disabled = !enabled
+    }
+  }
+
+  function renderScoreboard(players, phase) {
+    scoreboardEl.replaceChildren()
+
+    for (const p of players) {
+      const li = document.createElement('li')
+      li.className = 'flex justify-between py-2'
+
+      const name = document.createElement('span')
+      name.textContent = p.name + (p.host ? ' (host)' : '')
+      if (p.id === player) {
+        name.className = 'font-medium text-gray-900'
+      }
+
+      const score = document.createElement('span')
+      score.className = 'text-gray-500'
+      if (phase === 'guessing') {
+        score.textContent = `${p.score}${p.guessed ? ' · locked in' : ''}`
+      } else if (phase === 'reveal') {
+        score.textContent = `${p.score} (+${p.lastCorrect})`
+      } else {
+        score.textContent = p.score
+      }
+
+      li.append(name, score)
+      scoreboardEl.appendChild(li)
+    }
+  }
+
+  function statusText(state) {
+    const seconds = Math.max(0, Math.ceil((deadline - Date.now()) / 1000))
+
+    switch (state.phase) {
+      case 'lobby':
+        return `Waiting for the host to start, ${state.players.length} in the room`
+      case 'guessing':
+        return `Sound ${state.round} of ${state.rounds}, ${seconds}s to guess`
+      case 'reveal':
+        return `Sound ${state.round} of ${state.rounds}, next one in ${seconds}s`
+      default:
+        return 'Game over, thanks for playing'
+    }
+  }
+}
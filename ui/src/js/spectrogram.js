@@ -0,0 +1,50 @@
+const audio = document.getElementById('soundtest-audio')
+const canvas = document.getElementById('spectrogram')
+
+if (audio && canvas) {
+  let analyser
+
+  audio.addEventListener('play', function () {
+    // An AudioContext can only start after the user interacts with the page
+    if (!analyser) {
+      analyser = makeAnalyser(audio)
+      draw(analyser, canvas)
+    }
+    analyser.context.resume()
+  })
+}
+
+function makeAnalyser(audio) {
+  const context = new AudioContext()
+  const source = context.createMediaElementSource(audio)
+  const analyser = context.createAnalyser()
+
+  analyser.fftSize = 512
+  source.connect(analyser)
+  analyser.connect(context.destination)
+
+  return analyser
+}
+
+// draw scrolls the spectrogram left one pixel per frame, painting the newest
+// frequencies, low at the bottom, in the rightmost column.
+function draw(analyser, canvas) {
+  const ctx = canvas.getContext('2d')
+  const bins = new Uint8Array(analyser.frequencyBinCount)
+  const binHeight = canvas.height / bins.length
+
+  function frame() {
+    analyser.getByteFrequencyData(bins)
+
+    ctx.drawImage(canvas, -1, 0)
+    for (let i = 0; i < bins.length; i++) {
+      const hue = 330 - (bins[i] / 255) * 90
+      ctx.fillStyle = `hsl(${hue}, 90%, ${(bins[i] / 255) * 60}%)`
+      ctx.fillRect(canvas.width - 1, canvas.height - (i + 1) * binHeight, 1, binHeight)
+    }
+
+    requestAnimationFrame(frame)
+  }
+
+  requestAnimationFrame(frame)
+}
@@ -0,0 +1,15 @@
+const timezoneInput = document.getElementById('timezone')
+const timezoneList = document.getElementById('timezones')
+
+if (timezoneInput && timezoneList) {
+  // Older browsers can't list timezones, the field still takes any IANA name
+  const timezones = Intl.supportedValuesOf ? Intl.supportedValuesOf('timeZone') : []
+
+  for (const timezone of timezones) {
+    const option = document.createElement('option')
+    option.value = timezone
+    timezoneList.appendChild(option)
+  }
+
+  timezoneInput.placeholder = Intl.DateTimeFormat().resolvedOptions().timeZone || timezoneInput.placeholder
+}
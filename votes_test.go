@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestCastVoteNotFound(t *testing.T) {
+	app := newTestApplication(t, newTestDB(t))
+
+	voter := testUser(t, app)
+	uploader := testUser(t, app)
+	hidden := testSoundTest(t, app, uploader)
+
+	_, err := app.soundtests.DB.Exec(context.Background(), "UPDATE sound_test SET hidden = true WHERE sound_test_id = $1", hidden.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"missing": uuid.Must(uuid.NewV4()).String(),
+		"hidden":  hidden.ID.String(),
+	}
+
+	for name, soundtestID := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := newTestSession(t, app, voter)
+
+			res := s.do(withURLParam(app.upvote, "soundtestID", soundtestID), "/vote/"+soundtestID+"/upvote", url.Values{})
+			if res.StatusCode != http.StatusNotFound {
+				t.Errorf("got status: %d, want: %d", res.StatusCode, http.StatusNotFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0xhjohnson/clacksy/models"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	webhookBatchSize    = 20
+	webhookLease        = 2 * time.Minute
+	webhookPollInterval = 15 * time.Second
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookPayload is the body of every webhook request. Content is a ready to
+// post message so Discord webhook URLs work without a bot in between.
+// AllowedMentions stops Discord pinging anyone named in Content, since
+// usernames like "everyone" and "here" are otherwise mass mentions.
+type webhookPayload struct {
+	ID              uuid.UUID       `json:"id"`
+	Event           string          `json:"event"`
+	Created         time.Time       `json:"created"`
+	Content         string          `json:"content"`
+	AllowedMentions allowedMentions `json:"allowed_mentions"`
+	Data            any             `json:"data"`
+}
+
+type allowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+// emitWebhook queues event for every webhook subscribed to it. Failing to
+// queue is logged rather than failing whatever triggered the event.
+func (app *application) emitWebhook(event, content string, data any) {
+	payload, err := newWebhookPayload(event, content, data, time.Now().UTC())
+	if err != nil {
+		app.errorLog.Printf("failed to queue %s webhook: %v", event, err)
+		return
+	}
+
+	_, err = app.webhooks.Enqueue(event, payload)
+	if err != nil {
+		app.errorLog.Printf("failed to queue %s webhook: %v", event, err)
+	}
+}
+
+func newWebhookPayload(event, content string, data any, now time.Time) ([]byte, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(webhookPayload{
+		ID:              id,
+		Event:           event,
+		Created:         now,
+		Content:         content,
+		AllowedMentions: allowedMentions{Parse: []string{}},
+		Data:            data,
+	})
+}
+
+// signWebhook signs the timestamp and body together so a captured request
+// can't be replayed later with a new timestamp.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook POSTs a delivery and returns the response status code. Any
+// status outside 2xx is an error.
+func sendWebhook(client *http.Client, d models.Delivery, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := now.Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "clacksy-webhooks/1")
+	req.Header.Set("X-Clacksy-Event", d.Event)
+	req.Header.Set("X-Clacksy-Delivery", d.ID.String())
+	req.Header.Set("X-Clacksy-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Clacksy-Signature", signWebhook(d.Secret, timestamp, d.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// deliverWebhooks sends every delivery that's due and returns how many were
+// attempted.
+func (app *application) deliverWebhooks() (int, error) {
+	attempted := 0
+
+	for {
+		deliveries, err := app.webhooks.ClaimDue(webhookBatchSize, webhookLease)
+		if err != nil {
+			return attempted, err
+		}
+
+		for _, d := range deliveries {
+			statusCode, sendErr := sendWebhook(webhookClient, d, time.Now())
+
+			err := app.webhooks.RecordAttempt(d.ID, statusCode, sendErr)
+			if err != nil {
+				return attempted, err
+			}
+			attempted++
+		}
+
+		if len(deliveries) < webhookBatchSize {
+			return attempted, nil
+		}
+	}
+}
+
+// runWebhookWorker delivers webhooks in the background until stop is closed.
+func (app *application) runWebhookWorker(stop <-chan struct{}) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := app.deliverWebhooks()
+			if err != nil {
+				app.errorLog.Printf("failed to deliver webhooks: %v", err)
+			}
+		}
+	}
+}
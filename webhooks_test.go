@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0xhjohnson/clacksy/models"
+	"github.com/gofrs/uuid"
+)
+
+func TestSendWebhook(t *testing.T) {
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	d := models.Delivery{
+		ID:      uuid.Must(uuid.NewV4()),
+		Secret:  "shh",
+		Event:   models.EventDailyRotated,
+		Payload: []byte(`{"event":"daily.rotated"}`),
+	}
+
+	var got *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	d.URL = receiver.URL
+
+	statusCode, err := sendWebhook(receiver.Client(), d, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNoContent {
+		t.Errorf("got status: %d, want: %d", statusCode, http.StatusNoContent)
+	}
+
+	if string(body) != string(d.Payload) {
+		t.Errorf("got body: %q, want: %q", body, d.Payload)
+	}
+
+	timestamp, err := strconv.ParseInt(got.Header.Get("X-Clacksy-Timestamp"), 10, 64)
+	if err != nil || timestamp != now.Unix() {
+		t.Errorf("got timestamp: %q, want: %d", got.Header.Get("X-Clacksy-Timestamp"), now.Unix())
+	}
+
+	headers := map[string]string{
+		"Content-Type":        "application/json",
+		"X-Clacksy-Event":     models.EventDailyRotated,
+		"X-Clacksy-Delivery":  d.ID.String(),
+		"X-Clacksy-Signature": signWebhook("shh", now.Unix(), body),
+	}
+	for name, want := range headers {
+		if got := got.Header.Get(name); got != want {
+			t.Errorf("got %s: %q, want: %q", name, got, want)
+		}
+	}
+}
+
+func TestSendWebhookErrorStatus(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	d := models.Delivery{ID: uuid.Must(uuid.NewV4()), URL: receiver.URL, Payload: []byte("{}")}
+
+	statusCode, err := sendWebhook(receiver.Client(), d, time.Now())
+	if err == nil {
+		t.Error("expected an error for a 500 response")
+	}
+	if statusCode != http.StatusInternalServerError {
+		t.Errorf("got status: %d, want: %d", statusCode, http.StatusInternalServerError)
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"a":1}`)
+	sig := signWebhook("secret", 100, body)
+
+	if sig != signWebhook("secret", 100, body) {
+		t.Error("signature isn't deterministic")
+	}
+	if sig == signWebhook("secret", 101, body) {
+		t.Error("signature doesn't cover the timestamp")
+	}
+	if sig == signWebhook("other", 100, body) {
+		t.Error("signature doesn't depend on the secret")
+	}
+	if len(sig) != len("sha256=")+64 {
+		t.Errorf("unexpected signature length: %q", sig)
+	}
+}
+
+func TestNewWebhookPayloadSuppressesMentions(t *testing.T) {
+	body, err := newWebhookPayload(models.EventSoundTestUploaded, "New soundtest from @everyone", nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload struct {
+		AllowedMentions *struct {
+			Parse []string `json:"parse"`
+		} `json:"allowed_mentions"`
+	}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.AllowedMentions == nil || payload.AllowedMentions.Parse == nil || len(payload.AllowedMentions.Parse) != 0 {
+		t.Errorf("want allowed_mentions.parse to be an empty list, got: %s", body)
+	}
+}